@@ -0,0 +1,361 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"bio-assembler/pkg/config"
+	"bio-assembler/pkg/pipeline"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/semaphore"
+)
+
+// sheetColumns lists the columns a sample sheet may contain. Only "sample"
+// is required, plus either "srr" or "reads1" (and "reads2" for paired-end
+// libraries). Several lanes are given as a comma-separated list, as are
+// several runs in "long_reads".
+var sheetColumns = []string{
+	"sample", "srr", "reads1", "reads2", "long_reads",
+	"adapter_fasta", "filter_mode", "filter_custom_args", "threads", "memory",
+}
+
+// sheetRow is one sample of a sample sheet with its per-sample overrides.
+// Empty override fields keep the value from the configuration.
+type sheetRow struct {
+	sample
+	Line             int
+	AdapterFasta     string
+	FilterMode       string
+	FilterCustomArgs string
+	Threads          int
+	Memory           int
+}
+
+// readSampleSheet parses a tab-separated sample sheet with a header line.
+// Blank lines and lines starting with '#' are ignored. Relative read and
+// adapter paths are resolved against the directory of the sheet.
+func readSampleSheet(path string) ([]sheetRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sample sheet: %w", err)
+	}
+	defer f.Close()
+
+	sheetDir := filepath.Dir(path)
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(sheetDir, p)
+	}
+	resolveLanes := func(v string) []string {
+		var lanes []string
+		for _, p := range strings.Split(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				lanes = append(lanes, resolve(p))
+			}
+		}
+		return lanes
+	}
+
+	var (
+		header []string
+		rows   []sheetRow
+		seen   = make(map[string]int)
+	)
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		if header == nil {
+			header = fields
+			known := make(map[string]bool, len(sheetColumns))
+			for _, c := range sheetColumns {
+				known[c] = true
+			}
+			for _, c := range header {
+				if !known[c] {
+					return nil, fmt.Errorf("%s:%d: unknown column %q (known columns: %s)", path, lineNo, c, strings.Join(sheetColumns, ", "))
+				}
+			}
+			continue
+		}
+
+		if len(fields) > len(header) {
+			return nil, fmt.Errorf("%s:%d: %d fields but the header has %d columns", path, lineNo, len(fields), len(header))
+		}
+		values := make(map[string]string, len(header))
+		for i, c := range header {
+			if i < len(fields) {
+				values[c] = fields[i]
+			}
+		}
+
+		row := sheetRow{
+			sample: sample{
+				Name:      values["sample"],
+				SrrID:     values["srr"],
+				Reads1:    resolveLanes(values["reads1"]),
+				Reads2:    resolveLanes(values["reads2"]),
+				LongReads: resolveLanes(values["long_reads"]),
+			},
+			Line:             lineNo,
+			AdapterFasta:     resolve(values["adapter_fasta"]),
+			FilterMode:       values["filter_mode"],
+			FilterCustomArgs: values["filter_custom_args"],
+		}
+		if row.Name == "" {
+			row.Name = row.SrrID
+		}
+		for _, col := range []struct {
+			name string
+			dst  *int
+		}{{"threads", &row.Threads}, {"memory", &row.Memory}} {
+			if v := values[col.name]; v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 {
+					return nil, fmt.Errorf("%s:%d: %s must be a positive integer, got %q", path, lineNo, col.name, v)
+				}
+				*col.dst = n
+			}
+		}
+
+		if err := row.validate(); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNo, err)
+		}
+		if prev, ok := seen[row.Name]; ok {
+			return nil, fmt.Errorf("%s:%d: sample %s already defined on line %d", path, lineNo, row.Name, prev)
+		}
+		seen[row.Name] = lineNo
+
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read sample sheet: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("sample sheet %s contains no samples", path)
+	}
+	return rows, nil
+}
+
+// batchResult is one line of the batch summary.
+type batchResult struct {
+	Sample     string
+	Source     string
+	Status     string
+	Duration   time.Duration
+	FailedStep string
+	Assembly   string
+	Err        error
+}
+
+// runBatch processes every sample of the sheet, running as many samples at
+// the same time as the global thread and memory budget allows. A failing
+// sample does not stop the others; the outcome of all samples is written to
+// data/batch_summary.tsv.
+func runBatch(ctx context.Context, cmd *cobra.Command, cfg *config.Config, baseDir string) error {
+	rows, err := readSampleSheet(samplesPath)
+	if err != nil {
+		return err
+	}
+
+	budgetThreads := cfg.Resources.TotalThreads
+	if cmd.Flags().Changed("total-threads") {
+		budgetThreads = totalThreads
+	}
+	if budgetThreads == 0 {
+		budgetThreads = max(runtime.NumCPU(), cfg.Resources.Threads)
+	}
+	budgetMemory := cfg.Resources.TotalMemory
+	if cmd.Flags().Changed("total-memory") {
+		budgetMemory = totalMemory
+	}
+	if budgetMemory == 0 {
+		budgetMemory = cfg.Resources.Memory
+	}
+	fmt.Printf("Processing %d samples with a budget of %d threads and %d GB memory\n", len(rows), budgetThreads, budgetMemory)
+	if cfg.Resources.MaxParallel > 1 {
+		fmt.Printf("Note: the steps of each sample run one at a time in batch mode; resources.max_parallel (%d) is not used.\n", cfg.Resources.MaxParallel)
+	}
+
+	threadPool := semaphore.NewWeighted(int64(budgetThreads))
+	memoryPool := semaphore.NewWeighted(int64(budgetMemory))
+
+	results := make([]batchResult, len(rows))
+	var wg sync.WaitGroup
+	for i, row := range rows {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runBatchSample(ctx, row, cfg, baseDir, threadPool, memoryPool, budgetThreads, budgetMemory)
+		}()
+	}
+	wg.Wait()
+
+	summaryPath := filepath.Join(baseDir, "data", "batch_summary.tsv")
+	if err := writeBatchSummary(summaryPath, results); err != nil {
+		return err
+	}
+	printBatchSummary(results)
+	fmt.Printf("Batch summary written to %s\n", summaryPath)
+
+	failed := 0
+	for _, r := range results {
+		if r.Status != "completed" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d samples did not complete", failed, len(results))
+	}
+	return nil
+}
+
+// runBatchSample applies the sample's overrides, waits for its share of
+// the resource budget and runs its pipeline.
+func runBatchSample(ctx context.Context, row sheetRow, base *config.Config, baseDir string,
+	threadPool, memoryPool *semaphore.Weighted, budgetThreads, budgetMemory int) batchResult {
+
+	result := batchResult{Sample: row.Name, Source: row.SrrID}
+	if row.SrrID == "" {
+		result.Source = strings.Join(append(append([]string{}, row.Reads1...), row.Reads2...), ",")
+	}
+	fail := func(status string, err error) batchResult {
+		result.Status = status
+		result.Err = err
+		return result
+	}
+
+	cfg := *base
+	// Every step may use all the threads and memory of the sample, so its
+	// steps run one at a time; the batch runs samples in parallel instead.
+	cfg.Resources.MaxParallel = 1
+	if row.AdapterFasta != "" {
+		cfg.Steps.Trim.AdapterFasta = row.AdapterFasta
+	}
+	if row.FilterMode != "" {
+		cfg.Steps.Trim.Mode = row.FilterMode
+	}
+	if row.FilterCustomArgs != "" {
+		cfg.Steps.Trim.CustomArgs = row.FilterCustomArgs
+	}
+	if row.Threads > 0 {
+		cfg.Resources.Threads = row.Threads
+	}
+	if row.Memory > 0 {
+		cfg.Resources.Memory = row.Memory
+	}
+	if err := cfg.Validate(); err != nil {
+		return fail("failed", err)
+	}
+	if err := requireRunSettings(&cfg); err != nil {
+		return fail("failed", err)
+	}
+	if cfg.Resources.Threads > budgetThreads || cfg.Resources.Memory > budgetMemory {
+		return fail("failed", fmt.Errorf("sample needs %d threads and %d GB, which exceeds the batch budget of %d threads and %d GB",
+			cfg.Resources.Threads, cfg.Resources.Memory, budgetThreads, budgetMemory))
+	}
+
+	// Resources are always taken in the same order so samples waiting for
+	// the budget cannot deadlock each other.
+	if err := threadPool.Acquire(ctx, int64(cfg.Resources.Threads)); err != nil {
+		return fail("not started", err)
+	}
+	defer threadPool.Release(int64(cfg.Resources.Threads))
+	if err := memoryPool.Acquire(ctx, int64(cfg.Resources.Memory)); err != nil {
+		return fail("not started", err)
+	}
+	defer memoryPool.Release(int64(cfg.Resources.Memory))
+
+	run, err := buildSampleRun(row.sample, &cfg, baseDir)
+	if err != nil {
+		return fail("failed", err)
+	}
+	run.Pipeline.Label = row.Name
+	result.Assembly = run.FinalAssembly
+
+	start := time.Now()
+	err = run.Pipeline.Run(ctx)
+	result.Duration = time.Since(start)
+	if err == nil {
+		result.Status = "completed"
+		return result
+	}
+
+	result.Status = "failed"
+	if ctx.Err() != nil {
+		result.Status = "interrupted"
+	}
+	for _, r := range run.Pipeline.Results() {
+		if r.Status == pipeline.StatusFailed {
+			result.FailedStep = r.ID
+			break
+		}
+	}
+	result.Err = err
+	fmt.Printf("Sample %s failed: %v\n", row.Name, err)
+	return result
+}
+
+func writeBatchSummary(path string, results []batchResult) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create summary directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create batch summary: %w", err)
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, "sample\tsource\tstatus\tduration_s\tfailed_step\tassembly\terror")
+	for _, r := range results {
+		errText := ""
+		if r.Err != nil {
+			errText = strings.ReplaceAll(r.Err.Error(), "\t", " ")
+			errText = strings.ReplaceAll(errText, "\n", "; ")
+		}
+		assembly := ""
+		if r.Status == "completed" {
+			assembly = r.Assembly
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%.0f\t%s\t%s\t%s\n",
+			r.Sample, r.Source, r.Status, r.Duration.Seconds(), r.FailedStep, assembly, errText)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write batch summary: %w", err)
+	}
+	return f.Close()
+}
+
+func printBatchSummary(results []batchResult) {
+	fmt.Println()
+	fmt.Println("=== BATCH SUMMARY ===")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SAMPLE\tSTATUS\tDURATION\tFAILED STEP")
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", r.Sample, r.Status, r.Duration.Round(time.Second), r.FailedStep)
+	}
+	tw.Flush()
+	fmt.Println()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"bio-assembler/pkg/config"
+
+	"github.com/spf13/cobra"
+)
+
+var printDefaultsFormat string
+
+func init() {
+	configPrintDefaultsCmd.Flags().StringVarP(&printDefaultsFormat, "format", "f", "yaml", "Output format: yaml or toml")
+
+	configCmd.AddCommand(configValidateCmd)
+	configCmd.AddCommand(configPrintDefaultsCmd)
+	rootCmd.AddCommand(configCmd)
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect and validate pipeline configuration files",
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate <file>",
+	Short: "Check a configuration file for errors",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		cfg, err := config.Load(args[0])
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		if err := cfg.Validate(); err != nil {
+			fmt.Printf("%s is invalid:\n%v\n", args[0], err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid.\n", args[0])
+	},
+}
+
+var configPrintDefaultsCmd = &cobra.Command{
+	Use:   "print-defaults",
+	Short: "Print the default configuration as a starting point for a config file",
+	Run: func(cmd *cobra.Command, args []string) {
+		out, err := config.Default().Encode(printDefaultsFormat)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(out)
+	},
+}
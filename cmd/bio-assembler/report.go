@@ -2,96 +2,113 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"maps"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
+
+	"bio-assembler/pkg/pipeline"
+	"bio-assembler/pkg/report"
 
 	"github.com/spf13/cobra"
 )
 
+var (
+	reportSample   string
+	reportLang     string
+	reportLangFile string
+	reportFormats  []string
+	reportOutput   string
+)
+
 func init() {
+	reportCmd.Flags().StringVarP(&reportSample, "sample", "s", "", "Sample name or SRR ID of a completed run (directory under data/)")
+	reportCmd.Flags().StringVar(&reportLang, "lang", "en", "Report language: "+strings.Join(report.Languages(), ", "))
+	reportCmd.Flags().StringVar(&reportLangFile, "lang-file", "", "Custom language file (YAML) overriding some or all texts of --lang")
+	reportCmd.Flags().StringSliceVar(&reportFormats, "format", []string{"html", "md"}, "Report formats to write: html, md")
+	reportCmd.Flags().StringVarP(&reportOutput, "output", "o", "", "Output directory (default: data/<sample>/09_report)")
+	reportCmd.MarkFlagRequired("sample")
+
 	rootCmd.AddCommand(reportCmd)
 }
 
 var reportCmd = &cobra.Command{
 	Use:   "report",
-	Short: "Generate a report for a completed assembly",
+	Short: "Generate an HTML and Markdown report for a completed assembly",
 	Run: func(cmd *cobra.Command, args []string) {
-		if srrID == "" {
-			fmt.Println("SRR ID must be provided with -s flag.")
-			os.Exit(1)
+		for _, f := range reportFormats {
+			if f != "html" && f != "md" {
+				fmt.Printf("Unknown report format %q (expected html or md)\n", f)
+				os.Exit(1)
+			}
 		}
 
-		baseDir, _ := os.Getwd()
-		sampleDir := filepath.Join(baseDir, "data", srrID)
-
-		fmt.Printf("Generating report for sample %s\n\n", srrID)
-
-		fmt.Println("--- Step 1: Initial Quality Control (FastQC) ---")
-		fmt.Printf("FastQC reports are in: %s\n", filepath.Join(sampleDir, "01_fastqc_raw"))
-		fmt.Println("ACTION: Open the HTML reports, take screenshots of 'Per base sequence quality' graphs.")
-		fmt.Println("SUGGESTED TEXT: 'Исходные данные показали падение качества к концам прочтений, что характерно для технологии Illumina. Также возможно наличие адаптерных последовательностей.'")
-		prompt()
-
-		fmt.Println("--- Step 2: Post-Trimming Quality Control (FastQC) ---")
-		fmt.Printf("Trimmed FastQC reports are in: %s\n", filepath.Join(sampleDir, "03_fastqc_trimmed"))
-		fmt.Println("ACTION: Open the HTML reports for trimmed data, take screenshots of 'Per base sequence quality' graphs.")
-		fmt.Println("SUGGESTED TEXT: 'После очистки с помощью Trimmomatic... качество прочтений значительно улучшилось.'")
-		prompt()
-
-		fmt.Println("--- Step 3: Assembly Statistics (SPAdes) ---")
-		contigsFile := filepath.Join(sampleDir, "04_spades_assembly", "contigs.fasta")
-		count, _ := countFastaContigs(contigsFile)
-		fmt.Printf("SPAdes assembled %d contigs.\n", count)
-		fmt.Printf("SUGGESTED TEXT: 'Сборка de novo проводилась с помощью ассемблера SPAdes. В результате был получен черновой геном, состоящий из %d контигов.'\n", count)
-		prompt()
+		var (
+			lang *report.Language
+			err  error
+		)
+		if reportLangFile != "" {
+			lang, err = report.LoadLanguageFile(reportLangFile, reportLang)
+		} else {
+			lang, err = report.LoadLanguage(reportLang)
+		}
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 
-		fmt.Println("--- Step 4: Polishing Statistics (Pilon) ---")
-		pilonContigsFile := filepath.Join(sampleDir, "05_pilon_correction", "round1", "pilon_r1.fasta")
-		pilonChangesFile := filepath.Join(sampleDir, "05_pilon_correction", "round1", "pilon_r1.changes")
-		pilonCount, _ := countFastaContigs(pilonContigsFile)
-		pilonChanges, _ := countLines(pilonChangesFile)
-		fmt.Printf("Pilon polishing resulted in %d contigs.\n", pilonCount)
-		fmt.Printf("Pilon made %d changes.\n", pilonChanges)
-		fmt.Printf("SUGGESTED TEXT: 'Черновая сборка была отфильтрована... Затем с помощью Pilon было исправлено %d ошибок...'\n", pilonChanges)
-		prompt()
+		baseDir, err := os.Getwd()
+		if err != nil {
+			fmt.Printf("Failed to get current working directory: %v\n", err)
+			os.Exit(1)
+		}
+		layout := pipeline.NewLayout(filepath.Join(baseDir, "data", reportSample))
+		if _, err := os.Stat(layout.Dir); err != nil {
+			fmt.Printf("No results for sample %s: %v\n", reportSample, err)
+			os.Exit(1)
+		}
+		outDir := reportOutput
+		if outDir == "" {
+			outDir = layout.Report
+		}
 
-		fmt.Println("--- Step 5: Final Quality Assessment (Qualimap) ---")
-		qualimapReport := filepath.Join(sampleDir, "08_qualimap_report", "qualimap_report.html")
-		fmt.Println("ACTION: Open the Qualimap report:", qualimapReport)
-		fmt.Println("ACTION: Get N50 value from the prinseq output during the run.")
-		fmt.Println("ACTION: Take screenshots of 'Summary' (for mean coverage) and 'Coverage across reference' graphs.")
-		fmt.Println("SUGGESTED TEXT: 'Финальная сборка генома... имеет общую длину Z Mb, состоит из X контигов с N50 равным W bp... Среднее покрытие составило V-x...'")
-		prompt()
+		fmt.Printf("Generating report for sample %s\n", reportSample)
+		data := report.Collect(reportSample, layout)
+		for _, section := range slices.Sorted(maps.Keys(data.Missing)) {
+			fmt.Printf("Note: no results for %s (expected in %s)\n", section, data.Missing[section])
+		}
 
-		fmt.Println("Report generation guide finished.")
+		if err := os.MkdirAll(outDir, 0755); err != nil {
+			fmt.Printf("Failed to create report directory: %v\n", err)
+			os.Exit(1)
+		}
+		writers := map[string]func(io.Writer, *report.Data, *report.Language) error{
+			"html": report.WriteHTML,
+			"md":   report.WriteMarkdown,
+		}
+		for _, format := range reportFormats {
+			path := filepath.Join(outDir, "report."+format)
+			if err := writeReport(path, data, lang, writers[format]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			fmt.Printf("Report written to %s\n", path)
+		}
 	},
 }
 
-func prompt() {
-	fmt.Print("Press [Enter] to continue...")
-	fmt.Scanln()
-	fmt.Println()
-}
+func writeReport(path string, data *report.Data, lang *report.Language,
+	write func(io.Writer, *report.Data, *report.Language) error) error {
 
-func countFastaContigs(filePath string) (int, error) {
-	cmd := exec.Command("grep", "-c", ">", filePath)
-	output, err := cmd.Output()
+	f, err := os.Create(path)
 	if err != nil {
-		return 0, err
+		return fmt.Errorf("failed to create %s: %w", path, err)
 	}
-	var count int
-	fmt.Sscanf(string(output), "%d", &count)
-	return count, nil
-}
-
-func countLines(filePath string) (int, error) {
-	cmd := exec.Command("wc", "-l", filePath)
-	output, err := cmd.Output()
-	if err != nil {
-		return 0, err
+	defer f.Close()
+	if err := write(f, data, lang); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
 	}
-	var count int
-	fmt.Sscanf(string(output), "%d", &count)
-	return count, nil
+	return f.Close()
 }
@@ -1,42 +1,89 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
 
+	"bio-assembler/pkg/config"
 	"bio-assembler/pkg/pipeline"
 
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/errgroup"
 )
 
 var (
+	configPath       string
 	srrID            string
+	samplesPath      string
+	reads1           []string
+	reads2           []string
+	longReads        []string
+	longReadType     string
+	sampleName       string
+	copyReads        bool
+	totalThreads     int
+	totalMemory      int
 	threads          int
 	memory           int
 	pilonJarPath     string
 	adapterFastaPath string
 	noParallel       bool
+	maxParallel      int
+	forceSteps       []string
+	fromStep         string
 	filterMode       string
 	filterCustomArgs string
+	fetcherName      string
+	trimmerName      string
+	assemblerName    string
+	polisherNames    []string
+	alignerName      string
+	skipQualimap     bool
 )
 
 func init() {
-	runCmd.Flags().StringVarP(&srrID, "srr", "s", "", "SRR ID of the sample to process (required)")
-	runCmd.Flags().IntVarP(&threads, "threads", "t", 4, "Number of threads to use")
-	runCmd.Flags().IntVarP(&memory, "memory", "m", 16, "Memory in GB to use")
-	runCmd.Flags().StringVar(&pilonJarPath, "pilon-jar", "", "Path to the pilon.jar file (required)")
-	runCmd.Flags().StringVar(&adapterFastaPath, "adapter-fasta", "", "Path to the adapter FASTA file for Trimmomatic (required)")
+	defaults := config.Default()
+
+	runCmd.Flags().StringVarP(&configPath, "config", "c", "", "Pipeline configuration file (YAML or TOML); flags override its values")
+	runCmd.Flags().StringVarP(&srrID, "srr", "s", "", "SRR ID of the sample to process")
+	runCmd.Flags().StringVar(&samplesPath, "samples", "", "Sample sheet (TSV) to process several samples in one batch")
+	runCmd.Flags().StringSliceVar(&reads1, "reads1", nil, "Local read 1 FASTQ file(s), gzipped or plain; several files are concatenated as lanes")
+	runCmd.Flags().StringSliceVar(&reads2, "reads2", nil, "Local read 2 FASTQ file(s), one per --reads1 lane; omit for single-end libraries")
+	runCmd.Flags().StringSliceVar(&longReads, "long-reads", nil, "Local long read FASTQ file(s) (Nanopore or PacBio) for a hybrid or long-read assembly")
+	runCmd.Flags().StringVar(&longReadType, "long-read-type", defaults.Steps.LongReads.Type, "Long read technology: nanopore, nanopore-hq, pacbio or pacbio-hifi")
+	runCmd.Flags().StringVar(&sampleName, "sample-name", "", "Sample name for local reads (output goes to data/<sample-name>)")
+	runCmd.Flags().BoolVar(&copyReads, "copy-reads", false, "Copy local reads into raw_data instead of symlinking them")
+	runCmd.Flags().IntVar(&totalThreads, "total-threads", 0, "Batch mode: threads shared by all concurrently running samples (default: --threads)")
+	runCmd.Flags().IntVar(&totalMemory, "total-memory", 0, "Batch mode: memory in GB shared by all concurrently running samples (default: --memory)")
+	runCmd.Flags().StringVar(&fetcherName, "fetcher", defaults.Steps.Download.Fetcher, "How SRA runs are downloaded: sra-tools (prefetch + fasterq-dump) or ena (direct download from ENA)")
+	runCmd.Flags().IntVarP(&threads, "threads", "t", defaults.Resources.Threads, "Number of threads to use")
+	runCmd.Flags().IntVarP(&memory, "memory", "m", defaults.Resources.Memory, "Memory in GB to use")
+	runCmd.Flags().StringVar(&pilonJarPath, "pilon-jar", "", "Path to the pilon.jar file (required when polishing with Pilon, unless set in the config)")
+	runCmd.Flags().StringVar(&adapterFastaPath, "adapter-fasta", "", "Path to the adapter FASTA file for trimming (default: detected from the raw reads)")
 	runCmd.Flags().BoolVar(&noParallel, "no-parallel", false, "Disable parallel execution where possible")
-	runCmd.Flags().StringVar(&filterMode, "filter-mode", "standard", "Read filtering mode for Trimmomatic: standard, strict, lenient, or custom")
-	runCmd.Flags().StringVar(&filterCustomArgs, "filter-custom-args", "", "Custom Trimmomatic filtering arguments (used only when --filter-mode=custom)")
+	runCmd.Flags().IntVar(&maxParallel, "max-parallel", defaults.Resources.MaxParallel, "Maximum number of independent steps to run at the same time")
+	runCmd.Flags().StringSliceVar(&forceSteps, "force-step", nil, "Re-run the given step even if its cached outputs are up to date (repeatable)")
+	runCmd.Flags().StringVar(&fromStep, "from", "", "Re-run the given step and every step downstream of it")
+	runCmd.Flags().StringVar(&trimmerName, "trimmer", defaults.Steps.Trim.Trimmer, "Read trimmer: trimmomatic, fastp or native")
+	runCmd.Flags().StringVar(&assemblerName, "assembler", defaults.Steps.Assemble.Assembler, "De novo assembler: spades, megahit, skesa, unicycler or flye")
+	runCmd.Flags().StringVar(&alignerName, "aligner", defaults.Steps.MapReads.Aligner, "Short-read aligner for polishing and Qualimap: bwa, bwa-mem2, minimap2 or bowtie2")
+	runCmd.Flags().StringSliceVar(&polisherNames, "polishers", defaults.Steps.Polish.Polishers, "Short-read polishers to run in order: pilon, polypolish and/or polca")
+	runCmd.Flags().BoolVar(&skipQualimap, "skip-qualimap", false, "Skip Qualimap and rely on the built-in coverage statistics")
+	runCmd.Flags().StringVar(&filterMode, "filter-mode", defaults.Steps.Trim.Mode, "Read filtering mode: standard, strict, lenient, or custom")
+	runCmd.Flags().StringVar(&filterCustomArgs, "filter-custom-args", "", "Custom trimmer filtering arguments (used only when --filter-mode=custom)")
 
-	runCmd.MarkFlagRequired("srr")
-	runCmd.MarkFlagRequired("pilon-jar")
-	runCmd.MarkFlagRequired("adapter-fasta")
+	runCmd.MarkFlagsOneRequired("srr", "samples", "reads1")
+	runCmd.MarkFlagsMutuallyExclusive("srr", "samples", "reads1")
+	// Batch samples run their steps one at a time.
+	runCmd.MarkFlagsMutuallyExclusive("samples", "max-parallel")
+	runCmd.MarkFlagsRequiredTogether("reads1", "sample-name")
 
 	rootCmd.AddCommand(runCmd)
 }
@@ -45,151 +92,593 @@ var runCmd = &cobra.Command{
 	Use:   "run",
 	Short: "Run the full genome assembly pipeline",
 	Run: func(cmd *cobra.Command, args []string) {
-		if srrID == "" {
-			log.Fatal("SRR ID must be provided.")
+		cfg, err := loadRunConfig(cmd)
+		if err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
 		}
 
 		baseDir, err := os.Getwd()
 		if err != nil {
 			log.Fatalf("Failed to get current working directory: %v", err)
 		}
-		sampleDir := filepath.Join(baseDir, "data", srrID)
-		rawDir := filepath.Join(sampleDir, "raw_data")
-		fastqcRawDir := filepath.Join(sampleDir, "01_fastqc_raw")
-		trimmedDir := filepath.Join(sampleDir, "02_trimmed_reads")
-		fastqcTrimmedDir := filepath.Join(sampleDir, "03_fastqc_trimmed")
-		spadesDir := filepath.Join(sampleDir, "04_spades_assembly")
-		pilonDir := filepath.Join(sampleDir, "05_pilon_correction", "round1")
-		qualimapDir := filepath.Join(sampleDir, "08_qualimap_report")
-
-		rawFq1 := filepath.Join(rawDir, srrID+"_1.fastq.gz")
-		rawFq2 := filepath.Join(rawDir, srrID+"_2.fastq.gz")
-		trimmedPaired1 := filepath.Join(trimmedDir, "trimmed_paired_1.fastq.gz")
-		trimmedPaired2 := filepath.Join(trimmedDir, "trimmed_paired_2.fastq.gz")
-		trimmedUnpaired1 := filepath.Join(trimmedDir, "trimmed_unpaired_1.fastq.gz")
-		trimmedUnpaired2 := filepath.Join(trimmedDir, "trimmed_unpaired_2.fastq.gz")
-		spadesContigs := filepath.Join(spadesDir, "contigs.fasta")
-		pilonContigs := filepath.Join(pilonDir, "pilon_r1.fasta")
-		bamFile := filepath.Join(pilonDir, "mapped_reads.sorted.bam")
-
-		// Construct step instances
-		download := &pipeline.DownloadStep{
-			SrrID:   srrID,
-			Output:  rawDir,
-			Threads: threads,
-		}
-		fastqcRaw := &pipeline.FastQCStep{
-			InputFq1: rawFq1,
-			InputFq2: rawFq2,
-			Output:   fastqcRawDir,
-			Threads:  threads,
-		}
-		trim := &pipeline.TrimmomaticStep{
-			InputFq1:         rawFq1,
-			InputFq2:         rawFq2,
-			PairedOutput1:    trimmedPaired1,
-			PairedOutput2:    trimmedPaired2,
-			UnpairedOutput1:  trimmedUnpaired1,
-			UnpairedOutput2:  trimmedUnpaired2,
-			Threads:          threads,
-			AdapterFastaPath: adapterFastaPath,
-		Mode:             filterMode,
-		CustomArgs:       filterCustomArgs,
-		}
-		fastqcTrim := &pipeline.TrimmedFastQCStep{
-			InputFq1: trimmedPaired1,
-			InputFq2: trimmedPaired2,
-			Output:   fastqcTrimmedDir,
-			Threads:  threads,
-		}
-		spades := &pipeline.SpadesStep{
-			InputFq1: trimmedPaired1,
-			InputFq2: trimmedPaired2,
-			Output:   spadesDir,
-			Threads:  threads,
-			Memory:   memory,
-		}
-		pilon := &pipeline.PilonStep{
-			ContigsIn:      spadesContigs,
-			TrimmedPaired1: trimmedPaired1,
-			TrimmedPaired2: trimmedPaired2,
-			PilonDir:       pilonDir,
-			Threads:        threads,
-			Memory:         memory,
-			PilonJarPath:   pilonJarPath,
-		}
-		qualimap := &pipeline.QualimapStep{
-			BamFile:   bamFile,
-			OutputDir: qualimapDir,
-			Memory:    memory,
-		}
-
-		// Phase 1: Download (sequential)
-		fmt.Println("=== RUNNING STEP: ", download.Name(), "===")
-		if err := download.Run(); err != nil {
-			log.Fatalf("Pipeline failed: %v", err)
-		}
-		fmt.Println("=== COMPLETED STEP: ", download.Name(), "===\n")
 
-		// Phase 2: FastQC Raw and Trimmomatic in parallel (or sequential if disabled)
-		if noParallel {
-			fmt.Println("=== RUNNING STEP: ", fastqcRaw.Name(), "===")
-			if err := fastqcRaw.Run(); err != nil {
-				log.Fatalf("Pipeline failed: %v", err)
-			}
-			fmt.Println("=== COMPLETED STEP: ", fastqcRaw.Name(), "===\n")
+		ctx, cancel := signalContext()
+		defer cancel()
 
-			fmt.Println("=== RUNNING STEP: ", trim.Name(), "===")
-			if err := trim.Run(); err != nil {
-				log.Fatalf("Pipeline failed: %v", err)
-			}
-			fmt.Println("=== COMPLETED STEP: ", trim.Name(), "===\n")
-		} else {
-			fmt.Println("=== RUNNING IN PARALLEL: ", fastqcRaw.Name(), " & ", trim.Name(), "===")
-			g, _ := errgroup.WithContext(context.Background())
-			g.Go(func() error { return fastqcRaw.Run() })
-			g.Go(func() error { return trim.Run() })
-			if err := g.Wait(); err != nil {
-				log.Fatalf("Pipeline failed: %v", err)
+		if samplesPath != "" {
+			if err := runBatch(ctx, cmd, cfg, baseDir); err != nil {
+				log.Fatalf("Batch failed: %v", err)
 			}
-			fmt.Println("=== COMPLETED PARALLEL GROUP ===\n")
+			return
 		}
 
-		// Phase 3: FastQC Trimmed then SPAdes (sequential to avoid concurrent reads of the same files)
-		fmt.Println("=== RUNNING STEP: ", fastqcTrim.Name(), "===")
-		if err := fastqcTrim.Run(); err != nil {
-			log.Fatalf("Pipeline failed: %v", err)
+		if err := requireRunSettings(cfg); err != nil {
+			log.Fatalf("Invalid configuration: %v", err)
 		}
-		fmt.Println("=== COMPLETED STEP: ", fastqcTrim.Name(), "===")
-		fmt.Println()
-
-		fmt.Println("=== RUNNING STEP: ", spades.Name(), "===")
-		if err := spades.Run(); err != nil {
-			log.Fatalf("Pipeline failed: %v", err)
+		smp := sample{Name: srrID, SrrID: srrID, LongReads: longReads}
+		if len(reads1) > 0 {
+			smp = sample{Name: sampleName, Reads1: reads1, Reads2: reads2, LongReads: longReads}
+			if err := smp.validate(); err != nil {
+				log.Fatalf("Invalid local reads: %v", err)
+			}
 		}
-		fmt.Println("=== COMPLETED STEP: ", spades.Name(), "===")
-		fmt.Println()
-
-		// Phase 4: Pilon (sequential)
-		fmt.Println("=== RUNNING STEP: ", pilon.Name(), "===")
-		if err := pilon.Run(); err != nil {
-			log.Fatalf("Pipeline failed: %v", err)
+		run, err := buildSampleRun(smp, cfg, baseDir)
+		if err != nil {
+			log.Fatalf("Failed to set up pipeline: %v", err)
 		}
-		fmt.Println("=== COMPLETED STEP: ", pilon.Name(), "===")
-		fmt.Println()
 
-		// Phase 5: Qualimap (sequential)
-		fmt.Println("=== RUNNING STEP: ", qualimap.Name(), "===")
-		if err := qualimap.Run(); err != nil {
+		if err := run.Pipeline.Run(ctx); err != nil {
+			printStepSummary(run.Pipeline.Results())
 			log.Fatalf("Pipeline failed: %v", err)
 		}
-		fmt.Println("=== COMPLETED STEP: ", qualimap.Name(), "===")
-		fmt.Println()
 
 		fmt.Println("=======================================================================")
-		fmt.Printf("Genome assembly %s complete!\n", srrID)
-		fmt.Printf("Final report path: %s\n", pilonContigs)
-		fmt.Printf("Qualimap report: %s/qualimap_report.html\n", qualimapDir)
+		fmt.Printf("Genome assembly %s complete!\n", smp.Name)
+		fmt.Printf("Final report path: %s\n", run.FinalAssembly)
+		fmt.Printf("Coverage statistics: %s\n", run.CoverageStats)
+		if run.QualimapDir != "" {
+			fmt.Printf("Qualimap report: %s/qualimap_report.html\n", run.QualimapDir)
+		}
 		fmt.Println("=======================================================================")
 	},
 }
+
+// sample identifies the reads a pipeline run starts from: either an SRA
+// accession to download or local FASTQ files. Reads1 and Reads2 hold one
+// file per lane; Reads2 is empty for single-end libraries. LongReads are
+// optional local long read files, one per run.
+type sample struct {
+	Name      string
+	SrrID     string
+	Reads1    []string
+	Reads2    []string
+	LongReads []string
+}
+
+func (s sample) singleEnd() bool {
+	return s.SrrID == "" && len(s.Reads2) == 0
+}
+
+// validate checks that a sample's name and reads can be laid out on disk.
+func (s sample) validate() error {
+	switch {
+	case s.Name == "":
+		return fmt.Errorf("sample name is required")
+	case strings.ContainsAny(s.Name, `/\`) || s.Name == "." || s.Name == "..":
+		return fmt.Errorf("sample name %q cannot be used as a directory name", s.Name)
+	case s.SrrID != "" && (len(s.Reads1) > 0 || len(s.Reads2) > 0):
+		return fmt.Errorf("sample %s has both an SRR ID and local reads", s.Name)
+	case s.SrrID == "" && len(s.Reads1) == 0:
+		return fmt.Errorf("sample %s needs either an SRR ID or local reads", s.Name)
+	case len(s.Reads2) > 0 && len(s.Reads1) != len(s.Reads2):
+		return fmt.Errorf("sample %s has %d read 1 file(s) but %d read 2 file(s)", s.Name, len(s.Reads1), len(s.Reads2))
+	}
+	return nil
+}
+
+// sampleRun is the pipeline built for one sample together with the paths
+// of its key outputs.
+type sampleRun struct {
+	Sample        sample
+	Dir           string
+	Pipeline      *pipeline.Pipeline
+	FinalAssembly string
+	CoverageStats string
+	// QualimapDir is empty when Qualimap is skipped.
+	QualimapDir string
+}
+
+// buildSampleRun lays out the directories of a sample under baseDir/data
+// and assembles its step graph from the configuration.
+func buildSampleRun(smp sample, cfg *config.Config, baseDir string) (*sampleRun, error) {
+	res := cfg.Resources
+	tools := pipeline.Tools(cfg.Tools.Paths)
+
+	sampleDir := filepath.Join(baseDir, "data", smp.Name)
+	layout := pipeline.NewLayout(sampleDir)
+	rawDir := layout.Raw
+	fastqcRawDir := layout.FastQCRaw
+	trimmedDir := layout.Trimmed
+	fastqcTrimmedDir := layout.FastQCTrimmed
+	assemblyDir := layout.Assembly
+	qualimapDir := layout.Qualimap
+	hasLongReads := len(smp.LongReads) > 0
+
+	// Staging directories only survive when a previous run was killed
+	// before it could clean up; their contents are never trusted.
+	leftovers, err := pipeline.CleanStaging(sampleDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean up staging directories: %w", err)
+	}
+	for _, dir := range leftovers {
+		fmt.Printf("Removed leftover staging directory from an interrupted run: %s\n", dir)
+	}
+
+	// Single-end libraries have no second read file; the steps below take
+	// an empty path for it.
+	rawFq1, rawFq2 := pipeline.LocalReadsOutputs(rawDir, smp.Name, smp.singleEnd())
+	trimmedPaired1 := filepath.Join(trimmedDir, "trimmed_paired_1.fastq.gz")
+	trimmedPaired2 := filepath.Join(trimmedDir, "trimmed_paired_2.fastq.gz")
+	if smp.singleEnd() {
+		trimmedPaired1 = filepath.Join(trimmedDir, "trimmed_single.fastq.gz")
+		trimmedPaired2 = ""
+	}
+	trimmedUnpaired1 := filepath.Join(trimmedDir, "trimmed_unpaired_1.fastq.gz")
+	trimmedUnpaired2 := filepath.Join(trimmedDir, "trimmed_unpaired_2.fastq.gz")
+	contigs := layout.Contigs()
+	polishedContigs := layout.PolishedContigs()
+
+	// Construct step instances
+	var fetch pipeline.Step
+	if smp.SrrID != "" {
+		dl := cfg.Steps.Download
+		fetcher, err := pipeline.NewFetcher(dl.Fetcher, pipeline.FetcherOptions{
+			Tools:     tools,
+			ExtraArgs: dl.ExtraArgs,
+			ENA: pipeline.ENAFetcher{
+				PortalURL: dl.ENA.PortalURL,
+				Protocol:  dl.ENA.Protocol,
+				Retries:   dl.ENA.Retries,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		fetch = &pipeline.DownloadStep{
+			SrrID:   smp.SrrID,
+			Output:  rawDir,
+			Threads: res.Threads,
+			Fetcher: fetcher,
+		}
+	} else {
+		fetch = &pipeline.LocalReadsStep{
+			Reads1: smp.Reads1,
+			Reads2: smp.Reads2,
+			Sample: smp.Name,
+			Output: rawDir,
+			Copy:   copyReads,
+		}
+	}
+	fastqcRaw := &pipeline.FastQCStep{
+		InputFq1:  rawFq1,
+		InputFq2:  rawFq2,
+		Output:    fastqcRawDir,
+		Threads:   res.Threads,
+		Tools:     tools,
+		ExtraArgs: cfg.Steps.FastQC.ExtraArgs,
+		Gate:      config.Gate(cfg.Steps.FastQC.RawGate),
+	}
+	validate := &pipeline.ValidateReadsStep{
+		InputFq1: rawFq1,
+		InputFq2: rawFq2,
+		Output:   layout.Validation,
+	}
+	trimmer, err := pipeline.NewTrimmer(cfg.Steps.Trim.Trimmer, tools)
+	if err != nil {
+		return nil, err
+	}
+	// Without a configured adapter file the adapters are detected from the
+	// raw reads and trimming uses the chosen bundled file, unless the
+	// trimmer detects them itself.
+	var detect *pipeline.DetectAdaptersStep
+	adapterFasta := cfg.Steps.Trim.AdapterFasta
+	if adapterFasta == "" && !trimmer.DetectsAdapters() {
+		detect = &pipeline.DetectAdaptersStep{
+			InputFq1:    rawFq1,
+			InputFq2:    rawFq2,
+			Output:      layout.Adapters,
+			SampleReads: cfg.Steps.Trim.AdapterSampleReads,
+			MinPercent:  cfg.Steps.Trim.AdapterMinPercent,
+		}
+		adapterFasta = layout.AdapterFasta()
+	}
+	trim := &pipeline.TrimStep{
+		InputFq1:          rawFq1,
+		InputFq2:          rawFq2,
+		PairedOutput1:     trimmedPaired1,
+		PairedOutput2:     trimmedPaired2,
+		UnpairedOutput1:   trimmedUnpaired1,
+		UnpairedOutput2:   trimmedUnpaired2,
+		Threads:           res.Threads,
+		AdapterFastaPath:  adapterFasta,
+		ReadStatsPath:     layout.ReadStats(),
+		Mode:              cfg.Steps.Trim.Mode,
+		CustomArgs:        cfg.Steps.Trim.CustomArgs,
+		Trimmer:           trimmer,
+		ExtraArgs:         cfg.Steps.Trim.ExtraArgs,
+		MinSurvival:       cfg.Steps.Trim.MinSurvival,
+		FailOnLowSurvival: cfg.Steps.Trim.OnLowSurvival == "fail",
+	}
+	fastqcTrim := &pipeline.TrimmedFastQCStep{
+		InputFq1:  trimmedPaired1,
+		InputFq2:  trimmedPaired2,
+		Output:    fastqcTrimmedDir,
+		Threads:   res.Threads,
+		Tools:     tools,
+		ExtraArgs: cfg.Steps.FastQC.ExtraArgs,
+		Gate:      config.Gate(cfg.Steps.FastQC.TrimmedGate),
+	}
+	assembler, err := pipeline.NewAssembler(cfg.Steps.Assemble.Assembler, pipeline.AssemblerOptions{
+		Tools: tools,
+		Spades: pipeline.SpadesAssembler{
+			Mode:          cfg.Steps.Spades.Mode,
+			OnlyAssembler: cfg.Steps.Spades.OnlyAssembler,
+			Kmers:         cfg.Steps.Spades.Kmers,
+			ExtraArgs:     cfg.Steps.Spades.ExtraArgs,
+		},
+		Megahit: pipeline.MegahitAssembler{
+			Kmers:     cfg.Steps.Megahit.Kmers,
+			ExtraArgs: cfg.Steps.Megahit.ExtraArgs,
+		},
+		Skesa: pipeline.SkesaAssembler{ExtraArgs: cfg.Steps.Skesa.ExtraArgs},
+		Unicycler: pipeline.UnicyclerAssembler{
+			Mode:      cfg.Steps.Unicycler.Mode,
+			ExtraArgs: cfg.Steps.Unicycler.ExtraArgs,
+		},
+		Flye: pipeline.FlyeAssembler{
+			GenomeSize: cfg.Steps.Flye.GenomeSize,
+			ExtraArgs:  cfg.Steps.Flye.ExtraArgs,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	longReadsUse := assembler.LongReads()
+	switch {
+	case hasLongReads && longReadsUse == pipeline.LongReadsUnsupported:
+		return nil, fmt.Errorf("%s cannot use long reads; choose spades, unicycler or flye for sample %s", assembler.Name(), smp.Name)
+	case !hasLongReads && longReadsUse == pipeline.LongReadsOnly:
+		return nil, fmt.Errorf("%s needs long reads, but sample %s has none", assembler.Name(), smp.Name)
+	}
+	assemble := &pipeline.AssembleStep{
+		InputFq1:  trimmedPaired1,
+		InputFq2:  trimmedPaired2,
+		Output:    assemblyDir,
+		Threads:   res.Threads,
+		Memory:    res.Memory,
+		Assembler: assembler,
+	}
+	if longReadsUse == pipeline.LongReadsOnly {
+		assemble.InputFq1, assemble.InputFq2 = "", ""
+	}
+
+	filter := cfg.Steps.FilterContigs
+	filterContigs := &pipeline.FilterContigsStep{
+		Input:       contigs,
+		Output:      layout.ContigFilter,
+		MinLength:   filter.MinLength,
+		MinCoverage: filter.MinCoverage,
+	}
+	if filter.Rename {
+		filterContigs.Prefix = cmp.Or(filter.Prefix, smp.Name)
+	}
+
+	// Long reads are imported and filtered on their own branch. They join
+	// the short reads at assembly and polish the draft before the short reads do.
+	var importLong, filterLong, polishLong pipeline.Step
+	polishInput := layout.FilteredContigs()
+	if hasLongReads {
+		long := cfg.Steps.LongReads
+		importLong = &pipeline.ImportLongReadsStep{
+			Reads:  smp.LongReads,
+			Sample: smp.Name,
+			Output: layout.LongReads,
+			Copy:   copyReads,
+		}
+		filterLong = &pipeline.FilterLongReadsStep{
+			Input:          pipeline.LongReadsOutput(layout.LongReads, smp.Name),
+			Output:         layout.LongFiltered,
+			Type:           long.Type,
+			MinLength:      long.MinLength,
+			MinMeanQuality: long.MinMeanQuality,
+			TargetBases:    long.TargetBases,
+		}
+		assemble.LongReads = layout.FilteredLongReads()
+		assemble.LongReadType = long.Type
+
+		longPolish := cfg.Steps.LongPolish
+		if polisher := pipeline.LongPolisherFor(longPolish.Polisher, long.Type); polisher != "none" {
+			polishLong = &pipeline.LongPolishStep{
+				ContigsIn:   layout.FilteredContigs(),
+				LongReads:   layout.FilteredLongReads(),
+				ReadType:    long.Type,
+				Output:      layout.LongPolish,
+				Threads:     res.Threads,
+				Tools:       tools,
+				Polisher:    polisher,
+				Rounds:      longPolish.Rounds,
+				MedakaModel: longPolish.MedakaModel,
+				ExtraArgs:   longPolish.ExtraArgs,
+			}
+			polishInput = layout.LongPolishedContigs()
+		}
+	}
+	aligner, err := pipeline.NewAligner(cfg.Steps.MapReads.Aligner, pipeline.AlignerOptions{
+		Tools:     tools,
+		ExtraArgs: cfg.Steps.MapReads.ExtraArgs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	mapper := pipeline.ReadMapper{
+		Aligner:        aligner,
+		Tools:          tools,
+		Threads:        res.Threads,
+		MarkDuplicates: cfg.Steps.MapReads.MarkDuplicates,
+	}
+	mapReads := &pipeline.MapReadsStep{
+		Reference: polishInput,
+		Target:    "draft assembly",
+		Reads1:    trimmedPaired1,
+		Reads2:    trimmedPaired2,
+		Output:    layout.Mapping,
+		Mapper:    mapper,
+	}
+	polishOpts := pipeline.PolisherOptions{
+		Tools: tools,
+		Pilon: pipeline.PilonPolisher{
+			JarPath:   cfg.Tools.PilonJar,
+			Fix:       cfg.Steps.Pilon.Fix,
+			ExtraArgs: cfg.Steps.Pilon.ExtraArgs,
+		},
+		Polypolish: pipeline.PolypolishPolisher{
+			Careful:   cfg.Steps.Polypolish.Careful,
+			ExtraArgs: cfg.Steps.Polypolish.ExtraArgs,
+		},
+		Polca: pipeline.PolcaPolisher{ExtraArgs: cfg.Steps.Polca.ExtraArgs},
+	}
+	var polishStages []pipeline.PolishStage
+	for _, name := range cfg.Steps.Polish.Polishers {
+		polisher, err := pipeline.NewPolisher(name, polishOpts)
+		if err != nil {
+			return nil, err
+		}
+		stage := pipeline.PolishStage{Polisher: polisher}
+		switch name {
+		case "pilon":
+			stage.Rounds, stage.ConvergeAt = cfg.Steps.Pilon.Rounds, cfg.Steps.Pilon.ConvergeAt
+		case "polypolish":
+			stage.Rounds, stage.ConvergeAt = cfg.Steps.Polypolish.Rounds, cfg.Steps.Polypolish.ConvergeAt
+		case "polca":
+			stage.Rounds, stage.ConvergeAt = cfg.Steps.Polca.Rounds, cfg.Steps.Polca.ConvergeAt
+		}
+		polishStages = append(polishStages, stage)
+	}
+	// Only Pilon polishes from the alignment of the reads to the draft;
+	// the other polishers map the reads themselves. The alignment is only
+	// of use when Pilon polishes the draft itself, in the first round.
+	usesDraftMapping := cfg.Steps.Polish.Polishers[0] == "pilon"
+	polish := &pipeline.PolishStep{
+		ContigsIn: polishInput,
+		Reads1:    trimmedPaired1,
+		Reads2:    trimmedPaired2,
+		Mapper:    mapper,
+		Output:    layout.Polish,
+		Threads:   res.Threads,
+		Memory:    res.Memory,
+		Tools:     tools,
+		Stages:    polishStages,
+	}
+	if usesDraftMapping {
+		polish.Bam = mapReads.Bam()
+	}
+	// The quality assessment describes the final genome, so all trimmed
+	// reads, including those that lost their mate, are mapped to it.
+	mapFinal := &pipeline.MapReadsStep{
+		Reference: polishedContigs,
+		Target:    "polished assembly",
+		Reads1:    trimmedPaired1,
+		Reads2:    trimmedPaired2,
+		Output:    layout.FinalMapping,
+		Mapper:    mapper,
+	}
+	if !smp.singleEnd() {
+		mapFinal.Unpaired = []string{trimmedUnpaired1, trimmedUnpaired2}
+	}
+	coverageStats := &pipeline.CoverageStatsStep{
+		BamFile: mapFinal.Bam(),
+		Output:  layout.Coverage,
+		Tools:   tools,
+	}
+	qualimap := &pipeline.QualimapStep{
+		BamFile:   mapFinal.Bam(),
+		OutputDir: qualimapDir,
+		Memory:    res.Memory,
+		Tools:     tools,
+		ExtraArgs: cfg.Steps.Qualimap.ExtraArgs,
+	}
+
+	// Assemble the dependency graph. Raw FastQC only needs the downloaded
+	// reads, so it runs alongside trimming and everything downstream of it.
+	// Trimming waits for read validation, which gives the quality encoding.
+	// Assembly waits for FastQC on the trimmed reads rather than compete
+	// with it for threads and memory, and so also runs only after its
+	// quality gate has passed. Assemblers of long reads alone do not wait
+	// for the short reads at all.
+	p := pipeline.NewPipeline(res.MaxParallel)
+	p.Add("download", fetch)
+	p.Add("validate-reads", validate, "download")
+	p.Add("fastqc-raw", fastqcRaw, "download")
+	if detect != nil {
+		p.Add("detect-adapters", detect, "download")
+		p.Add("trim", trim, "validate-reads", "detect-adapters")
+	} else {
+		p.Add("trim", trim, "validate-reads")
+	}
+	p.Add("fastqc-trimmed", fastqcTrim, "trim")
+	assembleDeps := []string{"fastqc-trimmed"}
+	polishDeps := []string{"filter-contigs", "trim"}
+	if hasLongReads {
+		p.Add("import-long-reads", importLong)
+		p.Add("filter-long-reads", filterLong, "import-long-reads")
+		assembleDeps = append(assembleDeps, "filter-long-reads")
+		if longReadsUse == pipeline.LongReadsOnly {
+			assembleDeps = []string{"filter-long-reads"}
+		}
+		if polishLong != nil {
+			p.Add("polish-long", polishLong, "filter-contigs", "filter-long-reads")
+			polishDeps = []string{"polish-long", "trim"}
+		}
+	}
+	p.Add("assemble", assemble, assembleDeps...)
+	p.Add("filter-contigs", filterContigs, "assemble")
+	if usesDraftMapping {
+		p.Add("map-reads", mapReads, polishDeps...)
+		polishDeps = append(polishDeps, "map-reads")
+	}
+	p.Add("polish", polish, polishDeps...)
+	p.Add("map-final", mapFinal, "polish", "trim")
+	p.Add("coverage-stats", coverageStats, "map-final")
+	if cfg.Steps.Qualimap.Skip {
+		qualimapDir = ""
+	} else {
+		p.Add("qualimap", qualimap, "map-final")
+	}
+
+	if err := p.Force(forceSteps...); err != nil {
+		return nil, fmt.Errorf("invalid --force-step: %w", err)
+	}
+	if fromStep != "" {
+		if err := p.ForceFrom(fromStep); err != nil {
+			return nil, fmt.Errorf("invalid --from: %w", err)
+		}
+	}
+
+	return &sampleRun{
+		Sample:        smp,
+		Dir:           sampleDir,
+		Pipeline:      p,
+		FinalAssembly: polishedContigs,
+		CoverageStats: layout.CoverageStats(),
+		QualimapDir:   qualimapDir,
+	}, nil
+}
+
+// signalContext returns a context that is cancelled on SIGINT/SIGTERM, so
+// running tools are torn down cleanly. After the first signal the default
+// handlers are restored, so a second Ctrl-C terminates immediately.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-sigs:
+			fmt.Printf("\nReceived %s, stopping running steps...\n", sig)
+			signal.Stop(sigs)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// loadRunConfig builds the effective configuration of a run: built-in
+// defaults, overlaid with the --config file if given, overlaid with any
+// flags set explicitly on the command line.
+func loadRunConfig(cmd *cobra.Command) (*config.Config, error) {
+	cfg := config.Default()
+	if configPath != "" {
+		loaded, err := config.Load(configPath)
+		if err != nil {
+			return nil, err
+		}
+		cfg = loaded
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("threads") {
+		cfg.Resources.Threads = threads
+	}
+	if flags.Changed("memory") {
+		cfg.Resources.Memory = memory
+	}
+	if flags.Changed("max-parallel") {
+		cfg.Resources.MaxParallel = maxParallel
+	}
+	if noParallel {
+		cfg.Resources.MaxParallel = 1
+	}
+	if flags.Changed("fetcher") {
+		cfg.Steps.Download.Fetcher = fetcherName
+	}
+	if flags.Changed("pilon-jar") {
+		cfg.Tools.PilonJar = pilonJarPath
+	}
+	if flags.Changed("adapter-fasta") {
+		cfg.Steps.Trim.AdapterFasta = adapterFastaPath
+	}
+	if flags.Changed("trimmer") {
+		cfg.Steps.Trim.Trimmer = trimmerName
+	}
+	if flags.Changed("long-read-type") {
+		cfg.Steps.LongReads.Type = longReadType
+	}
+	if flags.Changed("assembler") {
+		cfg.Steps.Assemble.Assembler = assemblerName
+	}
+	if flags.Changed("aligner") {
+		cfg.Steps.MapReads.Aligner = alignerName
+	}
+	if flags.Changed("polishers") {
+		cfg.Steps.Polish.Polishers = polisherNames
+	}
+	if flags.Changed("skip-qualimap") {
+		cfg.Steps.Qualimap.Skip = skipQualimap
+	}
+	if flags.Changed("filter-mode") {
+		cfg.Steps.Trim.Mode = filterMode
+	}
+	if flags.Changed("filter-custom-args") {
+		cfg.Steps.Trim.CustomArgs = filterCustomArgs
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// requireRunSettings checks the settings that have no default and may come
+// from the config file, a flag or (in batch mode) the sample sheet.
+func requireRunSettings(cfg *config.Config) error {
+	if slices.Contains(cfg.Steps.Polish.Polishers, "pilon") && cfg.Tools.PilonJar == "" {
+		return fmt.Errorf("the Pilon jar must be set with --pilon-jar or tools.pilon_jar")
+	}
+	return nil
+}
+
+// printStepSummary lists the outcome of every pipeline step, so it is clear
+// which steps finished and which were interrupted or never started.
+func printStepSummary(results []pipeline.StepResult) {
+	fmt.Println()
+	fmt.Println("=== PIPELINE SUMMARY ===")
+	for _, r := range results {
+		line := fmt.Sprintf("  %-12s %s", r.Status, r.Name)
+		if r.Status == pipeline.StatusFailed && r.Err != nil {
+			line += fmt.Sprintf(" (%v)", r.Err)
+		}
+		fmt.Println(line)
+	}
+	fmt.Println()
+}
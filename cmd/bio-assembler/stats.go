@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"bio-assembler/pkg/assemblystats"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	statsMinLength int
+	statsFormat    string
+)
+
+func init() {
+	statsCmd.Flags().IntVar(&statsMinLength, "min-length", 0, "Ignore contigs shorter than this many bases")
+	statsCmd.Flags().StringVarP(&statsFormat, "format", "f", "table", "Output format: table or json")
+
+	rootCmd.AddCommand(statsCmd)
+}
+
+var statsCmd = &cobra.Command{
+	Use:   "stats <fasta>...",
+	Short: "Print assembly statistics (N50, L50, GC, length distribution) for FASTA files",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if statsFormat != "table" && statsFormat != "json" {
+			fmt.Printf("Unknown format %q (expected table or json)\n", statsFormat)
+			os.Exit(1)
+		}
+
+		var all []*assemblystats.Stats
+		for _, path := range args {
+			s, err := assemblystats.ComputeFile(path, statsMinLength)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			all = append(all, s)
+		}
+
+		if statsFormat == "json" {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			var v any = all
+			if len(all) == 1 {
+				v = all[0]
+			}
+			if err := enc.Encode(v); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, row := range assemblystats.Table(all...) {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		tw.Flush()
+	},
+}
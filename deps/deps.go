@@ -0,0 +1,11 @@
+// Package deps bundles the data files bio-assembler ships with, so a
+// single binary runs without an installation directory.
+package deps
+
+import "embed"
+
+// Adapters holds the adapter FASTA files known to automatic adapter
+// detection, named after the kit (e.g. "TruSeq3-PE.fa").
+//
+//go:embed *.fa
+var Adapters embed.FS
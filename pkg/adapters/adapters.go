@@ -0,0 +1,265 @@
+// Package adapters picks the adapter FASTA matching a sequencing library by
+// looking for adapter read-through in a sample of its reads. The candidate
+// sets are the files bundled in the deps package.
+package adapters
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"bio-assembler/deps"
+	"bio-assembler/pkg/seqio"
+)
+
+const (
+	// seedLength is the number of adapter bases a read must contain to
+	// count as evidence for the adapter.
+	seedLength = 16
+	// DefaultSampleReads is the number of reads sampled from each file.
+	DefaultSampleReads = 200000
+	// DefaultMinPercent is the share of sampled reads that must carry an
+	// adapter before a set is chosen on evidence.
+	DefaultMinPercent = 0.1
+)
+
+// Sequence is one record of an adapter FASTA.
+type Sequence struct {
+	Name  string
+	Bases string
+}
+
+// Set is one bundled adapter FASTA.
+type Set struct {
+	// Name is the file name without extension, e.g. "TruSeq3-PE".
+	Name      string
+	Sequences []Sequence
+	// Data is the FASTA as shipped, ready to be written for the trimmer.
+	Data []byte
+}
+
+// PairedEnd reports whether the set is meant for paired-end libraries;
+// Trimmomatic's palindrome mode relies on its "Prefix" records.
+func (s *Set) PairedEnd() bool {
+	return strings.HasSuffix(s.Name, "-PE")
+}
+
+// Library loads the bundled adapter sets. The order is the preference used
+// to break ties: several kits share the TruSeq read-through sequence (e.g.
+// NEBNext), and the most common one comes first.
+func Library() ([]*Set, error) {
+	order := []string{"TruSeq3-PE", "TruSeq3-SE", "NexteraPE-PE", "TruSeq2-PE", "TruSeq2-SE", "NEBNext-PE"}
+	files, err := fs.Glob(deps.Adapters, "*.fa")
+	if err != nil {
+		return nil, err
+	}
+	var sets []*Set
+	for _, file := range files {
+		data, err := deps.Adapters.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		set := &Set{Name: strings.TrimSuffix(file, path.Ext(file)), Data: data}
+		if set.Sequences, err = parseFasta(data); err != nil {
+			return nil, fmt.Errorf("invalid bundled adapter file %s: %w", file, err)
+		}
+		sets = append(sets, set)
+	}
+	rank := func(s *Set) int {
+		if i := slices.Index(order, s.Name); i >= 0 {
+			return i
+		}
+		return len(order)
+	}
+	slices.SortStableFunc(sets, func(a, b *Set) int { return rank(a) - rank(b) })
+	return sets, nil
+}
+
+// Lookup returns the bundled set with the given name.
+func Lookup(name string) (*Set, error) {
+	sets, err := Library()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sets {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown adapter set %q", name)
+}
+
+func parseFasta(data []byte) ([]Sequence, error) {
+	var seqs []Sequence
+	r := seqio.NewFastaReader(bytes.NewReader(data))
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return seqs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		seqs = append(seqs, Sequence{Name: strings.TrimSpace(string(rec.Header)), Bases: strings.ToUpper(string(rec.Seq))})
+	}
+}
+
+// Evidence is how many sampled reads matched the sequences of one set.
+type Evidence struct {
+	Set     string  `json:"adapter_set"`
+	Reads   int     `json:"reads"`
+	Percent float64 `json:"percent"`
+	// Sequences counts the matching reads per adapter record.
+	Sequences map[string]int `json:"sequences,omitempty"`
+}
+
+// Detection is the outcome of Detect, kept as run metadata.
+type Detection struct {
+	Files        []string   `json:"files"`
+	SampledReads int        `json:"sampled_reads"`
+	Chosen       string     `json:"chosen"`
+	Reason       string     `json:"reason"`
+	Evidence     []Evidence `json:"evidence"`
+}
+
+// Detect samples up to sampleReads reads from the start of each file and
+// counts, per adapter set, the reads containing a seed of one of its
+// sequences on either strand. The set with the most matching reads wins;
+// ties go to a set made for the library layout, then to the Library order.
+// When no set reaches minPercent of the sampled reads the default TruSeq3
+// set for the layout is chosen.
+func Detect(files []string, paired bool, sampleReads int, minPercent float64) (*Detection, error) {
+	sets, err := Library()
+	if err != nil {
+		return nil, err
+	}
+
+	// seeds maps every seed to the set and record it was taken from.
+	type origin struct{ set, seq int }
+	seeds := make(map[string][]origin)
+	for i, set := range sets {
+		for j, seq := range set.Sequences {
+			if len(seq.Bases) < seedLength {
+				continue
+			}
+			for _, s := range []string{seq.Bases[:seedLength], reverseComplement(seq.Bases)[:seedLength]} {
+				if !slices.Contains(seeds[s], (origin{i, j})) {
+					seeds[s] = append(seeds[s], origin{i, j})
+				}
+			}
+		}
+	}
+
+	setHits := make([]int, len(sets))
+	seqHits := make([][]int, len(sets))
+	for i, set := range sets {
+		seqHits[i] = make([]int, len(set.Sequences))
+	}
+	d := &Detection{Files: files}
+	setSeen := make([]bool, len(sets))
+	seqSeen := make([][]bool, len(sets))
+	for i := range sets {
+		seqSeen[i] = make([]bool, len(sets[i].Sequences))
+	}
+	for _, file := range files {
+		err := sampleFastq(file, sampleReads, func(read []byte) {
+			d.SampledReads++
+			clear(setSeen)
+			for i := range seqSeen {
+				clear(seqSeen[i])
+			}
+			for k := 0; k+seedLength <= len(read); k++ {
+				for _, o := range seeds[string(read[k:k+seedLength])] {
+					seqSeen[o.set][o.seq] = true
+					setSeen[o.set] = true
+				}
+			}
+			for i := range sets {
+				if setSeen[i] {
+					setHits[i]++
+				}
+				for j, seen := range seqSeen[i] {
+					if seen {
+						seqHits[i][j]++
+					}
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if d.SampledReads == 0 {
+		return nil, fmt.Errorf("no reads to sample in %s", strings.Join(files, ", "))
+	}
+
+	best := -1
+	for i, set := range sets {
+		ev := Evidence{
+			Set:     set.Name,
+			Reads:   setHits[i],
+			Percent: 100 * float64(setHits[i]) / float64(d.SampledReads),
+		}
+		for j, n := range seqHits[i] {
+			if n > 0 {
+				if ev.Sequences == nil {
+					ev.Sequences = make(map[string]int)
+				}
+				ev.Sequences[set.Sequences[j].Name] = n
+			}
+		}
+		d.Evidence = append(d.Evidence, ev)
+
+		if best < 0 || setHits[i] > setHits[best] ||
+			setHits[i] == setHits[best] && set.PairedEnd() == paired && sets[best].PairedEnd() != paired {
+			best = i
+		}
+	}
+
+	if d.Evidence[best].Percent >= minPercent {
+		d.Chosen = sets[best].Name
+		d.Reason = fmt.Sprintf("adapter sequences found in %.2f%% of %d sampled reads", d.Evidence[best].Percent, d.SampledReads)
+	} else {
+		d.Chosen = "TruSeq3-SE"
+		if paired {
+			d.Chosen = "TruSeq3-PE"
+		}
+		d.Reason = fmt.Sprintf("no adapter set matched at least %g%% of %d sampled reads; using the default", minPercent, d.SampledReads)
+	}
+	return d, nil
+}
+
+// sampleFastq calls fn with the sequence of each of the first n reads of a
+// FASTQ file, which may be gzip-compressed. The slice is only valid during
+// the call.
+func sampleFastq(file string, n int, fn func(read []byte)) error {
+	r, err := seqio.OpenFastq(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	for r.Records() < int64(n) {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		fn(bytes.ToUpper(rec.Seq))
+	}
+	return nil
+}
+
+var complement = strings.NewReplacer("A", "T", "C", "G", "G", "C", "T", "A")
+
+func reverseComplement(s string) string {
+	b := []byte(complement.Replace(s))
+	slices.Reverse(b)
+	return string(b)
+}
@@ -0,0 +1,232 @@
+// Package assemblystats computes summary statistics of a genome assembly
+// (N50, L50, GC content, length distribution, ...) from a FASTA file. The
+// FASTA is streamed, so only one length per contig is kept in memory.
+package assemblystats
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+)
+
+// DefaultBins are the lower bounds of the length histogram bins. The last
+// bin is open-ended.
+var DefaultBins = []int{0, 500, 1000, 2000, 5000, 10000, 20000, 50000, 100000, 200000, 500000, 1000000}
+
+// Stats summarises the contigs of an assembly that are at least MinLength
+// long. Shorter contigs are only counted in Excluded.
+type Stats struct {
+	File        string  `json:"file,omitempty"`
+	MinLength   int     `json:"min_length"`
+	Contigs     int     `json:"contigs"`
+	Excluded    int     `json:"excluded_contigs"`
+	TotalLength int64   `json:"total_length"`
+	Largest     int     `json:"largest_contig"`
+	N50         int     `json:"n50"`
+	N90         int     `json:"n90"`
+	L50         int     `json:"l50"`
+	L90         int     `json:"l90"`
+	GCPercent   float64 `json:"gc_percent"`
+	NCount      int64   `json:"n_count"`
+	NPercent    float64 `json:"n_percent"`
+	Histogram   []Bin   `json:"histogram"`
+}
+
+// Bin is one bar of the length histogram: contigs with Min <= length < Max.
+// Max is 0 for the last, open-ended bin.
+type Bin struct {
+	Min         int   `json:"min"`
+	Max         int   `json:"max,omitempty"`
+	Contigs     int   `json:"contigs"`
+	TotalLength int64 `json:"total_length"`
+}
+
+// Label renders the bin range for tables and plots, e.g. "1000-1999" or
+// ">=1000000".
+func (b Bin) Label() string {
+	if b.Max == 0 {
+		return fmt.Sprintf(">=%d", b.Min)
+	}
+	return fmt.Sprintf("%d-%d", b.Min, b.Max-1)
+}
+
+// ComputeFile computes the statistics of a FASTA file, which may be
+// gzip-compressed.
+func ComputeFile(path string, minLength int) (*Stats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 1<<20)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	stats, err := Compute(r, minLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	stats.File = path
+	return stats, nil
+}
+
+// contig holds the per-sequence counts gathered while streaming.
+type contig struct {
+	length int
+	gc     int64
+	acgt   int64
+	n      int64
+}
+
+// Compute reads FASTA records from r and computes their statistics.
+// Contigs shorter than minLength are excluded from every metric.
+func Compute(r io.Reader, minLength int) (*Stats, error) {
+	s := &Stats{MinLength: minLength}
+	for _, lo := range DefaultBins {
+		s.Histogram = append(s.Histogram, Bin{Min: lo})
+	}
+	for i := range len(s.Histogram) - 1 {
+		s.Histogram[i].Max = s.Histogram[i+1].Min
+	}
+
+	var (
+		lengths []int
+		gc      int64
+		acgt    int64
+		cur     *contig
+	)
+	finish := func() {
+		if cur == nil {
+			return
+		}
+		if cur.length < minLength {
+			s.Excluded++
+			cur = nil
+			return
+		}
+		lengths = append(lengths, cur.length)
+		s.TotalLength += int64(cur.length)
+		s.NCount += cur.n
+		gc += cur.gc
+		acgt += cur.acgt
+		bin := len(s.Histogram) - 1
+		for bin > 0 && cur.length < s.Histogram[bin].Min {
+			bin--
+		}
+		s.Histogram[bin].Contigs++
+		s.Histogram[bin].TotalLength += int64(cur.length)
+		cur = nil
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 1<<20), 1<<30)
+	for scanner.Scan() {
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if line[0] == '>' {
+			finish()
+			cur = &contig{}
+			continue
+		}
+		if cur == nil {
+			return nil, fmt.Errorf("sequence data before the first FASTA header")
+		}
+		cur.length += len(line)
+		for _, c := range line {
+			switch c {
+			case 'G', 'C', 'g', 'c':
+				cur.gc++
+				cur.acgt++
+			case 'A', 'T', 'a', 't':
+				cur.acgt++
+			case 'N', 'n':
+				cur.n++
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+
+	s.Contigs = len(lengths)
+	if s.Contigs == 0 {
+		return s, nil
+	}
+
+	slices.SortFunc(lengths, func(a, b int) int { return b - a })
+	s.Largest = lengths[0]
+	s.N50, s.L50 = nx(lengths, s.TotalLength, 50)
+	s.N90, s.L90 = nx(lengths, s.TotalLength, 90)
+	if acgt > 0 {
+		s.GCPercent = 100 * float64(gc) / float64(acgt)
+	}
+	if s.TotalLength > 0 {
+		s.NPercent = 100 * float64(s.NCount) / float64(s.TotalLength)
+	}
+	return s, nil
+}
+
+// nx returns the length of the contig at which the contigs, taken from the
+// longest down, reach x percent of the total length, and the number of
+// contigs needed to get there. lengths must be sorted in descending order.
+func nx(lengths []int, total int64, x int) (n, l int) {
+	var sum int64
+	for i, length := range lengths {
+		sum += int64(length)
+		if sum*100 >= total*int64(x) {
+			return length, i + 1
+		}
+	}
+	return lengths[len(lengths)-1], len(lengths)
+}
+
+// Table renders the statistics of one or more assemblies side by side, one
+// metric per row, in the style of QUAST's report.
+func Table(all ...*Stats) [][]string {
+	header := []string{"Metric"}
+	for _, s := range all {
+		header = append(header, s.File)
+	}
+	rows := [][]string{header}
+	add := func(name string, value func(*Stats) string) {
+		row := []string{name}
+		for _, s := range all {
+			row = append(row, value(s))
+		}
+		rows = append(rows, row)
+	}
+
+	add("Min contig length", func(s *Stats) string { return fmt.Sprint(s.MinLength) })
+	add("Contigs", func(s *Stats) string { return fmt.Sprint(s.Contigs) })
+	add("Excluded contigs", func(s *Stats) string { return fmt.Sprint(s.Excluded) })
+	add("Total length", func(s *Stats) string { return fmt.Sprint(s.TotalLength) })
+	add("Largest contig", func(s *Stats) string { return fmt.Sprint(s.Largest) })
+	add("N50", func(s *Stats) string { return fmt.Sprint(s.N50) })
+	add("N90", func(s *Stats) string { return fmt.Sprint(s.N90) })
+	add("L50", func(s *Stats) string { return fmt.Sprint(s.L50) })
+	add("L90", func(s *Stats) string { return fmt.Sprint(s.L90) })
+	add("GC (%)", func(s *Stats) string { return fmt.Sprintf("%.2f", s.GCPercent) })
+	add("N's", func(s *Stats) string { return fmt.Sprint(s.NCount) })
+	add("N (%)", func(s *Stats) string { return fmt.Sprintf("%.3f", s.NPercent) })
+	for i := range DefaultBins {
+		add("Contigs "+all[0].Histogram[i].Label(), func(s *Stats) string {
+			return fmt.Sprint(s.Histogram[i].Contigs)
+		})
+	}
+	return rows
+}
@@ -0,0 +1,82 @@
+package assemblystats
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompute(t *testing.T) {
+	tests := []struct {
+		name      string
+		fasta     string
+		minLength int
+		want      Stats
+	}{
+		{
+			name: "contigs",
+			// Lengths 6, 4 and 2 over two lines for the first contig.
+			fasta: ">c1 first\nACGT\nNN\n>c2\nggcc\n>c3\nAT\n",
+			want: Stats{
+				Contigs: 3, TotalLength: 12, Largest: 6,
+				N50: 6, L50: 1, N90: 2, L90: 3,
+				GCPercent: 60, NCount: 2, NPercent: 100 * 2.0 / 12,
+			},
+		},
+		{
+			name:      "short contigs excluded",
+			fasta:     ">c1\nACGTACGT\n>c2\nAC\n",
+			minLength: 5,
+			want: Stats{
+				MinLength: 5, Contigs: 1, Excluded: 1, TotalLength: 8, Largest: 8,
+				N50: 8, L50: 1, N90: 8, L90: 1, GCPercent: 50,
+			},
+		},
+		{
+			name:  "empty records",
+			fasta: ">a\n>b\n",
+			want:  Stats{Contigs: 2, L50: 1, L90: 1},
+		},
+		{
+			name: "no records",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := Compute(strings.NewReader(tt.fasta), tt.minLength)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := *s
+			got.Histogram = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+			if _, err := json.Marshal(s); err != nil {
+				t.Errorf("statistics cannot be encoded: %v", err)
+			}
+			for _, row := range Table(s) {
+				for _, cell := range row {
+					if strings.Contains(cell, "NaN") {
+						t.Errorf("table row %q shows NaN", row)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestComputeHistogram(t *testing.T) {
+	fasta := ">a\n" + strings.Repeat("A", 499) + "\n>b\n" + strings.Repeat("A", 500) + "\n>c\n" + strings.Repeat("A", 1500) + "\n"
+	s, err := Compute(strings.NewReader(fasta), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"0-499": 1, "500-999": 1, "1000-1999": 1}
+	for _, bin := range s.Histogram {
+		if bin.Contigs != want[bin.Label()] {
+			t.Errorf("bin %s has %d contigs, want %d", bin.Label(), bin.Contigs, want[bin.Label()])
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package bamstats
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// SAM flag bits used by the statistics.
+const (
+	flagPaired        = 0x1
+	flagProperPair    = 0x2
+	flagUnmapped      = 0x4
+	flagSecondary     = 0x100
+	flagQCFail        = 0x200
+	flagDuplicate     = 0x400
+	flagSupplementary = 0x800
+)
+
+// CIGAR operations that consume the reference; M, = and X also cover it
+// with a read base.
+const (
+	cigarMatch    = 0
+	cigarDeletion = 2
+	cigarSkip     = 3
+	cigarEqual    = 7
+	cigarDiff     = 8
+)
+
+// ErrNotBAM is returned by NewReader for input that is not a BAM file.
+var ErrNotBAM = errors.New("not a BAM file")
+
+// Ref is one reference sequence from the BAM header.
+type Ref struct {
+	Name   string
+	Length int
+}
+
+// Record holds the fields of a BAM alignment the statistics need. The
+// read name, sequence, qualities and tags are skipped.
+type Record struct {
+	RefID int32
+	Pos   int32
+	MapQ  uint8
+	Flag  uint16
+	TLen  int32
+	// Cigar holds the packed operations: length<<4 | op.
+	Cigar []uint32
+}
+
+// Reader decodes the alignments of a BAM file. BGZF is a series of gzip
+// members, which compress/gzip reads as one stream.
+type Reader struct {
+	r io.Reader
+	// Header is the SAM header text.
+	Header string
+	Refs   []Ref
+	buf    []byte
+	rec    Record
+}
+
+// NewReader reads the BAM header from r.
+func NewReader(r io.Reader) (*Reader, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNotBAM, err)
+	}
+	br := &Reader{r: bufio.NewReaderSize(gz, 1<<20)}
+	if err := br.readHeader(); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, fmt.Errorf("failed to read BAM header: %w", err)
+	}
+	return br, nil
+}
+
+// readHeader reads the magic, the header text and the reference list.
+func (br *Reader) readHeader() error {
+	magic := make([]byte, 4)
+	if _, err := io.ReadFull(br.r, magic); err != nil || !bytes.Equal(magic, []byte("BAM\x01")) {
+		return ErrNotBAM
+	}
+	textLen, err := br.int32()
+	if err != nil {
+		return err
+	}
+	text, err := br.bytes(int(textLen))
+	if err != nil {
+		return err
+	}
+	br.Header = string(bytes.TrimRight(text, "\x00"))
+	nRef, err := br.int32()
+	if err != nil {
+		return err
+	}
+	for range nRef {
+		nameLen, err := br.int32()
+		if err != nil {
+			return err
+		}
+		raw, err := br.bytes(int(nameLen))
+		if err != nil {
+			return err
+		}
+		// The buffer is reused by the next read.
+		name := string(bytes.TrimRight(raw, "\x00"))
+		length, err := br.int32()
+		if err != nil {
+			return err
+		}
+		br.Refs = append(br.Refs, Ref{Name: name, Length: int(length)})
+	}
+	return nil
+}
+
+// Read returns the next alignment, or io.EOF after the last one. The record
+// is only valid until the next call.
+func (r *Reader) Read() (*Record, error) {
+	size, err := r.int32()
+	if err != nil {
+		// io.EOF here is the clean end of the alignments.
+		return nil, err
+	}
+	// The fixed part of a record is 32 bytes.
+	if size < 32 {
+		return nil, fmt.Errorf("invalid BAM record size %d", size)
+	}
+	data, err := r.bytes(int(size))
+	if err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	nameLen := int(data[8])
+	nCigar := int(le.Uint16(data[12:]))
+	if 32+nameLen+4*nCigar > len(data) {
+		return nil, fmt.Errorf("truncated BAM record")
+	}
+	rec := &r.rec
+	rec.RefID = int32(le.Uint32(data[0:]))
+	rec.Pos = int32(le.Uint32(data[4:]))
+	rec.MapQ = data[9]
+	rec.Flag = le.Uint16(data[14:])
+	rec.TLen = int32(le.Uint32(data[28:]))
+	rec.Cigar = rec.Cigar[:0]
+	cigar := data[32+nameLen:]
+	for i := range nCigar {
+		rec.Cigar = append(rec.Cigar, le.Uint32(cigar[4*i:]))
+	}
+	return rec, nil
+}
+
+func (r *Reader) int32() (int32, error) {
+	b, err := r.bytes(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(b)), nil
+}
+
+// bytes reads the next n bytes into a buffer reused across calls. As with
+// io.ReadFull, io.EOF means that no byte was left.
+func (r *Reader) bytes(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid BAM field length %d", n)
+	}
+	if cap(r.buf) < n {
+		r.buf = make([]byte, n)
+	}
+	b := r.buf[:n]
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
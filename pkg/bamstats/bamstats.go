@@ -0,0 +1,327 @@
+// Package bamstats computes mapping and coverage statistics of reads
+// aligned to an assembly (mapping rate, properly paired reads, insert
+// sizes, depth and breadth of coverage) from a coordinate-sorted BAM file,
+// or coverage alone from the output of "samtools depth". It is a light
+// alternative to Qualimap: only the depth of one contig is kept in memory.
+package bamstats
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+)
+
+// DefaultDepths are the depths at which the breadth of coverage is given.
+var DefaultDepths = []int{1, 10, 30}
+
+// InsertBinWidth is the width of the insert size histogram bins.
+const InsertBinWidth = 10
+
+// Source values of Stats.
+const (
+	SourceBAM   = "bam"
+	SourceDepth = "samtools depth"
+)
+
+// Stats summarises the alignments of one BAM file. Mapping and InsertSize
+// are nil when the statistics were computed from samtools depth output.
+type Stats struct {
+	File       string      `json:"file,omitempty"`
+	Source     string      `json:"source"`
+	Mapping    *Mapping    `json:"mapping,omitempty"`
+	InsertSize *InsertSize `json:"insert_size,omitempty"`
+	Coverage   Coverage    `json:"coverage"`
+	Contigs    []Contig    `json:"contigs"`
+}
+
+// Mapping counts primary alignments, one per read; secondary and
+// supplementary alignments are left out.
+type Mapping struct {
+	Reads         int64   `json:"reads"`
+	Mapped        int64   `json:"mapped"`
+	MappedPercent float64 `json:"mapped_percent"`
+	Paired        int64   `json:"paired"`
+	// ProperlyPaired reads are mapped with their mate at the expected
+	// distance and orientation; the percentage is of the paired reads.
+	ProperlyPaired        int64   `json:"properly_paired"`
+	ProperlyPairedPercent float64 `json:"properly_paired_percent"`
+	// Duplicates are the mapped reads flagged as PCR or optical
+	// duplicates; the percentage is of the mapped reads.
+	Duplicates       int64   `json:"duplicates"`
+	DuplicatePercent float64 `json:"duplicate_percent"`
+}
+
+// InsertSize describes the fragment lengths of properly paired reads.
+type InsertSize struct {
+	Pairs     int64     `json:"pairs"`
+	Mean      float64   `json:"mean"`
+	StdDev    float64   `json:"std_dev"`
+	Median    int       `json:"median"`
+	Histogram []SizeBin `json:"histogram"`
+}
+
+// SizeBin counts the pairs with Min <= insert size < Min+InsertBinWidth.
+// Bins without pairs are left out of the histogram.
+type SizeBin struct {
+	Min   int   `json:"min"`
+	Pairs int64 `json:"pairs"`
+}
+
+// Coverage is the read depth over a set of bases.
+type Coverage struct {
+	Length  int64     `json:"length"`
+	Mean    float64   `json:"mean_coverage"`
+	Median  int       `json:"median_coverage"`
+	Breadth []Breadth `json:"breadth"`
+}
+
+// Breadth is the share of bases covered by at least Depth reads.
+type Breadth struct {
+	Depth   int     `json:"depth"`
+	Percent float64 `json:"percent"`
+}
+
+// Contig is the coverage of one reference sequence. Reads is the number of
+// primary alignments starting on it, unknown for samtools depth output.
+type Contig struct {
+	Name  string `json:"name"`
+	Reads int64  `json:"reads,omitempty"`
+	Coverage
+}
+
+// ComputeFile computes the statistics of a coordinate-sorted BAM file.
+func ComputeFile(path string) (*Stats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	r, err := NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	stats, err := Compute(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	stats.File = path
+	return stats, nil
+}
+
+// Compute reads the alignments from r, which must be sorted by coordinate
+// or at least grouped by reference. Unmapped, secondary, QC-failed and
+// duplicate alignments do not count towards the coverage.
+func Compute(r *Reader) (*Stats, error) {
+	s := &Stats{Source: SourceBAM, Mapping: &Mapping{}}
+	total := &coverage{}
+	reads := make([]int64, len(r.Refs))
+	done := make([]bool, len(r.Refs))
+	inserts := map[int]int64{}
+
+	// depth is the difference array of the current reference: the depth of
+	// base i is the sum of depth[0..i].
+	var depth []int32
+	cur := int32(-1)
+	finish := func() {
+		if cur < 0 {
+			return
+		}
+		acc := &coverage{}
+		var d int32
+		for _, delta := range depth[:r.Refs[cur].Length] {
+			d += delta
+			acc.add(int(d), 1)
+		}
+		total.merge(acc)
+		s.Contigs = append(s.Contigs, acc.contig(r.Refs[cur].Name, reads[cur]))
+		done[cur] = true
+	}
+
+	m := s.Mapping
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if int(rec.RefID) >= len(r.Refs) {
+			return nil, fmt.Errorf("alignment to reference %d, but the header lists %d", rec.RefID, len(r.Refs))
+		}
+
+		primary := rec.Flag&(flagSecondary|flagSupplementary) == 0
+		mapped := rec.Flag&flagUnmapped == 0 && rec.RefID >= 0
+		if primary {
+			m.Reads++
+			if rec.Flag&flagPaired != 0 {
+				m.Paired++
+				if mapped && rec.Flag&flagProperPair != 0 {
+					m.ProperlyPaired++
+					// Each pair is counted once, on the leftmost mate.
+					if rec.TLen > 0 {
+						inserts[int(rec.TLen)]++
+					}
+				}
+			}
+			if mapped {
+				m.Mapped++
+				reads[rec.RefID]++
+				if rec.Flag&flagDuplicate != 0 {
+					m.Duplicates++
+				}
+			}
+		}
+		if !mapped || rec.Flag&(flagSecondary|flagQCFail|flagDuplicate) != 0 {
+			continue
+		}
+		if rec.RefID != cur {
+			if done[rec.RefID] {
+				return nil, fmt.Errorf("alignments to %s are not grouped together; is the BAM sorted by coordinate?", r.Refs[rec.RefID].Name)
+			}
+			finish()
+			cur = rec.RefID
+			length := r.Refs[cur].Length
+			if cap(depth) < length+1 {
+				depth = make([]int32, length+1)
+			}
+			depth = depth[:length+1]
+			clear(depth)
+		}
+		pos := int(rec.Pos)
+		for _, op := range rec.Cigar {
+			n := int(op >> 4)
+			switch op & 0xf {
+			case cigarMatch, cigarEqual, cigarDiff:
+				start, end := min(max(pos, 0), len(depth)-1), min(max(pos+n, 0), len(depth)-1)
+				depth[start]++
+				depth[end]--
+				pos += n
+			case cigarDeletion, cigarSkip:
+				pos += n
+			}
+		}
+	}
+	finish()
+
+	// References without any alignment still count, with depth 0.
+	for i, ref := range r.Refs {
+		if done[i] {
+			continue
+		}
+		acc := &coverage{}
+		acc.add(0, int64(ref.Length))
+		total.merge(acc)
+		s.Contigs = append(s.Contigs, acc.contig(ref.Name, reads[i]))
+	}
+	s.Coverage = total.summary()
+
+	m.MappedPercent = percent(m.Mapped, m.Reads)
+	m.ProperlyPairedPercent = percent(m.ProperlyPaired, m.Paired)
+	m.DuplicatePercent = percent(m.Duplicates, m.Mapped)
+	if len(inserts) > 0 {
+		s.InsertSize = insertSize(inserts)
+	}
+	return s, nil
+}
+
+// coverage is a histogram of depths: hist[d] bases have depth d.
+type coverage struct {
+	hist []int64
+}
+
+func (c *coverage) add(depth int, bases int64) {
+	if depth < 0 {
+		depth = 0
+	}
+	if depth >= len(c.hist) {
+		c.hist = append(c.hist, make([]int64, depth+1-len(c.hist))...)
+	}
+	c.hist[depth] += bases
+}
+
+func (c *coverage) merge(o *coverage) {
+	for d, n := range o.hist {
+		if n > 0 {
+			c.add(d, n)
+		}
+	}
+}
+
+func (c *coverage) summary() Coverage {
+	var length, sum int64
+	for d, n := range c.hist {
+		length += n
+		sum += int64(d) * n
+	}
+	cov := Coverage{Length: length}
+	for _, depth := range DefaultDepths {
+		var covered int64
+		for d := depth; d < len(c.hist); d++ {
+			covered += c.hist[d]
+		}
+		cov.Breadth = append(cov.Breadth, Breadth{Depth: depth, Percent: percent(covered, length)})
+	}
+	if length == 0 {
+		return cov
+	}
+	cov.Mean = float64(sum) / float64(length)
+	var cum int64
+	for d, n := range c.hist {
+		cum += n
+		if 2*cum >= length {
+			cov.Median = d
+			break
+		}
+	}
+	return cov
+}
+
+func (c *coverage) contig(name string, reads int64) Contig {
+	return Contig{Name: name, Reads: reads, Coverage: c.summary()}
+}
+
+// insertSize summarises the counts of each insert size.
+func insertSize(counts map[int]int64) *InsertSize {
+	sizes := make([]int, 0, len(counts))
+	is := &InsertSize{}
+	var sum float64
+	for size, n := range counts {
+		sizes = append(sizes, size)
+		is.Pairs += n
+		sum += float64(size) * float64(n)
+	}
+	slices.Sort(sizes)
+	is.Mean = sum / float64(is.Pairs)
+
+	var sq float64
+	var cum int64
+	median := false
+	for _, size := range sizes {
+		n := counts[size]
+		sq += float64(n) * (float64(size) - is.Mean) * (float64(size) - is.Mean)
+		cum += n
+		if !median && 2*cum >= is.Pairs {
+			is.Median = size
+			median = true
+		}
+		lo := size / InsertBinWidth * InsertBinWidth
+		if k := len(is.Histogram); k > 0 && is.Histogram[k-1].Min == lo {
+			is.Histogram[k-1].Pairs += n
+		} else {
+			is.Histogram = append(is.Histogram, SizeBin{Min: lo, Pairs: n})
+		}
+	}
+	is.StdDev = math.Sqrt(sq / float64(is.Pairs))
+	return is
+}
+
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(n) / float64(total)
+}
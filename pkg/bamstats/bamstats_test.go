@@ -0,0 +1,224 @@
+package bamstats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"bio-assembler/pkg/seqio"
+)
+
+type testAlignment struct {
+	ref, pos int32
+	flag     uint16
+	tlen     int32
+	cigar    []uint32
+}
+
+// op packs one CIGAR operation.
+func op(n int, kind uint32) uint32 {
+	return uint32(n)<<4 | kind
+}
+
+// encodeBAM builds a BGZF-compressed BAM file; truncate drops that many
+// bytes from the end of the uncompressed data.
+func encodeBAM(t *testing.T, refs []Ref, alignments []testAlignment, truncate int) []byte {
+	t.Helper()
+	le := binary.LittleEndian
+	var raw bytes.Buffer
+	put := func(v any) { binary.Write(&raw, le, v) }
+
+	text := "@HD\tVN:1.6\tSO:coordinate\n"
+	raw.WriteString("BAM\x01")
+	put(int32(len(text)))
+	raw.WriteString(text)
+	put(int32(len(refs)))
+	for _, ref := range refs {
+		put(int32(len(ref.Name) + 1))
+		raw.WriteString(ref.Name + "\x00")
+		put(int32(ref.Length))
+	}
+
+	for i, a := range alignments {
+		name := []byte{'r', byte('a' + i), 0}
+		const seqLen = 4
+		size := 32 + len(name) + 4*len(a.cigar) + (seqLen+1)/2 + seqLen
+		put(int32(size))
+		put(a.ref)
+		put(a.pos)
+		put(uint8(len(name)))
+		put(uint8(60))
+		put(uint16(0)) // bin
+		put(uint16(len(a.cigar)))
+		put(a.flag)
+		put(int32(seqLen))
+		put(int32(-1)) // mate reference
+		put(int32(-1)) // mate position
+		put(a.tlen)
+		raw.Write(name)
+		put(a.cigar)
+		raw.Write([]byte{0x12, 0x48}) // ACGT
+		raw.Write([]byte{30, 30, 30, 30})
+	}
+
+	var out bytes.Buffer
+	w := seqio.NewBGZFWriter(&out)
+	if _, err := w.Write(raw.Bytes()[:raw.Len()-truncate]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+var testRefs = []Ref{{"c1", 100}, {"c2", 50}, {"c3", 20}}
+
+// testAlignments cover c1 and c2 and leave c3 without reads.
+var testAlignments = []testAlignment{
+	// A properly paired fragment of 50 bases on c1.
+	{ref: 0, pos: 0, flag: flagPaired | flagProperPair, tlen: 50, cigar: []uint32{op(20, cigarMatch)}},
+	{ref: 0, pos: 30, flag: flagPaired | flagProperPair, tlen: -50, cigar: []uint32{op(20, cigarMatch)}},
+	// A pair with an unmapped mate; the deletion is not covered.
+	{ref: 0, pos: 10, flag: flagPaired, cigar: []uint32{op(10, cigarMatch), op(5, cigarDeletion), op(10, cigarMatch)}},
+	{ref: -1, pos: -1, flag: flagPaired | flagUnmapped},
+	// Secondary alignments are neither reads nor coverage.
+	{ref: 0, pos: 80, flag: flagPaired | flagSecondary, cigar: []uint32{op(20, cigarMatch)}},
+	// Single reads on c2; the duplicate is a read but not coverage.
+	{ref: 1, pos: 0, flag: flagDuplicate, cigar: []uint32{op(50, cigarMatch)}},
+	{ref: 1, pos: 0, cigar: []uint32{op(50, cigarMatch)}},
+	{ref: 1, pos: 10, cigar: []uint32{op(10, cigarMatch)}},
+}
+
+func computeBAM(t *testing.T, data []byte) (*Stats, error) {
+	t.Helper()
+	r, err := NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return Compute(r)
+}
+
+// breadth lists the share of covered bases at DefaultDepths.
+func breadth(covered1, covered10, covered30, length int64) []Breadth {
+	return []Breadth{
+		{Depth: 1, Percent: percent(covered1, length)},
+		{Depth: 10, Percent: percent(covered10, length)},
+		{Depth: 30, Percent: percent(covered30, length)},
+	}
+}
+
+func TestCompute(t *testing.T) {
+	s, err := computeBAM(t, encodeBAM(t, testRefs, testAlignments, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantMapping := Mapping{
+		Reads: 7, Mapped: 6, MappedPercent: percent(6, 7),
+		Paired: 4, ProperlyPaired: 2, ProperlyPairedPercent: 50,
+		Duplicates: 1, DuplicatePercent: percent(1, 6),
+	}
+	if s.Source != SourceBAM || s.Mapping == nil || *s.Mapping != wantMapping {
+		t.Errorf("mapping is %+v, want %+v", s.Mapping, wantMapping)
+	}
+
+	wantInsert := &InsertSize{Pairs: 1, Mean: 50, Median: 50, Histogram: []SizeBin{{Min: 50, Pairs: 1}}}
+	if !reflect.DeepEqual(s.InsertSize, wantInsert) {
+		t.Errorf("insert size is %+v, want %+v", s.InsertSize, wantInsert)
+	}
+
+	// c1 has 30 bases at depth 1 and 15 at depth 2, c2 40 and 10.
+	wantContigs := []Contig{
+		{Name: "c1", Reads: 3, Coverage: Coverage{Length: 100, Mean: 0.6, Median: 0, Breadth: breadth(45, 0, 0, 100)}},
+		{Name: "c2", Reads: 3, Coverage: Coverage{Length: 50, Mean: 1.2, Median: 1, Breadth: breadth(50, 0, 0, 50)}},
+		{Name: "c3", Coverage: Coverage{Length: 20, Breadth: breadth(0, 0, 0, 20)}},
+	}
+	if !reflect.DeepEqual(s.Contigs, wantContigs) {
+		t.Errorf("contigs:\ngot  %+v\nwant %+v", s.Contigs, wantContigs)
+	}
+	wantCoverage := Coverage{Length: 170, Mean: 120.0 / 170, Median: 1, Breadth: breadth(95, 0, 0, 170)}
+	if !reflect.DeepEqual(s.Coverage, wantCoverage) {
+		t.Errorf("coverage is %+v, want %+v", s.Coverage, wantCoverage)
+	}
+}
+
+func TestComputeErrors(t *testing.T) {
+	unsorted := []testAlignment{
+		{ref: 0, pos: 0, cigar: []uint32{op(10, cigarMatch)}},
+		{ref: 1, pos: 0, cigar: []uint32{op(10, cigarMatch)}},
+		{ref: 0, pos: 20, cigar: []uint32{op(10, cigarMatch)}},
+	}
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+		wantMsg string
+	}{
+		{name: "unsorted", data: encodeBAM(t, testRefs, unsorted, 0), wantMsg: "not grouped together"},
+		{name: "truncated record", data: encodeBAM(t, testRefs, testAlignments, 3), wantErr: io.ErrUnexpectedEOF},
+		{name: "unknown reference", data: encodeBAM(t, testRefs[:1], testAlignments, 0), wantMsg: "header lists 1"},
+		{name: "not gzip", data: []byte("@HD\tVN:1.6\n"), wantErr: ErrNotBAM},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := computeBAM(t, tt.data)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantMsg) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestComputeDepth(t *testing.T) {
+	// CRLF line endings are accepted.
+	depth := "c1\t1\t0\nc1\t2\t3\nc1\t3\t3\r\nc2\t1\t10\n\n"
+	s, err := ComputeDepth(strings.NewReader(depth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Source != SourceDepth || s.Mapping != nil || s.InsertSize != nil {
+		t.Errorf("depth statistics have source %q, mapping %+v and insert size %+v", s.Source, s.Mapping, s.InsertSize)
+	}
+	wantContigs := []Contig{
+		{Name: "c1", Coverage: Coverage{Length: 3, Mean: 2, Median: 3, Breadth: breadth(2, 0, 0, 3)}},
+		{Name: "c2", Coverage: Coverage{Length: 1, Mean: 10, Median: 10, Breadth: breadth(1, 1, 0, 1)}},
+	}
+	if !reflect.DeepEqual(s.Contigs, wantContigs) {
+		t.Errorf("contigs:\ngot  %+v\nwant %+v", s.Contigs, wantContigs)
+	}
+	wantCoverage := Coverage{Length: 4, Mean: 4, Median: 3, Breadth: breadth(3, 1, 0, 4)}
+	if !reflect.DeepEqual(s.Coverage, wantCoverage) {
+		t.Errorf("coverage is %+v, want %+v", s.Coverage, wantCoverage)
+	}
+}
+
+func TestComputeDepthErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		depth   string
+		wantErr string
+	}{
+		{name: "ungrouped", depth: "c1\t1\t1\nc2\t1\t1\nc1\t2\t1\n", wantErr: "line 3: positions of c1 are not grouped together"},
+		{name: "missing column", depth: "c1\t1\n", wantErr: "line 1: expected reference, position and depth"},
+		{name: "invalid depth", depth: "c1\t1\tx\n", wantErr: `line 1: invalid depth "x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ComputeDepth(strings.NewReader(tt.depth))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package bamstats
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+// ComputeDepthFile computes the coverage from a file written by
+// "samtools depth -aa".
+func ComputeDepthFile(path string) (*Stats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+
+	stats, err := ComputeDepth(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	stats.File = path
+	return stats, nil
+}
+
+// ComputeDepth computes the coverage from "samtools depth -aa" output:
+// one line per base with the reference name, position and depth. Without
+// -aa the bases that are not covered are missing and the coverage comes
+// out too high.
+func ComputeDepth(r io.Reader) (*Stats, error) {
+	s := &Stats{Source: SourceDepth}
+	total := &coverage{}
+	var (
+		acc  *coverage
+		name string
+		seen = map[string]bool{}
+	)
+	finish := func() {
+		if acc == nil {
+			return
+		}
+		total.merge(acc)
+		s.Contigs = append(s.Contigs, acc.contig(name, 0))
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := bytes.Split(bytes.TrimRight(scanner.Bytes(), "\r"), []byte("\t"))
+		if len(fields) == 1 && len(fields[0]) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("line %d: expected reference, position and depth", line)
+		}
+		depth, err := strconv.Atoi(string(fields[2]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid depth %q", line, fields[2])
+		}
+		if acc == nil || string(fields[0]) != name {
+			finish()
+			name = string(fields[0])
+			if seen[name] {
+				return nil, fmt.Errorf("line %d: positions of %s are not grouped together", line, name)
+			}
+			seen[name] = true
+			acc = &coverage{}
+		}
+		acc.add(depth, 1)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+
+	s.Coverage = total.summary()
+	return s, nil
+}
@@ -0,0 +1,634 @@
+// Package config defines the pipeline configuration file accepted by
+// "bio-assembler run --config". Files may be written in YAML or TOML; the
+// format is chosen by the file extension.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"bio-assembler/pkg/adapters"
+	"bio-assembler/pkg/fastqc"
+	"bio-assembler/pkg/pipeline"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the full set of settings for a pipeline run.
+type Config struct {
+	Resources Resources `yaml:"resources" toml:"resources"`
+	Tools     Tools     `yaml:"tools" toml:"tools"`
+	Steps     Steps     `yaml:"steps" toml:"steps"`
+}
+
+// Resources controls how much of the machine a run may use.
+type Resources struct {
+	// Threads is passed to every multi-threaded tool.
+	Threads int `yaml:"threads" toml:"threads"`
+	// Memory is the memory budget in GB for the assembler, the polishers and
+	// Qualimap.
+	Memory int `yaml:"memory" toml:"memory"`
+	// MaxParallel is the number of steps allowed to run at the same time.
+	MaxParallel int `yaml:"max_parallel" toml:"max_parallel"`
+	// TotalThreads and TotalMemory are the budget shared by all samples of
+	// a batch run. Zero means the number of CPUs and Memory respectively.
+	TotalThreads int `yaml:"total_threads" toml:"total_threads"`
+	TotalMemory  int `yaml:"total_memory" toml:"total_memory"`
+}
+
+// Tools locates external programs.
+type Tools struct {
+	// PilonJar is the path to pilon.jar.
+	PilonJar string `yaml:"pilon_jar" toml:"pilon_jar"`
+	// Paths overrides the executable used for a tool, keyed by the name the
+	// tool is normally invoked with (e.g. "spades.py", "java", "fastqc").
+	Paths map[string]string `yaml:"paths,omitempty" toml:"paths,omitempty"`
+}
+
+// Steps holds per-step options. Keys match the step names accepted by
+// --force-step and --from; the fastqc section applies to both FastQC runs.
+type Steps struct {
+	Download DownloadStep `yaml:"download" toml:"download"`
+	FastQC   FastQCStep   `yaml:"fastqc" toml:"fastqc"`
+	Trim     TrimStep     `yaml:"trim" toml:"trim"`
+	// LongReads applies to samples with long reads only, as does
+	// LongPolish.
+	LongReads LongReadsStep `yaml:"long_reads" toml:"long_reads"`
+	Assemble  AssembleStep  `yaml:"assemble" toml:"assemble"`
+	// Spades, Megahit, Skesa, Unicycler and Flye hold the options of each
+	// assembler; only the one chosen in Assemble is used.
+	Spades    SpadesStep    `yaml:"spades" toml:"spades"`
+	Megahit   MegahitStep   `yaml:"megahit" toml:"megahit"`
+	Skesa     ToolStep      `yaml:"skesa" toml:"skesa"`
+	Unicycler UnicyclerStep `yaml:"unicycler" toml:"unicycler"`
+	Flye      FlyeStep      `yaml:"flye" toml:"flye"`
+	// FilterContigs cleans up the draft assembly before it is polished.
+	FilterContigs FilterContigsStep `yaml:"filter_contigs" toml:"filter_contigs"`
+
+	LongPolish LongPolishStep `yaml:"long_polish" toml:"long_polish"`
+	MapReads   MapReadsStep   `yaml:"map_reads" toml:"map_reads"`
+	Polish     PolishStep     `yaml:"polish" toml:"polish"`
+	// Pilon, Polypolish and Polca hold the options of each polisher; only
+	// those listed in Polish are used.
+	Pilon      PilonStep      `yaml:"pilon" toml:"pilon"`
+	Polypolish PolypolishStep `yaml:"polypolish" toml:"polypolish"`
+	Polca      PolcaStep      `yaml:"polca" toml:"polca"`
+	Qualimap   QualimapStep   `yaml:"qualimap" toml:"qualimap"`
+}
+
+// ToolStep is the option set shared by steps that only wrap a tool call.
+type ToolStep struct {
+	// ExtraArgs are appended to the tool's command line.
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+// QualimapStep configures Qualimap. The built-in coverage statistics are
+// always computed, so Qualimap can be skipped where Java is unwelcome.
+type QualimapStep struct {
+	Skip      bool     `yaml:"skip" toml:"skip"`
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type FastQCStep struct {
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+	// RawGate and TrimmedGate are checked after FastQC on the raw and the
+	// trimmed reads respectively.
+	RawGate     []QCRule `yaml:"raw_gate" toml:"raw_gate"`
+	TrimmedGate []QCRule `yaml:"trimmed_gate" toml:"trimmed_gate"`
+}
+
+// QCRule reacts to a FastQC module reaching a status in any reads file.
+type QCRule struct {
+	// Module is the module name as FastQC reports it, e.g.
+	// "Per base sequence quality".
+	Module string `yaml:"module" toml:"module"`
+	// Status is "warn" or "fail"; "warn" also triggers on FAIL.
+	Status string `yaml:"status" toml:"status"`
+	// Action is "warn" to print a warning or "abort" to stop the pipeline.
+	Action string `yaml:"action" toml:"action"`
+}
+
+// Gate converts configured QC rules for the pipeline.
+func Gate(rules []QCRule) []pipeline.QCRule {
+	gate := make([]pipeline.QCRule, len(rules))
+	for i, r := range rules {
+		gate[i] = pipeline.QCRule{
+			Module: r.Module,
+			Status: fastqc.Status(strings.ToUpper(r.Status)),
+			Abort:  r.Action == "abort",
+		}
+	}
+	return gate
+}
+
+type DownloadStep struct {
+	// Fetcher is "sra-tools" (prefetch + fasterq-dump) or "ena" (direct
+	// download from the European Nucleotide Archive).
+	Fetcher string `yaml:"fetcher" toml:"fetcher"`
+	// ExtraArgs are passed to fasterq-dump.
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+	ENA       ENA      `yaml:"ena" toml:"ena"`
+}
+
+// ENA configures the "ena" fetcher.
+type ENA struct {
+	// Protocol is "https" or "ftp".
+	Protocol string `yaml:"protocol" toml:"protocol"`
+	// Retries is the number of extra attempts per file.
+	Retries int `yaml:"retries" toml:"retries"`
+	// PortalURL overrides the ENA portal API endpoint.
+	PortalURL string `yaml:"portal_url,omitempty" toml:"portal_url,omitempty"`
+}
+
+type TrimStep struct {
+	// Trimmer is "trimmomatic", "fastp" or "native".
+	Trimmer string `yaml:"trimmer" toml:"trimmer"`
+	// AdapterFasta is the adapter file used for trimming. When empty, the
+	// adapters are detected from a sample of the raw reads (or by fastp).
+	AdapterFasta string `yaml:"adapter_fasta" toml:"adapter_fasta"`
+	// AdapterSampleReads is the number of reads per file sampled by adapter
+	// detection, and AdapterMinPercent the share of them that must contain
+	// an adapter for a set to be chosen on evidence.
+	AdapterSampleReads int     `yaml:"adapter_sample_reads" toml:"adapter_sample_reads"`
+	AdapterMinPercent  float64 `yaml:"adapter_min_percent" toml:"adapter_min_percent"`
+	// Mode is one of the trimming presets: standard, strict, lenient or custom.
+	Mode string `yaml:"mode" toml:"mode"`
+	// CustomArgs are the trimming steps (Trimmomatic) or options (fastp)
+	// used when Mode is "custom".
+	CustomArgs string `yaml:"custom_args" toml:"custom_args"`
+	// ExtraArgs are additional trimmer options.
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+	// MinSurvival is the lowest acceptable percentage of reads surviving
+	// trimming (0 disables the check); OnLowSurvival is "warn" or "fail".
+	MinSurvival   float64 `yaml:"min_survival" toml:"min_survival"`
+	OnLowSurvival string  `yaml:"on_low_survival" toml:"on_low_survival"`
+}
+
+type LongReadsStep struct {
+	// Type is "nanopore", "nanopore-hq", "pacbio" or "pacbio-hifi".
+	Type string `yaml:"type" toml:"type"`
+	// MinLength and MinMeanQuality drop short and low-quality reads.
+	MinLength      int     `yaml:"min_length" toml:"min_length"`
+	MinMeanQuality float64 `yaml:"min_mean_quality" toml:"min_mean_quality"`
+	// TargetBases keeps only the best reads up to this many bases; 0 keeps
+	// all reads that pass the filters.
+	TargetBases int64 `yaml:"target_bases" toml:"target_bases"`
+}
+
+type AssembleStep struct {
+	// Assembler is "spades", "megahit", "skesa", "unicycler" or "flye".
+	Assembler string `yaml:"assembler" toml:"assembler"`
+}
+
+type SpadesStep struct {
+	// Mode is "standard", "careful", "isolate", "meta" or "plasmid".
+	Mode          string `yaml:"mode" toml:"mode"`
+	OnlyAssembler bool   `yaml:"only_assembler" toml:"only_assembler"`
+	// Kmers are the k-mer sizes to use; empty lets SPAdes choose.
+	Kmers     []int    `yaml:"kmers" toml:"kmers"`
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type MegahitStep struct {
+	// Kmers is MEGAHIT's --k-list; empty keeps its default.
+	Kmers     []int    `yaml:"kmers" toml:"kmers"`
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type UnicyclerStep struct {
+	// Mode is "conservative", "normal" or "bold".
+	Mode      string   `yaml:"mode" toml:"mode"`
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type FlyeStep struct {
+	// GenomeSize is Flye's --genome-size, e.g. "5m"; empty lets Flye
+	// estimate it.
+	GenomeSize string   `yaml:"genome_size" toml:"genome_size"`
+	ExtraArgs  []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type FilterContigsStep struct {
+	// MinLength and MinCoverage drop short contigs and contigs whose SPAdes
+	// k-mer coverage is low; 0 disables either filter.
+	MinLength   int     `yaml:"min_length" toml:"min_length"`
+	MinCoverage float64 `yaml:"min_coverage" toml:"min_coverage"`
+	// Rename renames the kept contigs to <Prefix>_1, <Prefix>_2, ...;
+	// Prefix defaults to the sample name.
+	Rename bool   `yaml:"rename" toml:"rename"`
+	Prefix string `yaml:"prefix" toml:"prefix"`
+}
+
+type LongPolishStep struct {
+	// Polisher is "auto" (Medaka for Nanopore, Racon for PacBio reads),
+	// "medaka", "racon" or "none".
+	Polisher string `yaml:"polisher" toml:"polisher"`
+	// Rounds is the number of Racon rounds.
+	Rounds int `yaml:"rounds" toml:"rounds"`
+	// MedakaModel is Medaka's -m option; empty keeps its default model.
+	MedakaModel string   `yaml:"medaka_model" toml:"medaka_model"`
+	ExtraArgs   []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type MapReadsStep struct {
+	// Aligner is "bwa", "bwa-mem2", "minimap2" or "bowtie2". It maps the
+	// reads for Pilon and Qualimap; Polypolish and POLCA map on their own.
+	Aligner string `yaml:"aligner" toml:"aligner"`
+	// MarkDuplicates flags duplicate reads with samtools markdup.
+	MarkDuplicates bool `yaml:"mark_duplicates" toml:"mark_duplicates"`
+	// ExtraArgs are passed to the aligner.
+	ExtraArgs []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type PolishStep struct {
+	// Polishers are run in order, each polishing the previous one's
+	// result: any of "pilon", "polypolish" and "polca".
+	Polishers []string `yaml:"polishers" toml:"polishers"`
+}
+
+type PilonStep struct {
+	// Fix is the value of Pilon's --fix option.
+	Fix string `yaml:"fix" toml:"fix"`
+	// Rounds is the maximum number of Pilon rounds. Polishing stops
+	// earlier once a round makes at most ConvergeAt changes.
+	Rounds     int      `yaml:"rounds" toml:"rounds"`
+	ConvergeAt int      `yaml:"converge_at" toml:"converge_at"`
+	ExtraArgs  []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type PolypolishStep struct {
+	// Careful is Polypolish's --careful option, which leaves repeats alone.
+	Careful bool `yaml:"careful" toml:"careful"`
+	// Rounds and ConvergeAt work as in PilonStep.
+	Rounds     int      `yaml:"rounds" toml:"rounds"`
+	ConvergeAt int      `yaml:"converge_at" toml:"converge_at"`
+	ExtraArgs  []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+type PolcaStep struct {
+	// Rounds and ConvergeAt work as in PilonStep.
+	Rounds     int      `yaml:"rounds" toml:"rounds"`
+	ConvergeAt int      `yaml:"converge_at" toml:"converge_at"`
+	ExtraArgs  []string `yaml:"extra_args" toml:"extra_args"`
+}
+
+// Default returns the configuration used when no file is given. It matches
+// the behaviour of the pipeline before configuration files existed.
+func Default() *Config {
+	return &Config{
+		Resources: Resources{
+			Threads:     4,
+			Memory:      16,
+			MaxParallel: 2,
+		},
+		Steps: Steps{
+			Download: DownloadStep{
+				Fetcher:   "sra-tools",
+				ExtraArgs: []string{},
+				ENA: ENA{
+					Protocol: "https",
+					Retries:  5,
+				},
+			},
+			FastQC: FastQCStep{
+				ExtraArgs: []string{},
+				RawGate:   []QCRule{},
+				TrimmedGate: []QCRule{
+					{Module: fastqc.PerBaseQuality, Status: "fail", Action: "warn"},
+				},
+			},
+			Trim: TrimStep{
+				Trimmer:            "trimmomatic",
+				Mode:               "standard",
+				ExtraArgs:          []string{},
+				MinSurvival:        50,
+				OnLowSurvival:      "warn",
+				AdapterSampleReads: adapters.DefaultSampleReads,
+				AdapterMinPercent:  adapters.DefaultMinPercent,
+			},
+			LongReads: LongReadsStep{
+				Type:           "nanopore",
+				MinLength:      1000,
+				MinMeanQuality: 7,
+			},
+			Assemble: AssembleStep{Assembler: "spades"},
+			Spades: SpadesStep{
+				Mode:          "careful",
+				OnlyAssembler: true,
+				Kmers:         []int{},
+				ExtraArgs:     []string{},
+			},
+			Megahit: MegahitStep{
+				Kmers:     []int{},
+				ExtraArgs: []string{},
+			},
+			Skesa: ToolStep{ExtraArgs: []string{}},
+			Unicycler: UnicyclerStep{
+				Mode:      "normal",
+				ExtraArgs: []string{},
+			},
+			Flye: FlyeStep{ExtraArgs: []string{}},
+			LongPolish: LongPolishStep{
+				Polisher:  "auto",
+				Rounds:    1,
+				ExtraArgs: []string{},
+			},
+			MapReads: MapReadsStep{
+				Aligner:   "bwa",
+				ExtraArgs: []string{},
+			},
+			Polish: PolishStep{Polishers: []string{"pilon"}},
+			Pilon: PilonStep{
+				Fix:       "snps,indels",
+				Rounds:    1,
+				ExtraArgs: []string{},
+			},
+			Polypolish: PolypolishStep{
+				Rounds:    1,
+				ExtraArgs: []string{},
+			},
+			Polca: PolcaStep{
+				Rounds:    1,
+				ExtraArgs: []string{},
+			},
+			Qualimap: QualimapStep{ExtraArgs: []string{}},
+		},
+	}
+}
+
+// Load reads a configuration file on top of the defaults, so a file only
+// needs to mention the settings it changes. Unknown keys are rejected to
+// catch typos.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	cfg := Default()
+	switch format := formatOf(path); format {
+	case "toml":
+		md, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, k := range undecoded {
+				keys[i] = k.String()
+			}
+			return nil, fmt.Errorf("failed to parse %s: unknown keys: %s", path, strings.Join(keys, ", "))
+		}
+	case "yaml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (expected .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+	cfg.resolvePaths(filepath.Dir(path))
+	return cfg, nil
+}
+
+// resolvePaths makes the relative file paths of a configuration file
+// relative to dir, the file's directory, like those of a sample sheet.
+// Tool paths without a slash name programs looked up in PATH and are left
+// alone.
+func (c *Config) resolvePaths(dir string) {
+	resolve := func(p string) string {
+		if p == "" || filepath.IsAbs(p) {
+			return p
+		}
+		return filepath.Join(dir, p)
+	}
+	c.Tools.PilonJar = resolve(c.Tools.PilonJar)
+	for name, p := range c.Tools.Paths {
+		if strings.ContainsRune(filepath.ToSlash(p), '/') {
+			c.Tools.Paths[name] = resolve(p)
+		}
+	}
+	c.Steps.Trim.AdapterFasta = resolve(c.Steps.Trim.AdapterFasta)
+}
+
+// formatOf derives the configuration format from a file name.
+func formatOf(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return ""
+}
+
+// Validate checks the configuration for values the pipeline cannot run
+// with. Settings that are allowed to be supplied later on the command line,
+// such as the Pilon jar, are only checked when present.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Resources.Threads < 1 {
+		errs = append(errs, fmt.Errorf("resources.threads must be at least 1, got %d", c.Resources.Threads))
+	}
+	if c.Resources.Memory < 1 {
+		errs = append(errs, fmt.Errorf("resources.memory must be at least 1 (GB), got %d", c.Resources.Memory))
+	}
+	if c.Resources.MaxParallel < 1 {
+		errs = append(errs, fmt.Errorf("resources.max_parallel must be at least 1, got %d", c.Resources.MaxParallel))
+	}
+	if c.Resources.TotalThreads < 0 {
+		errs = append(errs, fmt.Errorf("resources.total_threads must not be negative, got %d", c.Resources.TotalThreads))
+	}
+	if c.Resources.TotalMemory < 0 {
+		errs = append(errs, fmt.Errorf("resources.total_memory must not be negative, got %d", c.Resources.TotalMemory))
+	}
+
+	if c.Tools.PilonJar != "" {
+		if _, err := os.Stat(c.Tools.PilonJar); err != nil {
+			errs = append(errs, fmt.Errorf("tools.pilon_jar: %w", err))
+		}
+	}
+	for name, path := range c.Tools.Paths {
+		if path == "" {
+			errs = append(errs, fmt.Errorf("tools.paths.%s is empty", name))
+		}
+	}
+
+	download := c.Steps.Download
+	if !slices.Contains(pipeline.Fetchers, download.Fetcher) {
+		errs = append(errs, fmt.Errorf("steps.download.fetcher must be one of %s, got %q", strings.Join(pipeline.Fetchers, ", "), download.Fetcher))
+	}
+	if download.ENA.Protocol != "https" && download.ENA.Protocol != "ftp" {
+		errs = append(errs, fmt.Errorf("steps.download.ena.protocol must be https or ftp, got %q", download.ENA.Protocol))
+	}
+	if download.ENA.Retries < 0 {
+		errs = append(errs, fmt.Errorf("steps.download.ena.retries must not be negative, got %d", download.ENA.Retries))
+	}
+
+	for _, gate := range []struct {
+		key   string
+		rules []QCRule
+	}{
+		{"raw_gate", c.Steps.FastQC.RawGate},
+		{"trimmed_gate", c.Steps.FastQC.TrimmedGate},
+	} {
+		for i, r := range gate.rules {
+			key := fmt.Sprintf("steps.fastqc.%s[%d]", gate.key, i)
+			if !slices.Contains(fastqc.Modules, r.Module) {
+				errs = append(errs, fmt.Errorf("%s.module must be a FastQC module name, got %q", key, r.Module))
+			}
+			if r.Status != "warn" && r.Status != "fail" {
+				errs = append(errs, fmt.Errorf("%s.status must be warn or fail, got %q", key, r.Status))
+			}
+			if r.Action != "warn" && r.Action != "abort" {
+				errs = append(errs, fmt.Errorf("%s.action must be warn or abort, got %q", key, r.Action))
+			}
+		}
+	}
+
+	trim := c.Steps.Trim
+	if trim.AdapterFasta != "" {
+		if _, err := os.Stat(trim.AdapterFasta); err != nil {
+			errs = append(errs, fmt.Errorf("steps.trim.adapter_fasta: %w", err))
+		}
+	}
+	if !slices.Contains(pipeline.Trimmers, trim.Trimmer) {
+		errs = append(errs, fmt.Errorf("steps.trim.trimmer must be one of %s, got %q", strings.Join(pipeline.Trimmers, ", "), trim.Trimmer))
+	}
+	if !slices.Contains(pipeline.TrimModes, trim.Mode) {
+		errs = append(errs, fmt.Errorf("steps.trim.mode must be one of %s, got %q", strings.Join(pipeline.TrimModes, ", "), trim.Mode))
+	}
+	if trim.Mode == "custom" && strings.TrimSpace(trim.CustomArgs) == "" {
+		errs = append(errs, fmt.Errorf("steps.trim.custom_args is required when steps.trim.mode is \"custom\""))
+	}
+	if trim.AdapterSampleReads < 1 {
+		errs = append(errs, fmt.Errorf("steps.trim.adapter_sample_reads must be at least 1, got %d", trim.AdapterSampleReads))
+	}
+	if trim.AdapterMinPercent < 0 || trim.AdapterMinPercent > 100 {
+		errs = append(errs, fmt.Errorf("steps.trim.adapter_min_percent must be a percentage between 0 and 100, got %g", trim.AdapterMinPercent))
+	}
+	if trim.MinSurvival < 0 || trim.MinSurvival > 100 {
+		errs = append(errs, fmt.Errorf("steps.trim.min_survival must be a percentage between 0 and 100, got %g", trim.MinSurvival))
+	}
+	if trim.OnLowSurvival != "warn" && trim.OnLowSurvival != "fail" {
+		errs = append(errs, fmt.Errorf("steps.trim.on_low_survival must be warn or fail, got %q", trim.OnLowSurvival))
+	}
+	long := c.Steps.LongReads
+	if !slices.Contains(pipeline.LongReadTypes, long.Type) {
+		errs = append(errs, fmt.Errorf("steps.long_reads.type must be one of %s, got %q", strings.Join(pipeline.LongReadTypes, ", "), long.Type))
+	}
+	if long.MinLength < 0 {
+		errs = append(errs, fmt.Errorf("steps.long_reads.min_length must not be negative, got %d", long.MinLength))
+	}
+	if long.MinMeanQuality < 0 {
+		errs = append(errs, fmt.Errorf("steps.long_reads.min_mean_quality must not be negative, got %g", long.MinMeanQuality))
+	}
+	if long.TargetBases < 0 {
+		errs = append(errs, fmt.Errorf("steps.long_reads.target_bases must not be negative, got %d", long.TargetBases))
+	}
+	if !slices.Contains(pipeline.Assemblers, c.Steps.Assemble.Assembler) {
+		errs = append(errs, fmt.Errorf("steps.assemble.assembler must be one of %s, got %q", strings.Join(pipeline.Assemblers, ", "), c.Steps.Assemble.Assembler))
+	}
+	if !slices.Contains(pipeline.SpadesModes, c.Steps.Spades.Mode) {
+		errs = append(errs, fmt.Errorf("steps.spades.mode must be one of %s, got %q", strings.Join(pipeline.SpadesModes, ", "), c.Steps.Spades.Mode))
+	}
+	// SPAdes takes odd k-mer sizes below 128, MEGAHIT odd sizes from 15 to
+	// 255; both want them in increasing order.
+	errs = append(errs, checkKmers("steps.spades.kmers", c.Steps.Spades.Kmers, 1, 127)...)
+	errs = append(errs, checkKmers("steps.megahit.kmers", c.Steps.Megahit.Kmers, 15, 255)...)
+	if !slices.Contains(pipeline.UnicyclerModes, c.Steps.Unicycler.Mode) {
+		errs = append(errs, fmt.Errorf("steps.unicycler.mode must be one of %s, got %q", strings.Join(pipeline.UnicyclerModes, ", "), c.Steps.Unicycler.Mode))
+	}
+	filter := c.Steps.FilterContigs
+	if filter.MinLength < 0 {
+		errs = append(errs, fmt.Errorf("steps.filter_contigs.min_length must not be negative, got %d", filter.MinLength))
+	}
+	if filter.MinCoverage < 0 {
+		errs = append(errs, fmt.Errorf("steps.filter_contigs.min_coverage must not be negative, got %g", filter.MinCoverage))
+	}
+	if strings.ContainsAny(filter.Prefix, " \t>") {
+		errs = append(errs, fmt.Errorf("steps.filter_contigs.prefix must not contain spaces, tabs or '>', got %q", filter.Prefix))
+	}
+	polish := c.Steps.LongPolish
+	if !slices.Contains(pipeline.LongPolishers, polish.Polisher) {
+		errs = append(errs, fmt.Errorf("steps.long_polish.polisher must be one of %s, got %q", strings.Join(pipeline.LongPolishers, ", "), polish.Polisher))
+	} else if pipeline.LongPolisherFor(polish.Polisher, long.Type) == "medaka" && !strings.HasPrefix(long.Type, "nanopore") {
+		errs = append(errs, fmt.Errorf("steps.long_polish.polisher medaka needs Nanopore reads, but steps.long_reads.type is %q", long.Type))
+	}
+	if polish.Rounds < 1 {
+		errs = append(errs, fmt.Errorf("steps.long_polish.rounds must be at least 1, got %d", polish.Rounds))
+	}
+	if !slices.Contains(pipeline.Aligners, c.Steps.MapReads.Aligner) {
+		errs = append(errs, fmt.Errorf("steps.map_reads.aligner must be one of %s, got %q", strings.Join(pipeline.Aligners, ", "), c.Steps.MapReads.Aligner))
+	}
+	if len(c.Steps.Polish.Polishers) == 0 {
+		errs = append(errs, fmt.Errorf("steps.polish.polishers must name at least one polisher"))
+	}
+	for _, name := range c.Steps.Polish.Polishers {
+		if !slices.Contains(pipeline.Polishers, name) {
+			errs = append(errs, fmt.Errorf("steps.polish.polishers must only contain %s, got %q", strings.Join(pipeline.Polishers, ", "), name))
+		}
+	}
+	if c.Steps.Pilon.Fix == "" {
+		errs = append(errs, fmt.Errorf("steps.pilon.fix must not be empty"))
+	}
+	errs = append(errs, checkRounds("steps.pilon", c.Steps.Pilon.Rounds, c.Steps.Pilon.ConvergeAt)...)
+	errs = append(errs, checkRounds("steps.polypolish", c.Steps.Polypolish.Rounds, c.Steps.Polypolish.ConvergeAt)...)
+	errs = append(errs, checkRounds("steps.polca", c.Steps.Polca.Rounds, c.Steps.Polca.ConvergeAt)...)
+
+	return errors.Join(errs...)
+}
+
+func checkRounds(key string, rounds, convergeAt int) []error {
+	var errs []error
+	if rounds < 1 {
+		errs = append(errs, fmt.Errorf("%s.rounds must be at least 1, got %d", key, rounds))
+	}
+	if convergeAt < 0 {
+		errs = append(errs, fmt.Errorf("%s.converge_at must not be negative, got %d", key, convergeAt))
+	}
+	return errs
+}
+
+func checkKmers(key string, kmers []int, lo, hi int) []error {
+	var errs []error
+	for i, k := range kmers {
+		if k%2 == 0 || k < lo || k > hi {
+			errs = append(errs, fmt.Errorf("%s must be odd numbers from %d to %d, got %d", key, lo, hi, k))
+		} else if i > 0 && k <= kmers[i-1] {
+			errs = append(errs, fmt.Errorf("%s must be in increasing order, got %d after %d", key, k, kmers[i-1]))
+		}
+	}
+	return errs
+}
+
+// Encode renders the configuration in the given format ("yaml" or "toml").
+func (c *Config) Encode(format string) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "yaml":
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(c); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+	case "toml":
+		if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config format %q (expected yaml or toml)", format)
+	}
+	return buf.Bytes(), nil
+}
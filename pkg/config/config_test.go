@@ -0,0 +1,63 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadResolvesRelativePaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"pilon.jar", "adapters/TruSeq3-PE.fa"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := filepath.Join(dir, "pipeline.yaml")
+	data := `tools:
+  pilon_jar: pilon.jar
+  paths:
+    spades.py: bin/spades.py
+    java: java
+    fastqc: /opt/fastqc/fastqc
+steps:
+  trim:
+    adapter_fasta: adapters/TruSeq3-PE.fa
+`
+	if err := os.WriteFile(config, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Load from another directory, as "config validate" would.
+	t.Chdir(t.TempDir())
+	cfg, err := Load(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"tools.pilon_jar":          filepath.Join(dir, "pilon.jar"),
+		"tools.paths.spades.py":    filepath.Join(dir, "bin/spades.py"),
+		"tools.paths.java":         "java",
+		"tools.paths.fastqc":       "/opt/fastqc/fastqc",
+		"steps.trim.adapter_fasta": filepath.Join(dir, "adapters/TruSeq3-PE.fa"),
+	}
+	got := map[string]string{
+		"tools.pilon_jar":          cfg.Tools.PilonJar,
+		"tools.paths.spades.py":    cfg.Tools.Paths["spades.py"],
+		"tools.paths.java":         cfg.Tools.Paths["java"],
+		"tools.paths.fastqc":       cfg.Tools.Paths["fastqc"],
+		"steps.trim.adapter_fasta": cfg.Steps.Trim.AdapterFasta,
+	}
+	for key, w := range want {
+		if got[key] != w {
+			t.Errorf("%s = %q, want %q", key, got[key], w)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("configuration with relative paths is invalid: %v", err)
+	}
+}
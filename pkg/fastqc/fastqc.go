@@ -0,0 +1,334 @@
+// Package fastqc reads the results FastQC stores in its <name>_fastqc.zip
+// archives, so QC outcomes can be used by the pipeline and the report
+// instead of only being viewed in the HTML files.
+package fastqc
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Status is the outcome FastQC assigns to a module.
+type Status string
+
+const (
+	Pass Status = "PASS"
+	Warn Status = "WARN"
+	Fail Status = "FAIL"
+)
+
+// Module names as they appear in summary.txt and fastqc_data.txt.
+const (
+	BasicStatistics       = "Basic Statistics"
+	PerBaseQuality        = "Per base sequence quality"
+	PerTileQuality        = "Per tile sequence quality"
+	PerSequenceQuality    = "Per sequence quality scores"
+	PerBaseContent        = "Per base sequence content"
+	PerSequenceGCContent  = "Per sequence GC content"
+	PerBaseNContent       = "Per base N content"
+	SequenceLengthDistrib = "Sequence Length Distribution"
+	SequenceDuplication   = "Sequence Duplication Levels"
+	OverrepresentedSeqs   = "Overrepresented sequences"
+	AdapterContent        = "Adapter Content"
+	KmerContent           = "Kmer Content"
+)
+
+// Modules lists every module FastQC can report, in report order.
+var Modules = []string{
+	BasicStatistics, PerBaseQuality, PerTileQuality, PerSequenceQuality,
+	PerBaseContent, PerSequenceGCContent, PerBaseNContent, SequenceLengthDistrib,
+	SequenceDuplication, OverrepresentedSeqs, AdapterContent, KmerContent,
+}
+
+// Rank orders statuses by severity: PASS < WARN < FAIL. Unknown statuses
+// rank lowest.
+func (s Status) Rank() int {
+	switch s {
+	case Warn:
+		return 1
+	case Fail:
+		return 2
+	}
+	return 0
+}
+
+// Module is one line of summary.txt.
+type Module struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+}
+
+// BaseQuality is one row of the "Per base sequence quality" module. Base is
+// a position or a range such as "10-14".
+type BaseQuality struct {
+	Base          string  `json:"base"`
+	Mean          float64 `json:"mean"`
+	Median        float64 `json:"median"`
+	LowerQuartile float64 `json:"lower_quartile"`
+	UpperQuartile float64 `json:"upper_quartile"`
+	Percentile10  float64 `json:"percentile_10"`
+	Percentile90  float64 `json:"percentile_90"`
+}
+
+// AdapterPosition is one row of the "Adapter Content" module: the
+// cumulative percentage of reads containing each adapter up to Position,
+// in the order of AdapterTable.Adapters.
+type AdapterPosition struct {
+	Position string    `json:"position"`
+	Percent  []float64 `json:"percent"`
+}
+
+// AdapterTable is the table of the "Adapter Content" module.
+type AdapterTable struct {
+	Adapters  []string          `json:"adapters"`
+	Positions []AdapterPosition `json:"positions"`
+}
+
+// Max returns the adapter with the highest percentage at any position.
+func (a *AdapterTable) Max() (adapter string, percent float64) {
+	for _, row := range a.Positions {
+		for i, p := range row.Percent {
+			if p > percent && i < len(a.Adapters) {
+				adapter, percent = a.Adapters[i], p
+			}
+		}
+	}
+	return adapter, percent
+}
+
+// Overrepresented is one row of the "Overrepresented sequences" module.
+type Overrepresented struct {
+	Sequence   string  `json:"sequence"`
+	Count      int64   `json:"count"`
+	Percentage float64 `json:"percentage"`
+	Source     string  `json:"possible_source"`
+}
+
+// Result is the parsed content of one FastQC archive.
+type Result struct {
+	// Filename is the name of the analysed reads file.
+	Filename        string            `json:"filename"`
+	Encoding        string            `json:"encoding"`
+	TotalSequences  int64             `json:"total_sequences"`
+	SequenceLength  string            `json:"sequence_length"`
+	GCPercent       int               `json:"gc_percent"`
+	Modules         []Module          `json:"modules"`
+	PerBaseQuality  []BaseQuality     `json:"per_base_quality,omitempty"`
+	AdapterContent  *AdapterTable     `json:"adapter_content,omitempty"`
+	Overrepresented []Overrepresented `json:"overrepresented_sequences,omitempty"`
+}
+
+// Status returns the status of the named module, or "" if FastQC did not
+// run it.
+func (r *Result) Status(module string) Status {
+	for _, m := range r.Modules {
+		if m.Name == module {
+			return m.Status
+		}
+	}
+	return ""
+}
+
+// WithStatus lists the modules that ended with the given status.
+func (r *Result) WithStatus(status Status) []string {
+	var names []string
+	for _, m := range r.Modules {
+		if m.Status == status {
+			names = append(names, m.Name)
+		}
+	}
+	return names
+}
+
+// ParseZip reads summary.txt and fastqc_data.txt from a FastQC archive.
+func ParseZip(path string) (*Result, error) {
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer zr.Close()
+
+	var summary, data *zip.File
+	for _, f := range zr.File {
+		switch filepath.Base(f.Name) {
+		case "summary.txt":
+			summary = f
+		case "fastqc_data.txt":
+			data = f
+		}
+	}
+	if summary == nil || data == nil {
+		return nil, fmt.Errorf("%s does not look like a FastQC archive (summary.txt or fastqc_data.txt missing)", path)
+	}
+
+	res := &Result{}
+	if err := readZipFile(summary, func(r io.Reader) error { return parseSummary(r, res) }); err != nil {
+		return nil, fmt.Errorf("failed to parse summary.txt in %s: %w", path, err)
+	}
+	if err := readZipFile(data, func(r io.Reader) error { return parseData(r, res) }); err != nil {
+		return nil, fmt.Errorf("failed to parse fastqc_data.txt in %s: %w", path, err)
+	}
+	return res, nil
+}
+
+func readZipFile(f *zip.File, parse func(io.Reader) error) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return parse(rc)
+}
+
+// parseSummary reads the "STATUS<tab>Module<tab>Filename" lines of
+// summary.txt.
+func parseSummary(r io.Reader, res *Result) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimRight(scanner.Text(), "\r"), "\t")
+		if len(fields) < 2 {
+			continue
+		}
+		res.Modules = append(res.Modules, Module{Name: fields[1], Status: Status(fields[0])})
+		if len(fields) > 2 && res.Filename == "" {
+			res.Filename = fields[2]
+		}
+	}
+	return scanner.Err()
+}
+
+// parseData walks the ">>Module<tab>status ... >>END_MODULE" sections of
+// fastqc_data.txt and hands the rows of each section to its parser.
+func parseData(r io.Reader, res *Result) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	module := ""
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		switch {
+		case line == ">>END_MODULE":
+			module = ""
+			continue
+		case strings.HasPrefix(line, ">>"):
+			module, _, _ = strings.Cut(line[2:], "\t")
+			continue
+		case module == AdapterContent && strings.HasPrefix(line, "#"):
+			// The header names the adapters of the columns.
+			res.AdapterContent = &AdapterTable{Adapters: strings.Split(line, "\t")[1:]}
+			continue
+		case module == "" || strings.HasPrefix(line, "#") || line == "":
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		var err error
+		switch module {
+		case BasicStatistics:
+			err = parseBasicStatistics(fields, res)
+		case PerBaseQuality:
+			err = parseBaseQuality(fields, res)
+		case AdapterContent:
+			err = parseAdapterContent(fields, res)
+		case OverrepresentedSeqs:
+			err = parseOverrepresented(fields, res)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", module, err)
+		}
+	}
+	return scanner.Err()
+}
+
+func parseBasicStatistics(fields []string, res *Result) error {
+	if len(fields) < 2 {
+		return nil
+	}
+	var err error
+	switch fields[0] {
+	case "Filename":
+		res.Filename = fields[1]
+	case "Encoding":
+		res.Encoding = fields[1]
+	case "Total Sequences":
+		res.TotalSequences, err = strconv.ParseInt(fields[1], 10, 64)
+	case "Sequence length":
+		res.SequenceLength = fields[1]
+	case "%GC":
+		res.GCPercent, err = strconv.Atoi(fields[1])
+	}
+	return err
+}
+
+func parseBaseQuality(fields []string, res *Result) error {
+	if len(fields) < 7 {
+		return fmt.Errorf("expected 7 columns, got %d", len(fields))
+	}
+	values, err := parseFloats(fields[1:7])
+	if err != nil {
+		return err
+	}
+	res.PerBaseQuality = append(res.PerBaseQuality, BaseQuality{
+		Base:          fields[0],
+		Mean:          values[0],
+		Median:        values[1],
+		LowerQuartile: values[2],
+		UpperQuartile: values[3],
+		Percentile10:  values[4],
+		Percentile90:  values[5],
+	})
+	return nil
+}
+
+func parseAdapterContent(fields []string, res *Result) error {
+	if res.AdapterContent == nil {
+		return fmt.Errorf("table has no header")
+	}
+	values, err := parseFloats(fields[1:])
+	if err != nil {
+		return err
+	}
+	res.AdapterContent.Positions = append(res.AdapterContent.Positions, AdapterPosition{Position: fields[0], Percent: values})
+	return nil
+}
+
+func parseOverrepresented(fields []string, res *Result) error {
+	if len(fields) < 4 {
+		return fmt.Errorf("expected 4 columns, got %d", len(fields))
+	}
+	count, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid count %q", fields[1])
+	}
+	pct, err := strconv.ParseFloat(fields[2], 64)
+	if err != nil {
+		return fmt.Errorf("invalid percentage %q", fields[2])
+	}
+	res.Overrepresented = append(res.Overrepresented, Overrepresented{
+		Sequence:   fields[0],
+		Count:      count,
+		Percentage: pct,
+		Source:     fields[3],
+	})
+	return nil
+}
+
+// parseFloats parses table cells, treating FastQC's "NaN" as zero.
+func parseFloats(cells []string) ([]float64, error) {
+	values := make([]float64, len(cells))
+	for i, c := range cells {
+		if c == "NaN" {
+			continue
+		}
+		v, err := strconv.ParseFloat(c, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", c)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,178 @@
+package fastqc
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeArchive packs the given files into a FastQC-style archive, under
+// the <name>_fastqc/ directory FastQC uses.
+func writeArchive(t *testing.T, files map[string]string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "SRR1_1_fastqc.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw := zip.NewWriter(f)
+	for name, content := range files {
+		w, err := zw.Create("SRR1_1_fastqc/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseZip(t *testing.T) {
+	path := writeArchive(t, map[string]string{
+		"summary.txt":        readFixture(t, "summary.txt"),
+		"fastqc_data.txt":    readFixture(t, "fastqc_data.txt"),
+		"fastqc_report.html": "<html></html>",
+	})
+	res, err := ParseZip(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Filename != "SRR1_1.fastq.gz" || res.Encoding != "Sanger / Illumina 1.9" ||
+		res.TotalSequences != 250000 || res.SequenceLength != "35-151" || res.GCPercent != 51 {
+		t.Errorf("basic statistics: got %+v", res)
+	}
+
+	if len(res.Modules) != 10 {
+		t.Fatalf("got %d modules, want 10", len(res.Modules))
+	}
+	statuses := map[string]Status{
+		BasicStatistics: Pass,
+		PerBaseQuality:  Fail,
+		PerBaseContent:  Warn,
+		AdapterContent:  Fail,
+		KmerContent:     "",
+	}
+	for module, want := range statuses {
+		if got := res.Status(module); got != want {
+			t.Errorf("status of %s is %q, want %q", module, got, want)
+		}
+	}
+	if got, want := res.WithStatus(Fail), []string{PerBaseQuality, AdapterContent}; !reflect.DeepEqual(got, want) {
+		t.Errorf("failed modules are %q, want %q", got, want)
+	}
+
+	wantQuality := []BaseQuality{
+		{Base: "1", Mean: 32.51, Median: 33, LowerQuartile: 33, UpperQuartile: 34, Percentile10: 31, Percentile90: 34},
+		{Base: "2", Mean: 32.73, Median: 34, LowerQuartile: 33, UpperQuartile: 34, Percentile10: 31, Percentile90: 34},
+		{Base: "10-14", Mean: 36.02, Median: 37, LowerQuartile: 35, UpperQuartile: 38, Percentile10: 33, Percentile90: 38},
+		// FastQC writes NaN for positions too few reads reach.
+		{Base: "150-151", Mean: 0, Median: 21, LowerQuartile: 12, UpperQuartile: 30, Percentile10: 2, Percentile90: 34},
+	}
+	if !reflect.DeepEqual(res.PerBaseQuality, wantQuality) {
+		t.Errorf("per base quality:\ngot  %+v\nwant %+v", res.PerBaseQuality, wantQuality)
+	}
+
+	if res.AdapterContent == nil {
+		t.Fatal("no adapter content")
+	}
+	if len(res.AdapterContent.Adapters) != 4 || res.AdapterContent.Adapters[0] != "Illumina Universal Adapter" {
+		t.Errorf("adapters are %q", res.AdapterContent.Adapters)
+	}
+	if len(res.AdapterContent.Positions) != 4 {
+		t.Errorf("got %d adapter content rows, want 4", len(res.AdapterContent.Positions))
+	}
+	if adapter, pct := res.AdapterContent.Max(); adapter != "Illumina Universal Adapter" || pct != 12.4 {
+		t.Errorf("highest adapter content is %.2f%% %s", pct, adapter)
+	}
+
+	wantOver := []Overrepresented{
+		{Sequence: "AGATCGGAAGAGCACACGTCTGAACTCCAGTCACATCACGATCTCGTATG", Count: 812, Percentage: 0.3248, Source: "TruSeq Adapter, Index 1 (97% over 36bp)"},
+		{Sequence: "GGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGGG", Count: 301, Percentage: 0.1204, Source: "No Hit"},
+	}
+	if !reflect.DeepEqual(res.Overrepresented, wantOver) {
+		t.Errorf("overrepresented sequences:\ngot  %+v\nwant %+v", res.Overrepresented, wantOver)
+	}
+}
+
+func TestParseZipCRLF(t *testing.T) {
+	crlf := func(s string) string { return strings.ReplaceAll(s, "\n", "\r\n") }
+	path := writeArchive(t, map[string]string{
+		"summary.txt":     crlf(readFixture(t, "summary.txt")),
+		"fastqc_data.txt": crlf(readFixture(t, "fastqc_data.txt")),
+	})
+	res, err := ParseZip(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Filename != "SRR1_1.fastq.gz" || res.GCPercent != 51 || res.Status(AdapterContent) != Fail {
+		t.Errorf("CRLF archive parsed as %+v", res)
+	}
+}
+
+func TestParseZipErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "no summary",
+			files:   map[string]string{"fastqc_data.txt": ""},
+			wantErr: "does not look like a FastQC archive",
+		},
+		{
+			name: "bad quality row",
+			files: map[string]string{
+				"summary.txt":     "",
+				"fastqc_data.txt": ">>Per base sequence quality\tpass\n1\t32.5\t33.0\n>>END_MODULE\n",
+			},
+			wantErr: "expected 7 columns",
+		},
+		{
+			name: "bad number",
+			files: map[string]string{
+				"summary.txt":     "",
+				"fastqc_data.txt": ">>Per base sequence quality\tpass\n1\t32.5\tx\t33\t34\t31\t34\n>>END_MODULE\n",
+			},
+			wantErr: `invalid number "x"`,
+		},
+		{
+			name: "adapter rows without header",
+			files: map[string]string{
+				"summary.txt":     "",
+				"fastqc_data.txt": ">>Adapter Content\tpass\n1\t0.0\n>>END_MODULE\n",
+			},
+			wantErr: "table has no header",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseZip(writeArchive(t, tt.files))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := ParseZip(filepath.Join(t.TempDir(), "missing.zip")); err == nil {
+		t.Error("missing archive accepted")
+	}
+}
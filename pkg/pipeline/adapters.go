@@ -0,0 +1,86 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"bio-assembler/pkg/adapters"
+)
+
+const (
+	adapterFastaFile     = "adapters.fa"
+	adapterDetectionFile = "adapter_detection.json"
+)
+
+// DetectAdaptersStep chooses the adapter file for trimming from a sample of
+// the raw reads. It writes the chosen bundled FASTA to adapters.fa in
+// Output, and the decision with the per-set evidence to
+// adapter_detection.json.
+type DetectAdaptersStep struct {
+	InputFq1 string
+	// InputFq2 is empty for single-end libraries.
+	InputFq2 string
+	Output   string
+	// SampleReads is the number of reads sampled from each file and
+	// MinPercent the share of them that must carry an adapter.
+	SampleReads int
+	MinPercent  float64
+}
+
+func (s *DetectAdaptersStep) Name() string {
+	return "Adapter Detection"
+}
+
+func (s *DetectAdaptersStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:    s.Output,
+		Inputs: nonEmpty(s.InputFq1, s.InputFq2),
+		Params: map[string]string{
+			"sample_reads": fmt.Sprintf("%d", s.SampleReads),
+			"min_percent":  fmt.Sprintf("%g", s.MinPercent),
+		},
+		ToolVersion: "builtin",
+		Outputs: []string{
+			filepath.Join(s.Output, adapterFastaFile),
+			filepath.Join(s.Output, adapterDetectionFile),
+		},
+	}, nil
+}
+
+func (s *DetectAdaptersStep) Run(ctx context.Context) error {
+	fmt.Println("Detecting adapters in the raw reads...")
+	inputs := nonEmpty(s.InputFq1, s.InputFq2)
+	d, err := adapters.Detect(inputs, len(inputs) == 2, s.SampleReads, s.MinPercent)
+	if err != nil {
+		return fmt.Errorf("adapter detection failed: %w", err)
+	}
+	set, err := adapters.Lookup(d.Chosen)
+	if err != nil {
+		return err
+	}
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+	if err := os.WriteFile(stage.path(adapterFastaFile), set.Data, 0644); err != nil {
+		return fmt.Errorf("failed to write adapter FASTA: %w", err)
+	}
+	data, err := json.MarshalIndent(d, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode adapter detection: %w", err)
+	}
+	if err := os.WriteFile(stage.path(adapterDetectionFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write adapter detection: %w", err)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Adapter set %s chosen: %s.\n", d.Chosen, d.Reason)
+	return nil
+}
@@ -0,0 +1,304 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// MappedBamFile is the sorted, indexed alignment written by MapReadsStep.
+const MappedBamFile = "mapped_reads.sorted.bam"
+
+// Aligners lists the names accepted by NewAligner.
+var Aligners = []string{"bwa", "bwa-mem2", "minimap2", "bowtie2"}
+
+// AlignJob is one aligner invocation.
+type AlignJob struct {
+	Reference string
+	// Reads2 is empty for single-end libraries.
+	Reads1, Reads2 string
+	Threads        int
+}
+
+func (j *AlignJob) singleEnd() bool {
+	return j.Reads2 == ""
+}
+
+// Aligner maps short reads to an assembly.
+type Aligner interface {
+	Name() string
+	Version(ctx context.Context) string
+	// Args are the options that shape the alignment, excluding resources
+	// and file paths. They are part of the fingerprint of the steps using
+	// the aligner.
+	Args() []string
+	// Index prepares reference for alignment, writing the index next to it.
+	Index(ctx context.Context, reference string, threads int) error
+	// IndexFiles lists the files Index writes for reference.
+	IndexFiles(reference string) []string
+	// Command returns the command that aligns the job's reads and writes
+	// SAM to stdout.
+	Command(ctx context.Context, job *AlignJob) *exec.Cmd
+}
+
+// AlignerOptions configures the aligners created by NewAligner; only the
+// options of the chosen aligner are used.
+type AlignerOptions struct {
+	Tools     Tools
+	ExtraArgs []string
+}
+
+// NewAligner returns the aligner registered under name.
+func NewAligner(name string, opts AlignerOptions) (Aligner, error) {
+	switch name {
+	case "", "bwa":
+		return &BwaAligner{Tools: opts.Tools, ExtraArgs: opts.ExtraArgs}, nil
+	case "bwa-mem2":
+		return &BwaAligner{Tools: opts.Tools, Mem2: true, ExtraArgs: opts.ExtraArgs}, nil
+	case "minimap2":
+		return &Minimap2Aligner{Tools: opts.Tools, ExtraArgs: opts.ExtraArgs}, nil
+	case "bowtie2":
+		return &Bowtie2Aligner{Tools: opts.Tools, ExtraArgs: opts.ExtraArgs}, nil
+	}
+	return nil, fmt.Errorf("unknown aligner %q (expected one of %s)", name, strings.Join(Aligners, ", "))
+}
+
+// ReadMapper turns an aligner's output into a coordinate-sorted, indexed
+// BAM file, optionally with PCR and optical duplicates marked.
+type ReadMapper struct {
+	Aligner Aligner
+	Tools   Tools
+	Threads int
+	// MarkDuplicates runs the alignments through samtools fixmate and
+	// markdup. Duplicates are flagged, not removed.
+	MarkDuplicates bool
+}
+
+// Version describes the aligner and samtools for cache fingerprints.
+func (m *ReadMapper) Version(ctx context.Context) string {
+	return strings.Join([]string{
+		m.Aligner.Version(ctx),
+		toolVersion(ctx, m.Tools.bin("samtools"), "--version"),
+	}, "; ")
+}
+
+// Params are the mapping options for cache fingerprints.
+func (m *ReadMapper) Params() map[string]string {
+	return map[string]string{
+		"aligner":         m.Aligner.Name(),
+		"aligner_args":    strings.Join(m.Aligner.Args(), " "),
+		"mark_duplicates": fmt.Sprintf("%t", m.MarkDuplicates),
+	}
+}
+
+// Map indexes reference and aligns reads1 (and reads2, if set) to it,
+// writing the sorted alignment to bam and its index to bam.bai. Each of the
+// unpaired files, such as the reads whose mate was lost in trimming, is
+// aligned on its own and merged into bam.
+func (m *ReadMapper) Map(ctx context.Context, reference, reads1, reads2 string, unpaired []string, bam string) error {
+	if err := m.Aligner.Index(ctx, reference, m.Threads); err != nil {
+		return err
+	}
+
+	samtools := m.Tools.bin("samtools")
+	if len(unpaired) == 0 {
+		if err := m.align(ctx, &AlignJob{Reference: reference, Reads1: reads1, Reads2: reads2, Threads: m.Threads}, bam); err != nil {
+			return err
+		}
+	} else {
+		jobs := []*AlignJob{{Reference: reference, Reads1: reads1, Reads2: reads2, Threads: m.Threads}}
+		for _, reads := range unpaired {
+			jobs = append(jobs, &AlignJob{Reference: reference, Reads1: reads, Threads: m.Threads})
+		}
+		parts := make([]string, len(jobs))
+		for i, job := range jobs {
+			parts[i] = fmt.Sprintf("%s.part%d.bam", strings.TrimSuffix(bam, ".bam"), i+1)
+			if err := m.align(ctx, job, parts[i]); err != nil {
+				return err
+			}
+		}
+		args := append([]string{"merge", "-@", fmt.Sprintf("%d", m.Threads), "-f", bam}, parts...)
+		if err := newCommand(ctx, samtools, args...).Run(); err != nil {
+			return fmt.Errorf("samtools merge failed: %w", err)
+		}
+		for _, part := range parts {
+			if err := os.Remove(part); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", part, err)
+			}
+		}
+	}
+
+	cmdSamIndex := newCommand(ctx, samtools, "index", bam)
+	if err := cmdSamIndex.Run(); err != nil {
+		return fmt.Errorf("samtools index failed: %w", err)
+	}
+	if err := newCommand(ctx, samtools, "quickcheck", bam).Run(); err != nil {
+		return fmt.Errorf("mapped reads BAM failed integrity check: %w", err)
+	}
+	return nil
+}
+
+// align runs one aligner job and writes its alignments to bam, sorted.
+func (m *ReadMapper) align(ctx context.Context, job *AlignJob, bam string) error {
+	samtools := m.Tools.bin("samtools")
+	threads := fmt.Sprintf("%d", m.Threads)
+	// Temporary files of samtools sort go next to the output rather than
+	// to the current directory.
+	tmp := bam + ".tmp"
+	cmds := []*exec.Cmd{m.Aligner.Command(ctx, job)}
+	if m.MarkDuplicates {
+		// markdup needs the mate scores fixmate adds while the mates are
+		// still next to each other, as aligners write them.
+		cmds = append(cmds,
+			newCommand(ctx, samtools, "fixmate", "-m", "-u", "-", "-"),
+			newCommand(ctx, samtools, "sort", "-u", "-@", threads, "-T", tmp, "-"),
+			newCommand(ctx, samtools, "markdup", "-@", threads, "-T", tmp, "-", bam))
+	} else {
+		cmds = append(cmds, newCommand(ctx, samtools, "sort", "-@", threads, "-T", tmp, "-o", bam, "-"))
+	}
+	if err := runPiped(cmds...); err != nil {
+		return fmt.Errorf("read mapping with %s failed: %w", m.Aligner.Name(), err)
+	}
+	return nil
+}
+
+// RemoveIndex deletes the aligner's index of reference.
+func (m *ReadMapper) RemoveIndex(reference string) {
+	for _, path := range m.Aligner.IndexFiles(reference) {
+		_ = removeIfExists(path)
+	}
+}
+
+// linkReference makes the assembly reference available as dst in a step's
+// own staging directory. Aligners and polishers write their indexes next
+// to the assembly they are given, and the reference belongs to an earlier
+// step whose outputs must not change. It is symlinked, or copied where
+// links are not available.
+func linkReference(reference, dst string) error {
+	abs, err := filepath.Abs(reference)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", reference, err)
+	}
+	if err := os.Symlink(abs, dst); err == nil {
+		return nil
+	}
+	return copyFile(reference, dst)
+}
+
+// runPiped runs cmds as a shell pipeline, each command's stdout feeding
+// the next one's stdin. Every command that fails is reported.
+func runPiped(cmds ...*exec.Cmd) error {
+	// The parent's copies of the pipe ends are closed once the commands
+	// have started, so a writer gets SIGPIPE when its reader dies instead
+	// of blocking forever.
+	var ends []*os.File
+	defer func() {
+		for _, f := range ends {
+			f.Close()
+		}
+	}()
+	for i := 1; i < len(cmds); i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return fmt.Errorf("failed to connect %s to %s: %w", cmdName(cmds[i-1]), cmdName(cmds[i]), err)
+		}
+		cmds[i-1].Stdout = w
+		cmds[i].Stdin = r
+		ends = append(ends, r, w)
+	}
+
+	var errs []error
+	started := 0
+	for _, cmd := range cmds {
+		if err := cmd.Start(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to start %s: %w", cmdName(cmd), err))
+			break
+		}
+		started++
+	}
+	for _, f := range ends {
+		f.Close()
+	}
+	ends = nil
+	for _, cmd := range cmds[:started] {
+		if err := cmd.Wait(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", cmdName(cmd), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func cmdName(cmd *exec.Cmd) string {
+	name := filepath.Base(cmd.Path)
+	// samtools is used for several stages of a pipeline.
+	if name == "samtools" && len(cmd.Args) > 1 {
+		name += " " + cmd.Args[1]
+	}
+	return name
+}
+
+// MapReadsStep aligns the trimmed reads to an assembly, for polishing and
+// quality assessment.
+type MapReadsStep struct {
+	Reference string
+	// Target names the reference in progress messages, e.g. "draft assembly".
+	Target string
+	Reads1 string
+	// Reads2 is empty for single-end libraries.
+	Reads2 string
+	// Unpaired are single reads mapped in addition to the pairs.
+	Unpaired []string
+	Output   string
+	Mapper   ReadMapper
+}
+
+func (s *MapReadsStep) Name() string {
+	return fmt.Sprintf("Read Mapping to the %s (%s)", s.Target, s.Mapper.Aligner.Name())
+}
+
+// Bam is the alignment the step writes.
+func (s *MapReadsStep) Bam() string {
+	return filepath.Join(s.Output, MappedBamFile)
+}
+
+func (s *MapReadsStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:         s.Output,
+		Inputs:      append(nonEmpty(s.Reference, s.Reads1, s.Reads2), s.Unpaired...),
+		Params:      s.Mapper.Params(),
+		ToolVersion: s.Mapper.Version(ctx),
+		Outputs:     []string{s.Bam(), s.Bam() + ".bai"},
+	}, nil
+}
+
+func (s *MapReadsStep) Run(ctx context.Context) error {
+	fmt.Printf("Mapping reads to the %s (%s) with %s...\n", s.Target, s.Reference, s.Mapper.Aligner.Name())
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	ref := stage.path("reference.fasta")
+	if err := linkReference(s.Reference, ref); err != nil {
+		return err
+	}
+	if err := s.Mapper.Map(ctx, ref, s.Reads1, s.Reads2, s.Unpaired, stage.path(MappedBamFile)); err != nil {
+		return err
+	}
+	s.Mapper.RemoveIndex(ref)
+	if err := os.Remove(ref); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", ref, err)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	fmt.Println("Read mapping completed.")
+	return nil
+}
@@ -0,0 +1,190 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// ContigsFile is the name every assembler's final contigs are stored
+// under in the assembly directory.
+const ContigsFile = "contigs.fasta"
+
+// Assemblers lists the names accepted by NewAssembler.
+var Assemblers = []string{"spades", "megahit", "skesa", "unicycler", "flye"}
+
+// AssemblyJob is one assembler invocation.
+type AssemblyJob struct {
+	// Input2 is empty for single-end libraries.
+	Input1, Input2 string
+	// Dir is the staging directory the assembler works in. Contigs is the
+	// file in it the final contigs must be written to.
+	Dir     string
+	Contigs string
+	Threads int
+	// Memory is the memory limit in GB.
+	Memory int
+	// LongReads is the filtered long reads file, empty for short-read
+	// assemblies; LongReadType is one of LongReadTypes.
+	LongReads    string
+	LongReadType string
+}
+
+func (j *AssemblyJob) singleEnd() bool {
+	return j.Input2 == ""
+}
+
+// LongReadUse says what an assembler does with long reads.
+type LongReadUse int
+
+const (
+	// LongReadsUnsupported assemblers take short reads only.
+	LongReadsUnsupported LongReadUse = iota
+	// LongReadsOptional assemblers build a hybrid assembly when long reads
+	// are given and a short-read assembly otherwise.
+	LongReadsOptional
+	// LongReadsOnly assemblers need long reads and ignore short reads.
+	LongReadsOnly
+)
+
+// Assembler builds contigs from trimmed reads.
+type Assembler interface {
+	Name() string
+	Version(ctx context.Context) string
+	// Args are the options that shape the assembly, excluding resources
+	// and file paths. They are part of the step's cache fingerprint.
+	Args() []string
+	// LongReads says whether the assembler takes long reads.
+	LongReads() LongReadUse
+	Assemble(ctx context.Context, job *AssemblyJob) error
+}
+
+// AssemblerOptions configures the assemblers created by NewAssembler; only
+// the options of the chosen assembler are used.
+type AssemblerOptions struct {
+	Tools     Tools
+	Spades    SpadesAssembler
+	Megahit   MegahitAssembler
+	Skesa     SkesaAssembler
+	Unicycler UnicyclerAssembler
+	Flye      FlyeAssembler
+}
+
+// NewAssembler returns the assembler registered under name.
+func NewAssembler(name string, opts AssemblerOptions) (Assembler, error) {
+	switch name {
+	case "", "spades":
+		a := opts.Spades
+		a.Tools = opts.Tools
+		return &a, nil
+	case "megahit":
+		a := opts.Megahit
+		a.Tools = opts.Tools
+		return &a, nil
+	case "skesa":
+		a := opts.Skesa
+		a.Tools = opts.Tools
+		return &a, nil
+	case "unicycler":
+		a := opts.Unicycler
+		a.Tools = opts.Tools
+		return &a, nil
+	case "flye":
+		a := opts.Flye
+		a.Tools = opts.Tools
+		return &a, nil
+	}
+	return nil, fmt.Errorf("unknown assembler %q (expected one of %s)", name, strings.Join(Assemblers, ", "))
+}
+
+// AssembleStep assembles the trimmed reads with the configured Assembler.
+// Whatever the assembler, the final contigs end up in contigs.fasta in
+// Output, where polishing and reporting expect them.
+type AssembleStep struct {
+	// InputFq1 is empty for assemblers that use long reads only, and
+	// InputFq2 for single-end libraries.
+	InputFq1 string
+	InputFq2 string
+	// LongReads is empty unless the sample has long reads.
+	LongReads    string
+	LongReadType string
+	Output       string
+	Threads      int
+	Memory       int
+	Assembler    Assembler
+}
+
+func (s *AssembleStep) Name() string {
+	return s.Assembler.Name() + " Assembly"
+}
+
+func (s *AssembleStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:    s.Output,
+		Inputs: nonEmpty(s.InputFq1, s.InputFq2, s.LongReads),
+		Params: map[string]string{
+			"assembler":      s.Assembler.Name(),
+			"args":           strings.Join(s.Assembler.Args(), " "),
+			"long_read_type": s.LongReadType,
+		},
+		ToolVersion: s.Assembler.Version(ctx),
+		Outputs:     []string{filepath.Join(s.Output, ContigsFile)},
+	}, nil
+}
+
+func (s *AssembleStep) Run(ctx context.Context) error {
+	name := s.Assembler.Name()
+	switch use := s.Assembler.LongReads(); {
+	case s.LongReads != "" && use == LongReadsUnsupported:
+		return fmt.Errorf("%s cannot use long reads", name)
+	case s.LongReads == "" && use == LongReadsOnly:
+		return fmt.Errorf("%s needs long reads", name)
+	case s.LongReads != "":
+		fmt.Printf("Running %s for hybrid de novo assembly with %s reads...\n", name, s.LongReadType)
+	default:
+		fmt.Printf("Running %s for de novo assembly...\n", name)
+	}
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	job := &AssemblyJob{
+		Input1:       s.InputFq1,
+		Input2:       s.InputFq2,
+		Dir:          stage.dir,
+		Contigs:      stage.path(ContigsFile),
+		Threads:      s.Threads,
+		Memory:       s.Memory,
+		LongReads:    s.LongReads,
+		LongReadType: s.LongReadType,
+	}
+	if err := s.Assembler.Assemble(ctx, job); err != nil {
+		return err
+	}
+
+	if !fileExists(job.Contigs) {
+		return fmt.Errorf("%s failed, expected file not found: %s", name, job.Contigs)
+	}
+	if !fastaLooksValid(job.Contigs) {
+		return fmt.Errorf("%s produced an empty or malformed contigs file: %s", name, job.Contigs)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s assembly completed.\n", name)
+	return nil
+}
+
+// joinInts formats a k-mer list the way assemblers take it, e.g. "21,33,55".
+func joinInts(values []int) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = fmt.Sprintf("%d", v)
+	}
+	return strings.Join(s, ",")
+}
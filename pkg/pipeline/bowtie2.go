@@ -0,0 +1,55 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// Bowtie2Aligner aligns with Bowtie 2. The index is built with
+// bowtie2-build under the reference's path as prefix.
+type Bowtie2Aligner struct {
+	Tools Tools
+	// ExtraArgs are passed to bowtie2, for example "--very-sensitive".
+	ExtraArgs []string
+}
+
+func (a *Bowtie2Aligner) Name() string {
+	return "Bowtie 2"
+}
+
+func (a *Bowtie2Aligner) Version(ctx context.Context) string {
+	return toolVersion(ctx, a.Tools.bin("bowtie2"), "--version")
+}
+
+func (a *Bowtie2Aligner) Args() []string {
+	return a.ExtraArgs
+}
+
+func (a *Bowtie2Aligner) Index(ctx context.Context, reference string, threads int) error {
+	cmd := newCommand(ctx, a.Tools.bin("bowtie2-build"), "--threads", fmt.Sprintf("%d", threads), reference, reference)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("bowtie2-build failed: %w", err)
+	}
+	return nil
+}
+
+func (a *Bowtie2Aligner) IndexFiles(reference string) []string {
+	var files []string
+	for _, name := range []string{".1", ".2", ".3", ".4", ".rev.1", ".rev.2"} {
+		// Large genomes get a 64-bit index with the .bt2l extension.
+		files = append(files, reference+name+".bt2", reference+name+".bt2l")
+	}
+	return files
+}
+
+func (a *Bowtie2Aligner) Command(ctx context.Context, job *AlignJob) *exec.Cmd {
+	args := append([]string{"-p", fmt.Sprintf("%d", job.Threads)}, a.ExtraArgs...)
+	args = append(args, "-x", job.Reference)
+	if job.singleEnd() {
+		args = append(args, "-U", job.Reads1)
+	} else {
+		args = append(args, "-1", job.Reads1, "-2", job.Reads2)
+	}
+	return newCommand(ctx, a.Tools.bin("bowtie2"), args...)
+}
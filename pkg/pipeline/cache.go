@@ -0,0 +1,228 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CacheSpec describes everything that determines a step's outputs. The
+// pipeline fingerprints it and skips the step when the fingerprint matches
+// the manifest left behind by the last successful run.
+type CacheSpec struct {
+	// Dir is where the step manifest is stored, normally the step's output directory.
+	Dir string
+	// Inputs are files whose content feeds into the step.
+	Inputs []string
+	// Params are settings that change the outputs. Resource settings such as
+	// thread counts must not be included.
+	Params map[string]string
+	// ToolVersion identifies the external tool(s) used by the step.
+	ToolVersion string
+	// Outputs must all exist for a cached result to be reused.
+	Outputs []string
+}
+
+// Cacheable is implemented by steps whose results can be reused across runs.
+type Cacheable interface {
+	Step
+	CacheSpec(ctx context.Context) (*CacheSpec, error)
+}
+
+// manifest is the on-disk record of a successful step run.
+type manifest struct {
+	Step        string            `json:"step"`
+	Fingerprint string            `json:"fingerprint"`
+	ToolVersion string            `json:"tool_version"`
+	Params      map[string]string `json:"params,omitempty"`
+	Inputs      []inputRecord     `json:"inputs,omitempty"`
+	Outputs     []string          `json:"outputs,omitempty"`
+	CompletedAt time.Time         `json:"completed_at"`
+}
+
+type inputRecord struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	SHA256  string    `json:"sha256"`
+}
+
+func manifestPath(dir, id string) string {
+	return filepath.Join(dir, id+".manifest.json")
+}
+
+func readManifest(path string) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest %s: %w", path, err)
+	}
+	return &m, nil
+}
+
+func writeManifest(path string, m *manifest) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest directory: %w", err)
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// buildManifest checksums the inputs of spec and derives the step
+// fingerprint. Checksums recorded in prev are reused for inputs whose size
+// and modification time have not changed, so large FASTQ files are only
+// hashed once.
+func buildManifest(id string, spec *CacheSpec, prev *manifest) (*manifest, error) {
+	known := make(map[string]inputRecord)
+	if prev != nil {
+		for _, in := range prev.Inputs {
+			known[in.Path] = in
+		}
+	}
+
+	m := &manifest{
+		Step:        id,
+		ToolVersion: spec.ToolVersion,
+		Params:      spec.Params,
+		Outputs:     spec.Outputs,
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "step=%s\n", id)
+	fmt.Fprintf(h, "tool=%s\n", spec.ToolVersion)
+
+	keys := make([]string, 0, len(spec.Params))
+	for k := range spec.Params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(h, "param:%s=%s\n", k, spec.Params[k])
+	}
+
+	for _, path := range spec.Inputs {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat input %s: %w", path, err)
+		}
+		rec := inputRecord{Path: path, Size: info.Size(), ModTime: info.ModTime().UTC()}
+		if old, ok := known[path]; ok && old.Size == rec.Size && old.ModTime.Equal(rec.ModTime) && old.SHA256 != "" {
+			rec.SHA256 = old.SHA256
+		} else {
+			sum, err := fileSHA256(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to checksum input %s: %w", path, err)
+			}
+			rec.SHA256 = sum
+		}
+		m.Inputs = append(m.Inputs, rec)
+		fmt.Fprintf(h, "input=%s\n", rec.SHA256)
+	}
+
+	m.Fingerprint = hex.EncodeToString(h.Sum(nil))
+	return m, nil
+}
+
+// fileSHA256 returns the hex-encoded SHA-256 checksum of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheState tracks the cache bookkeeping of one step during a run.
+type cacheState struct {
+	path     string
+	spec     *CacheSpec
+	previous *manifest
+	current  *manifest
+}
+
+// checkCache computes the fingerprint of a cacheable step and reports
+// whether the outputs of a previous run can be reused.
+func checkCache(ctx context.Context, id string, step Cacheable) (*cacheState, bool, error) {
+	spec, err := step.CacheSpec(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to describe step for caching: %w", err)
+	}
+	st := &cacheState{path: manifestPath(spec.Dir, id), spec: spec}
+	if prev, err := readManifest(st.path); err == nil {
+		st.previous = prev
+	}
+
+	st.current, err = buildManifest(id, spec, st.previous)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if st.previous == nil || st.previous.Fingerprint != st.current.Fingerprint {
+		return st, false, nil
+	}
+	for _, out := range spec.Outputs {
+		if _, err := os.Stat(out); err != nil {
+			return st, false, nil
+		}
+	}
+	return st, true, nil
+}
+
+// invalidate removes the manifest before a step re-runs, so outputs left
+// half-written by an interrupted run are never mistaken for a cached result.
+func (st *cacheState) invalidate() error {
+	return removeIfExists(st.path)
+}
+
+// commit records a successful run of the step.
+func (st *cacheState) commit() error {
+	st.current.CompletedAt = time.Now().UTC()
+	return writeManifest(st.path, st.current)
+}
+
+var versionPattern = regexp.MustCompile(`\d+\.\d+[\w.\-]*`)
+
+// toolVersion runs a tool's version command and returns the first line that
+// looks like it carries a version number. Tools that cannot report a version
+// yield "unknown" rather than an error, so caching degrades to parameter and
+// input fingerprints.
+func toolVersion(ctx context.Context, name string, args ...string) string {
+	cmd := newCommand(ctx, name, args...)
+	cmd.Stdout = nil
+	cmd.Stderr = nil
+	// Several tools (bwa, fastq-dump) exit non-zero when printing their
+	// version or usage, so only the output matters here.
+	out, _ := cmd.CombinedOutput()
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if versionPattern.MatchString(line) {
+			return fmt.Sprintf("%s: %s", filepath.Base(name), line)
+		}
+	}
+	return filepath.Base(name) + ": unknown"
+}
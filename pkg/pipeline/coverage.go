@@ -0,0 +1,112 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"bio-assembler/pkg/bamstats"
+)
+
+// CoverageStatsFile holds the statistics written by CoverageStatsStep.
+const CoverageStatsFile = "coverage_stats.json"
+
+// ReadCoverageStats reads the statistics written by CoverageStatsStep.
+func ReadCoverageStats(path string) (*bamstats.Stats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &bamstats.Stats{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// CoverageStatsStep computes mapping and coverage statistics of the final
+// alignment without Qualimap. The BAM is read natively; if that fails, for
+// example for a CRAM file, the coverage is taken from "samtools depth"
+// and the mapping statistics are left out.
+type CoverageStatsStep struct {
+	BamFile string
+	Output  string
+	Tools   Tools
+}
+
+func (s *CoverageStatsStep) Name() string {
+	return "Coverage Statistics"
+}
+
+func (s *CoverageStatsStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:         s.Output,
+		Inputs:      []string{s.BamFile},
+		ToolVersion: "builtin; " + toolVersion(ctx, s.Tools.bin("samtools"), "--version"),
+		Outputs:     []string{filepath.Join(s.Output, CoverageStatsFile)},
+	}, nil
+}
+
+func (s *CoverageStatsStep) Run(ctx context.Context) error {
+	fmt.Println("Computing coverage statistics...")
+
+	stats, err := bamstats.ComputeFile(s.BamFile)
+	if err != nil {
+		fmt.Printf("Could not read the BAM file natively (%v), falling back to samtools depth...\n", err)
+		if stats, err = s.samtoolsDepth(ctx); err != nil {
+			return err
+		}
+	}
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode coverage statistics: %w", err)
+	}
+	if err := os.WriteFile(stage.path(CoverageStatsFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write coverage statistics: %w", err)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	if m := stats.Mapping; m != nil {
+		fmt.Printf("Mapped %d of %d reads (%.2f%%), %.2f%% of paired reads properly paired.\n",
+			m.Mapped, m.Reads, m.MappedPercent, m.ProperlyPairedPercent)
+	}
+	fmt.Printf("Coverage statistics completed: mean coverage %.1fx over %d bp.\n", stats.Coverage.Mean, stats.Coverage.Length)
+	return nil
+}
+
+// samtoolsDepth computes the coverage from the depth of every base as
+// reported by samtools, streamed rather than written to disk.
+func (s *CoverageStatsStep) samtoolsDepth(ctx context.Context) (*bamstats.Stats, error) {
+	cmd := newCommand(ctx, s.Tools.bin("samtools"), "depth", "-aa", s.BamFile)
+	cmd.Stdout = nil
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read samtools depth output: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start samtools depth: %w", err)
+	}
+	stats, parseErr := bamstats.ComputeDepth(out)
+	if parseErr != nil {
+		// Stop samtools rather than wait for it to fill a pipe nobody reads.
+		_ = cmd.Process.Kill()
+	}
+	if err := cmd.Wait(); err != nil && parseErr == nil {
+		return nil, fmt.Errorf("samtools depth command failed: %w", err)
+	}
+	if parseErr != nil {
+		return nil, fmt.Errorf("failed to parse samtools depth output: %w", parseErr)
+	}
+	stats.File = s.BamFile
+	return stats, nil
+}
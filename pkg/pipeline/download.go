@@ -1,58 +1,77 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 )
 
+const partialSuffix = ".partial"
+
+// DownloadStep fetches the paired reads of an SRA run into Output using
+// the configured Fetcher.
 type DownloadStep struct {
 	SrrID   string
 	Output  string
 	Threads int
+	Fetcher Fetcher
 }
 
 func (s *DownloadStep) Name() string {
 	return "Download Raw Data"
 }
 
-func (s *DownloadStep) Run() error {
-	rawFq1 := filepath.Join(s.Output, s.SrrID+"_1.fastq.gz")
-	rawFq2 := filepath.Join(s.Output, s.SrrID+"_2.fastq.gz")
-
-	if fileExists(rawFq1) && fileExists(rawFq2) {
-		fmt.Printf("Files for %s already exist, skipping download.\n", s.SrrID)
-		return nil
-	}
+func (s *DownloadStep) outputs() (string, string) {
+	return filepath.Join(s.Output, s.SrrID+"_1.fastq.gz"), filepath.Join(s.Output, s.SrrID+"_2.fastq.gz")
+}
 
-	fmt.Printf("Downloading data for SRR ID: %s\n", s.SrrID)
-	if err := os.MkdirAll(s.Output, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
-	}
+func (s *DownloadStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	rawFq1, rawFq2 := s.outputs()
+	return &CacheSpec{
+		Dir:         s.Output,
+		Params:      map[string]string{"srr": s.SrrID},
+		ToolVersion: s.Fetcher.Version(ctx),
+		Outputs:     []string{rawFq1, rawFq2},
+	}, nil
+}
 
-	// Use manual progress rendering instead of relying on fastq-dump --progress
-	stop := StartSpinner(fmt.Sprintf("Downloading %s (fastq-dump)", s.SrrID))
+func (s *DownloadStep) Run(ctx context.Context) error {
+	rawFq1, rawFq2 := s.outputs()
 
-	cmd := exec.Command("fastq-dump", "--split-files", "--gzip", "-O", s.Output, s.SrrID)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	fmt.Printf("Downloading data for SRR ID: %s (%s)\n", s.SrrID, s.Fetcher.Name())
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
 
-	runErr := cmd.Run()
-	if stop != nil {
-		if runErr != nil {
-			stop("failed")
-		} else {
-			stop("done")
-		}
+	// Partial downloads live next to the raw data directory rather than in
+	// the staging directory, so they survive a failed or interrupted run
+	// and can be resumed.
+	workDir := hiddenSibling(s.Output, partialSuffix)
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
 	}
-	if runErr != nil {
-		return fmt.Errorf("fastq-dump command failed: %w", runErr)
+
+	if err := s.Fetcher.Fetch(ctx, s.SrrID, stage.dir, workDir, s.Threads); err != nil {
+		return err
 	}
 
-	if !fileExists(rawFq1) || !fileExists(rawFq2) {
+	stagedFq1 := stage.path(filepath.Base(rawFq1))
+	stagedFq2 := stage.path(filepath.Base(rawFq2))
+	if !fileExists(stagedFq1) || !fileExists(stagedFq2) {
 		return fmt.Errorf("download failed, expected files not found: %s, %s", rawFq1, rawFq2)
 	}
+	if !gzipIntegrityOK(stagedFq1) || !gzipIntegrityOK(stagedFq2) {
+		return fmt.Errorf("downloaded files are not valid gzip streams (possible truncation)")
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(workDir); err != nil {
+		return fmt.Errorf("failed to remove download directory %s: %w", workDir, err)
+	}
 
 	fmt.Println("Data download completed.")
 	return nil
@@ -0,0 +1,183 @@
+package pipeline
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"bio-assembler/pkg/seqio"
+)
+
+const (
+	fastpJSONFile = "fastp.json"
+	fastpHTMLFile = "fastp.html"
+	fastpLogFile  = "fastp.log"
+	// fastpMaxThreads is the most worker threads fastp accepts.
+	fastpMaxThreads = 16
+)
+
+// FastpTrimmer trims with fastp. Without an adapter file fastp detects the
+// adapters itself, from the read overlap for paired-end libraries.
+type FastpTrimmer struct {
+	Tools Tools
+}
+
+func (t *FastpTrimmer) Name() string {
+	return "fastp"
+}
+
+func (t *FastpTrimmer) Version(ctx context.Context) string {
+	return toolVersion(ctx, t.Tools.bin("fastp"), "--version")
+}
+
+func (t *FastpTrimmer) DetectsAdapters() bool {
+	return true
+}
+
+func (t *FastpTrimmer) Logs() []string {
+	return []string{fastpJSONFile, fastpHTMLFile, fastpLogFile}
+}
+
+func (t *FastpTrimmer) Trim(ctx context.Context, job *TrimJob) (*TrimMetrics, error) {
+	jsonPath := filepath.Join(job.Dir, fastpJSONFile)
+	args := []string{
+		"-i", job.Input1,
+		"-o", job.Output1,
+		"-w", fmt.Sprintf("%d", min(job.Threads, fastpMaxThreads)),
+		"-j", jsonPath,
+		"-h", filepath.Join(job.Dir, fastpHTMLFile),
+	}
+	if !job.singleEnd() {
+		args = append(args,
+			"-I", job.Input2,
+			"-O", job.Output2,
+			"--unpaired1", job.Unpaired1,
+			"--unpaired2", job.Unpaired2,
+		)
+	}
+	if job.Encoding.Offset() == 64 {
+		// fastp writes Phred+33 regardless of the input encoding.
+		args = append(args, "--phred64")
+	}
+	switch {
+	case job.AdapterFasta != "":
+		args = append(args, "--adapter_fasta", job.AdapterFasta)
+	case !job.singleEnd():
+		// fastp always detects adapters in single-end data, but only
+		// looks for them in paired-end data when asked to.
+		args = append(args, "--detect_adapter_for_pe")
+	}
+
+	if p := job.Preset; p != nil {
+		// A one-base window makes cut_front/cut_tail behave like
+		// Trimmomatic's LEADING/TRAILING, and cut_right like SLIDINGWINDOW.
+		// fastp's own read quality filter has no Trimmomatic counterpart in
+		// the presets, so it is turned off.
+		args = append(args,
+			"--cut_front", "--cut_front_window_size", "1", "--cut_front_mean_quality", fmt.Sprintf("%d", p.Leading),
+			"--cut_tail", "--cut_tail_window_size", "1", "--cut_tail_mean_quality", fmt.Sprintf("%d", p.Trailing),
+			"--cut_right", "--cut_right_window_size", fmt.Sprintf("%d", p.Window), "--cut_right_mean_quality", fmt.Sprintf("%d", p.WindowQuality),
+			"--length_required", fmt.Sprintf("%d", p.MinLength),
+			"--disable_quality_filtering",
+		)
+	} else {
+		args = append(args, job.CustomArgs...)
+	}
+	args = append(args, job.ExtraArgs...)
+
+	if err := runLogged(ctx, filepath.Join(job.Dir, fastpLogFile), t.Tools.bin("fastp"), args...); err != nil {
+		return nil, err
+	}
+
+	m, err := parseFastpReport(jsonPath, !job.singleEnd())
+	if err != nil {
+		return nil, err
+	}
+	if !job.singleEnd() {
+		// The report counts reads in passing pairs only; reads that lost
+		// their mate are counted from the unpaired outputs, which fastp
+		// does not create when there are none.
+		for _, u := range []string{job.Unpaired1, job.Unpaired2} {
+			if !fileExists(u) {
+				if err := writeEmptyGzip(u); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if m.ForwardOnly, err = countFastqRecords(job.Unpaired1); err != nil {
+			return nil, err
+		}
+		if m.ReverseOnly, err = countFastqRecords(job.Unpaired2); err != nil {
+			return nil, err
+		}
+	}
+	m.Dropped = m.Input - m.Surviving - m.ForwardOnly - m.ReverseOnly
+	return m, nil
+}
+
+// fastpReport is the part of fastp's JSON report the metrics are built from.
+type fastpReport struct {
+	Summary struct {
+		BeforeFiltering struct {
+			TotalReads int64 `json:"total_reads"`
+		} `json:"before_filtering"`
+		AfterFiltering struct {
+			TotalReads int64 `json:"total_reads"`
+		} `json:"after_filtering"`
+	} `json:"summary"`
+}
+
+// parseFastpReport reads the read counts of a fastp JSON report. fastp
+// counts both mates of a pair, so paired counts are halved.
+func parseFastpReport(path string, paired bool) (*TrimMetrics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fastp report: %w", err)
+	}
+	var r fastpReport
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to parse fastp report %s: %w", path, err)
+	}
+	m := &TrimMetrics{
+		Paired:    paired,
+		Input:     r.Summary.BeforeFiltering.TotalReads,
+		Surviving: r.Summary.AfterFiltering.TotalReads,
+	}
+	if paired {
+		m.Input /= 2
+		m.Surviving /= 2
+	}
+	return m, nil
+}
+
+// countFastqRecords counts the records of a FASTQ file.
+func countFastqRecords(path string) (int64, error) {
+	r, err := seqio.OpenFastq(path)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	for {
+		if _, err := r.Read(); err == io.EOF {
+			return r.Records(), nil
+		} else if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+	}
+}
+
+func writeEmptyGzip(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := gzip.NewWriter(f).Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return f.Close()
+}
@@ -1,34 +1,43 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"bio-assembler/pkg/fastqc"
 )
 
 type FastQCStep struct {
 	InputFq1 string
+	// InputFq2 is empty for single-end libraries.
 	InputFq2 string
 	Output   string
 	Threads  int
+	Tools    Tools
+	// ExtraArgs are passed to fastqc in addition to the defaults.
+	ExtraArgs []string
+	// Gate is checked against the FastQC results once the reports exist.
+	Gate []QCRule
 }
 
 func (s *FastQCStep) Name() string {
 	return "FastQC Analysis"
 }
 
-func (s *FastQCStep) Run() error {
+func (s *FastQCStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return fastqcCacheSpec(ctx, s.Tools, s.ExtraArgs, s.Gate, s.Output, nonEmpty(s.InputFq1, s.InputFq2)...), nil
+}
+
+func (s *FastQCStep) Run(ctx context.Context) error {
 	fmt.Println("Running FastQC for initial quality control...")
-	if err := os.MkdirAll(s.Output, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	results, err := runFastQC(ctx, s.Tools, s.ExtraArgs, s.Output, s.Threads, nonEmpty(s.InputFq1, s.InputFq2)...)
+	if err != nil {
+		return err
 	}
-
-	cmd := exec.Command("fastqc", s.InputFq1, s.InputFq2, "-o", s.Output, "-t", fmt.Sprintf("%d", s.Threads))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("fastqc command failed: %w", err)
+	if err := checkQCGate(s.Name(), results, s.Gate); err != nil {
+		return err
 	}
 
 	fmt.Println("FastQC analysis completed.")
@@ -40,26 +49,102 @@ type TrimmedFastQCStep struct {
 	InputFq2 string
 	Output   string
 	Threads  int
+	Tools    Tools
+	// ExtraArgs are passed to fastqc in addition to the defaults.
+	ExtraArgs []string
+	// Gate is checked against the FastQC results once the reports exist.
+	Gate []QCRule
 }
 
 func (s *TrimmedFastQCStep) Name() string {
 	return "FastQC Analysis on Trimmed Reads"
 }
 
-func (s *TrimmedFastQCStep) Run() error {
+func (s *TrimmedFastQCStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return fastqcCacheSpec(ctx, s.Tools, s.ExtraArgs, s.Gate, s.Output, nonEmpty(s.InputFq1, s.InputFq2)...), nil
+}
+
+func (s *TrimmedFastQCStep) Run(ctx context.Context) error {
 	fmt.Println("Running FastQC for trimmed reads...")
-	if err := os.MkdirAll(s.Output, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+	results, err := runFastQC(ctx, s.Tools, s.ExtraArgs, s.Output, s.Threads, nonEmpty(s.InputFq1, s.InputFq2)...)
+	if err != nil {
+		return err
+	}
+	if err := checkQCGate(s.Name(), results, s.Gate); err != nil {
+		return err
+	}
+
+	fmt.Println("FastQC analysis on trimmed reads completed.")
+	return nil
+}
+
+// runFastQC runs fastqc on the given reads into a staging directory and
+// promotes it to outDir once every expected report has been produced. The
+// parsed reports are returned and summarised in qc_summary.json.
+func runFastQC(ctx context.Context, tools Tools, extraArgs []string, outDir string, threads int, inputs ...string) ([]*fastqc.Result, error) {
+	stage, err := newStaging(outDir)
+	if err != nil {
+		return nil, err
 	}
+	defer stage.discard()
 
-	cmd := exec.Command("fastqc", s.InputFq1, s.InputFq2, "-o", s.Output, "-t", fmt.Sprintf("%d", s.Threads))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	args := append([]string{}, inputs...)
+	args = append(args, "-o", stage.dir, "-t", fmt.Sprintf("%d", threads))
+	args = append(args, extraArgs...)
+	cmd := newCommand(ctx, tools.bin("fastqc"), args...)
 
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("fastqc command failed: %w", err)
+		return nil, fmt.Errorf("fastqc command failed: %w", err)
 	}
 
-	fmt.Println("FastQC analysis on trimmed reads completed.")
-	return nil
+	var results []*fastqc.Result
+	for _, in := range inputs {
+		base := fastqcReportBase(in)
+		for _, name := range []string{base + "_fastqc.html", base + "_fastqc.zip"} {
+			if !fileExists(stage.path(name)) {
+				return nil, fmt.Errorf("fastqc failed, expected file not found: %s", name)
+			}
+		}
+		res, err := fastqc.ParseZip(stage.path(base + "_fastqc.zip"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse FastQC report: %w", err)
+		}
+		results = append(results, res)
+	}
+	if err := writeQCSummary(stage.path(qcSummaryFile), results); err != nil {
+		return nil, err
+	}
+	return results, stage.promote()
+}
+
+// fastqcCacheSpec describes a FastQC run over the given reads. FastQC names
+// its reports after the input file with the FASTQ extension stripped.
+func fastqcCacheSpec(ctx context.Context, tools Tools, extraArgs []string, gate []QCRule, outDir string, inputs ...string) *CacheSpec {
+	var outputs []string
+	for _, in := range inputs {
+		base := fastqcReportBase(in)
+		outputs = append(outputs,
+			filepath.Join(outDir, base+"_fastqc.html"),
+			filepath.Join(outDir, base+"_fastqc.zip"))
+	}
+	outputs = append(outputs, filepath.Join(outDir, qcSummaryFile))
+	return &CacheSpec{
+		Dir:    outDir,
+		Inputs: inputs,
+		Params: map[string]string{
+			"extra_args": strings.Join(extraArgs, " "),
+			"qc_gate":    gateParam(gate),
+		},
+		ToolVersion: toolVersion(ctx, tools.bin("fastqc"), "--version"),
+		Outputs:     outputs,
+	}
+}
+
+// fastqcReportBase returns the name FastQC uses for the reports of a reads file.
+func fastqcReportBase(path string) string {
+	base := filepath.Base(path)
+	for _, ext := range []string{".gz", ".bz2", ".fastq", ".fq", ".sam", ".bam"} {
+		base = strings.TrimSuffix(base, ext)
+	}
+	return base
 }
@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// Fetchers lists the names accepted by NewFetcher.
+var Fetchers = []string{"sra-tools", "ena"}
+
+// Fetcher obtains the paired reads of an SRA run. Fetch must leave
+// <srr>_1.fastq.gz and <srr>_2.fastq.gz in outDir. workDir persists across
+// attempts and runs, so a fetcher can keep partial downloads there and
+// resume them; it is removed once the reads have been promoted.
+type Fetcher interface {
+	Name() string
+	Version(ctx context.Context) string
+	Fetch(ctx context.Context, srrID, outDir, workDir string, threads int) error
+}
+
+// FetcherOptions configures the fetcher returned by NewFetcher.
+type FetcherOptions struct {
+	Tools Tools
+	// ExtraArgs are passed to fasterq-dump.
+	ExtraArgs []string
+	ENA       ENAFetcher
+}
+
+// NewFetcher returns the fetcher registered under name.
+func NewFetcher(name string, opts FetcherOptions) (Fetcher, error) {
+	switch name {
+	case "", "sra-tools":
+		return &SRAToolsFetcher{Tools: opts.Tools, ExtraArgs: opts.ExtraArgs}, nil
+	case "ena":
+		ena := opts.ENA
+		return &ena, nil
+	}
+	return nil, fmt.Errorf("unknown fetcher %q (expected one of %s)", name, strings.Join(Fetchers, ", "))
+}
+
+// SRAToolsFetcher downloads the run with prefetch, extracts it with the
+// multi-threaded fasterq-dump and compresses the FASTQ files in parallel.
+type SRAToolsFetcher struct {
+	Tools     Tools
+	ExtraArgs []string
+}
+
+func (f *SRAToolsFetcher) Name() string {
+	return "sra-tools"
+}
+
+func (f *SRAToolsFetcher) Version(ctx context.Context) string {
+	return toolVersion(ctx, f.Tools.bin("fasterq-dump"), "--version")
+}
+
+func (f *SRAToolsFetcher) Fetch(ctx context.Context, srrID, outDir, workDir string, threads int) error {
+	// prefetch skips runs that are already complete in workDir, so an
+	// interrupted download is picked up by the next attempt.
+	stop := StartSpinner(fmt.Sprintf("Downloading %s (prefetch)", srrID))
+	err := newCommand(ctx, f.Tools.bin("prefetch"), srrID, "-O", workDir).Run()
+	stop(statusWord(err))
+	if err != nil {
+		return fmt.Errorf("prefetch command failed: %w", err)
+	}
+
+	stop = StartSpinner(fmt.Sprintf("Extracting %s (fasterq-dump)", srrID))
+	args := []string{
+		"--split-files",
+		"--threads", fmt.Sprintf("%d", threads),
+		"--temp", workDir,
+		"-O", outDir,
+		"-o", srrID + ".fastq",
+	}
+	args = append(args, f.ExtraArgs...)
+	args = append(args, filepath.Join(workDir, srrID))
+	err = newCommand(ctx, f.Tools.bin("fasterq-dump"), args...).Run()
+	stop(statusWord(err))
+	if err != nil {
+		return fmt.Errorf("fasterq-dump command failed: %w", err)
+	}
+
+	plain := []string{
+		filepath.Join(outDir, srrID+"_1.fastq"),
+		filepath.Join(outDir, srrID+"_2.fastq"),
+	}
+	for _, p := range plain {
+		if !fileExists(p) {
+			return fmt.Errorf("fasterq-dump did not produce %s (is %s a paired-end run?)", filepath.Base(p), srrID)
+		}
+	}
+
+	stop = StartSpinner(fmt.Sprintf("Compressing %s", srrID))
+	err = compressParallel(ctx, f.Tools, threads, plain...)
+	stop(statusWord(err))
+	return err
+}
+
+// compressParallel gzips the given files in place, replacing each with a
+// .gz file. pigz is used when it is installed; otherwise the files are
+// compressed concurrently in-process.
+func compressParallel(ctx context.Context, tools Tools, threads int, paths ...string) error {
+	if pigz, err := exec.LookPath(tools.bin("pigz")); err == nil {
+		args := append([]string{"-p", fmt.Sprintf("%d", threads)}, paths...)
+		if err := newCommand(ctx, pigz, args...).Run(); err != nil {
+			return fmt.Errorf("pigz command failed: %w", err)
+		}
+		return nil
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, p := range paths {
+		g.Go(func() error {
+			return gzipFile(ctx, p)
+		})
+	}
+	return g.Wait()
+}
+
+// gzipFile compresses path to path.gz and removes the original.
+func gzipFile(ctx context.Context, path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return fmt.Errorf("failed to create %s.gz: %w", path, err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, &ctxReader{ctx: ctx, r: bufio.NewReaderSize(in, 1<<20)}); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", path, err)
+	}
+	return os.Remove(path)
+}
+
+// ctxReader stops a long copy once its context is cancelled.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+func statusWord(err error) string {
+	if err != nil {
+		return "failed"
+	}
+	return "done"
+}
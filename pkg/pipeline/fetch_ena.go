@@ -0,0 +1,435 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultENAPortal = "https://www.ebi.ac.uk/ena/portal/api"
+
+// ENAFetcher downloads the gzipped FASTQ files of a run directly from the
+// European Nucleotide Archive. The file locations and their md5 sums come
+// from the run's file report. Interrupted transfers are resumed from the
+// partial file in the work directory and every file is checked against its
+// md5 before it is accepted.
+type ENAFetcher struct {
+	// PortalURL is the base of the ENA portal API. It can point at a local
+	// server standing in for ENA.
+	PortalURL string
+	// Protocol is "https" (default) or "ftp". The file report lists
+	// host/path locations that ENA serves over both.
+	Protocol string
+	// Retries is the number of extra attempts per file after a failed or
+	// corrupt transfer.
+	Retries int
+	Client  *http.Client
+}
+
+// enaFile is one entry of a run's file report.
+type enaFile struct {
+	Location string
+	MD5      string
+	Bytes    int64
+}
+
+func (f *ENAFetcher) Name() string {
+	return "ena"
+}
+
+func (f *ENAFetcher) Version(ctx context.Context) string {
+	return "ena-" + f.protocol()
+}
+
+func (f *ENAFetcher) portal() string {
+	if f.PortalURL != "" {
+		return strings.TrimRight(f.PortalURL, "/")
+	}
+	return defaultENAPortal
+}
+
+func (f *ENAFetcher) protocol() string {
+	if f.Protocol != "" {
+		return f.Protocol
+	}
+	return "https"
+}
+
+func (f *ENAFetcher) client() *http.Client {
+	if f.Client != nil {
+		return f.Client
+	}
+	return http.DefaultClient
+}
+
+func (f *ENAFetcher) Fetch(ctx context.Context, srrID, outDir, workDir string, threads int) error {
+	files, err := f.fileReport(ctx, srrID)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		return fmt.Errorf("failed to create download directory: %w", err)
+	}
+
+	// Verified files stay in workDir until both mates are complete, so a
+	// failure on the second file does not cost the first one.
+	names := []string{srrID + "_1.fastq.gz", srrID + "_2.fastq.gz"}
+	for _, name := range names {
+		var file *enaFile
+		for i := range files {
+			if path.Base(files[i].Location) == name {
+				file = &files[i]
+			}
+		}
+		if file == nil {
+			return fmt.Errorf("ENA has no %s for %s (is it a paired-end run?)", name, srrID)
+		}
+
+		done := filepath.Join(workDir, name)
+		if fileExists(done) && verifyDownload(done, *file) == nil {
+			fmt.Printf("%s already downloaded.\n", name)
+			continue
+		}
+		part := done + ".part"
+		if err := f.download(ctx, *file, part); err != nil {
+			return err
+		}
+		if err := os.Rename(part, done); err != nil {
+			return fmt.Errorf("failed to finish %s: %w", name, err)
+		}
+	}
+	for _, name := range names {
+		if err := os.Rename(filepath.Join(workDir, name), filepath.Join(outDir, name)); err != nil {
+			return fmt.Errorf("failed to move %s into place: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// fileReport asks the ENA portal for the FASTQ files of a run.
+func (f *ENAFetcher) fileReport(ctx context.Context, srrID string) ([]enaFile, error) {
+	q := url.Values{
+		"accession": {srrID},
+		"result":    {"read_run"},
+		"fields":    {"fastq_ftp,fastq_md5,fastq_bytes"},
+		"format":    {"tsv"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.portal()+"/filereport?"+q.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build ENA file report request: %w", err)
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch ENA file report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch ENA file report for %s: %s", srrID, resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var header []string
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if header == nil {
+			header = fields
+			continue
+		}
+		values := make(map[string]string, len(header))
+		for i, c := range header {
+			if i < len(fields) {
+				values[c] = fields[i]
+			}
+		}
+		return parseENAFiles(values["fastq_ftp"], values["fastq_md5"], values["fastq_bytes"])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ENA file report: %w", err)
+	}
+	return nil, fmt.Errorf("ENA file report for %s is empty", srrID)
+}
+
+// parseENAFiles zips the semicolon-separated columns of a file report.
+func parseENAFiles(locations, md5s, sizes string) ([]enaFile, error) {
+	if locations == "" {
+		return nil, fmt.Errorf("ENA lists no FASTQ files for this run")
+	}
+	locs := strings.Split(locations, ";")
+	sums := strings.Split(md5s, ";")
+	lens := strings.Split(sizes, ";")
+	if len(sums) != len(locs) || len(lens) != len(locs) {
+		return nil, fmt.Errorf("ENA file report lists %d files but %d md5 sums and %d sizes", len(locs), len(sums), len(lens))
+	}
+	files := make([]enaFile, len(locs))
+	for i := range locs {
+		n, err := strconv.ParseInt(lens[i], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file size %q in ENA file report", lens[i])
+		}
+		files[i] = enaFile{Location: locs[i], MD5: strings.ToLower(sums[i]), Bytes: n}
+	}
+	return files, nil
+}
+
+// fileURL turns a file report location (host/path) into a URL for the
+// configured protocol. Locations that already carry a scheme are used as is.
+func (f *ENAFetcher) fileURL(location string) string {
+	if strings.Contains(location, "://") {
+		return location
+	}
+	return f.protocol() + "://" + location
+}
+
+// download transfers one file to part, resuming from whatever part already
+// holds, until its size and md5 match the file report.
+func (f *ENAFetcher) download(ctx context.Context, file enaFile, part string) error {
+	src := f.fileURL(file.Location)
+	name := path.Base(file.Location)
+
+	var lastErr error
+	for attempt := 0; attempt <= f.Retries; attempt++ {
+		if attempt > 0 {
+			wait := time.Duration(1<<min(attempt-1, 5)) * time.Second
+			fmt.Printf("Retrying %s in %s (attempt %d of %d): %v\n", name, wait, attempt+1, f.Retries+1, lastErr)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		stop := StartSpinner(fmt.Sprintf("Downloading %s (ENA, %s)", name, f.protocol()))
+		var err error
+		if info, statErr := os.Stat(part); statErr != nil || info.Size() != file.Bytes {
+			err = f.transfer(ctx, src, part)
+		}
+		if err == nil {
+			err = verifyDownload(part, file)
+			if err != nil {
+				// A corrupt file cannot be repaired by resuming it.
+				_ = os.Remove(part)
+			}
+		}
+		stop(statusWord(err))
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		lastErr = err
+	}
+	return fmt.Errorf("failed to download %s after %d attempts: %w", name, f.Retries+1, lastErr)
+}
+
+// transfer appends the remainder of src to part.
+func (f *ENAFetcher) transfer(ctx context.Context, src, part string) error {
+	out, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", part, err)
+	}
+	defer out.Close()
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return fmt.Errorf("failed to seek %s: %w", part, err)
+	}
+
+	u, err := url.Parse(src)
+	if err != nil {
+		return fmt.Errorf("invalid download URL %s: %w", src, err)
+	}
+	var body io.ReadCloser
+	switch u.Scheme {
+	case "http", "https":
+		body, offset, err = f.openHTTP(ctx, src, offset)
+	case "ftp":
+		body, err = openFTP(ctx, u, offset)
+	default:
+		err = fmt.Errorf("unsupported download protocol %q", u.Scheme)
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	// The server may ignore the resume request and send the whole file.
+	if err := out.Truncate(offset); err != nil {
+		return fmt.Errorf("failed to truncate %s: %w", part, err)
+	}
+	if _, err := out.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek %s: %w", part, err)
+	}
+	if _, err := io.Copy(out, &ctxReader{ctx: ctx, r: body}); err != nil {
+		return fmt.Errorf("transfer of %s interrupted: %w", src, err)
+	}
+	return out.Close()
+}
+
+// openHTTP requests src from offset on and returns the offset the response
+// actually starts at.
+func (f *ENAFetcher) openHTTP(ctx context.Context, src string, offset int64) (io.ReadCloser, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to build request for %s: %w", src, err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to request %s: %w", src, err)
+	}
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return resp.Body, offset, nil
+	case http.StatusOK:
+		return resp.Body, 0, nil
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The partial file is already complete (or longer than the file);
+		// start over and let verification decide.
+		resp.Body.Close()
+		return f.openHTTP(ctx, src, 0)
+	}
+	resp.Body.Close()
+	return nil, 0, fmt.Errorf("failed to download %s: %s", src, resp.Status)
+}
+
+// verifyDownload checks a downloaded file against its file report entry.
+func verifyDownload(path string, file enaFile) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if file.Bytes > 0 && info.Size() != file.Bytes {
+		return fmt.Errorf("%s has %d bytes, expected %d", filepath.Base(path), info.Size(), file.Bytes)
+	}
+	if file.MD5 == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to checksum %s: %w", path, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != file.MD5 {
+		return fmt.Errorf("md5 mismatch for %s: got %s, expected %s", filepath.Base(path), sum, file.MD5)
+	}
+	return nil
+}
+
+// openFTP retrieves a file over anonymous passive-mode FTP, starting at
+// offset. Closing the returned reader ends the session.
+func openFTP(ctx context.Context, u *url.URL, offset int64) (io.ReadCloser, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", host, err)
+	}
+	// Closing the control connection unblocks any pending reply when ctx
+	// is cancelled.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	fail := func(err error) (io.ReadCloser, error) {
+		stop()
+		conn.Close()
+		return nil, fmt.Errorf("ftp %s: %w", u.Host, err)
+	}
+
+	tp := textproto.NewConn(conn)
+	cmd := func(expect int, format string, args ...any) (string, error) {
+		if format != "" {
+			if err := tp.PrintfLine(format, args...); err != nil {
+				return "", err
+			}
+		}
+		_, msg, err := tp.ReadResponse(expect)
+		return msg, err
+	}
+
+	if _, err := cmd(2, ""); err != nil {
+		return fail(err)
+	}
+	// Servers answer USER with 230 when no password is needed and 331
+	// when one is.
+	if _, err := cmd(2, "USER anonymous"); err != nil {
+		if !isFTPCode(err, 331) {
+			return fail(err)
+		}
+		if _, err := cmd(2, "PASS anonymous@"); err != nil {
+			return fail(err)
+		}
+	}
+	if _, err := cmd(2, "TYPE I"); err != nil {
+		return fail(err)
+	}
+	msg, err := cmd(2, "EPSV")
+	if err != nil {
+		return fail(err)
+	}
+	// 229 Entering Extended Passive Mode (|||port|)
+	start, end := strings.Index(msg, "(|||"), strings.LastIndex(msg, "|)")
+	if start < 0 || end <= start+4 {
+		return fail(fmt.Errorf("unexpected EPSV reply %q", msg))
+	}
+	data, err := d.DialContext(ctx, "tcp", net.JoinHostPort(u.Hostname(), msg[start+4:end]))
+	if err != nil {
+		return fail(err)
+	}
+	if offset > 0 {
+		if _, err := cmd(3, "REST %d", offset); err != nil {
+			data.Close()
+			return fail(err)
+		}
+	}
+	if _, err := cmd(1, "RETR %s", u.Path); err != nil {
+		data.Close()
+		return fail(err)
+	}
+	return &ftpReader{Conn: data, control: tp, stop: stop}, nil
+}
+
+// isFTPCode reports whether err is an FTP reply with the given code.
+func isFTPCode(err error, code int) bool {
+	var perr *textproto.Error
+	return errors.As(err, &perr) && perr.Code == code
+}
+
+type ftpReader struct {
+	net.Conn
+	control *textproto.Conn
+	stop    func() bool
+}
+
+func (r *ftpReader) Close() error {
+	err := r.Conn.Close()
+	r.stop()
+	r.control.PrintfLine("QUIT")
+	r.control.Close()
+	return err
+}
@@ -0,0 +1,301 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeENA stands in for the ENA portal and file servers.
+type fakeENA struct {
+	t      *testing.T
+	srv    *httptest.Server
+	report string
+	files  map[string][]byte
+
+	mu sync.Mutex
+	// corrupt replaces the body of the named files with garbage.
+	corrupt map[string]bool
+	// ignoreRange makes the file server answer range requests with the
+	// whole file.
+	ignoreRange bool
+	// failures is the number of 503 responses still to send per file.
+	failures map[string]int
+	requests []string
+	ranges   []string
+}
+
+func newFakeENA(t *testing.T) *fakeENA {
+	e := &fakeENA{t: t, files: map[string][]byte{}, corrupt: map[string]bool{}, failures: map[string]int{}}
+	e.srv = httptest.NewServer(http.HandlerFunc(e.serve))
+	t.Cleanup(e.srv.Close)
+	return e
+}
+
+func (e *fakeENA) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/filereport" {
+		if got := r.URL.Query().Get("result"); got != "read_run" {
+			e.t.Errorf("file report requested with result=%q", got)
+		}
+		fmt.Fprint(w, e.report)
+		return
+	}
+
+	name := filepath.Base(r.URL.Path)
+	e.mu.Lock()
+	e.requests = append(e.requests, name)
+	e.ranges = append(e.ranges, r.Header.Get("Range"))
+	fail := e.failures[name] > 0
+	if fail {
+		e.failures[name]--
+	}
+	data, ok := e.files[name]
+	if e.corrupt[name] {
+		data = bytes.Repeat([]byte{'x'}, len(data))
+	}
+	if e.ignoreRange {
+		r.Header.Del("Range")
+	}
+	e.mu.Unlock()
+
+	switch {
+	case fail:
+		http.Error(w, "try again later", http.StatusServiceUnavailable)
+	case !ok:
+		http.NotFound(w, r)
+	default:
+		http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+	}
+}
+
+// addRun serves the given files of a run and lists them in the file report.
+func (e *fakeENA) addRun(srrID string, names ...string) {
+	host := strings.TrimPrefix(e.srv.URL, "http://")
+	var locs, sums, sizes []string
+	for i, name := range names {
+		data := []byte(fmt.Sprintf("@%s.%d\nACGTACGTAC\n+\nIIIIIIIIII\n", name, i))
+		data = bytes.Repeat(data, 100)
+		e.files[name] = data
+		sum := md5.Sum(data)
+		locs = append(locs, host+"/vol1/fastq/"+name)
+		sums = append(sums, hex.EncodeToString(sum[:]))
+		sizes = append(sizes, fmt.Sprint(len(data)))
+	}
+	e.report = "run_accession\tfastq_ftp\tfastq_md5\tfastq_bytes\n" +
+		srrID + "\t" + strings.Join(locs, ";") + "\t" + strings.Join(sums, ";") + "\t" + strings.Join(sizes, ";") + "\n"
+}
+
+func (e *fakeENA) fetcher() *ENAFetcher {
+	return &ENAFetcher{PortalURL: e.srv.URL, Protocol: "http", Client: e.srv.Client()}
+}
+
+// fetchRun runs the fetcher and returns the output and work directories.
+func fetchRun(t *testing.T, f *ENAFetcher, srrID string, prepare func(workDir string)) (string, string, error) {
+	t.Helper()
+	outDir, workDir := t.TempDir(), filepath.Join(t.TempDir(), "work")
+	if prepare != nil {
+		if err := os.MkdirAll(workDir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		prepare(workDir)
+	}
+	err := f.Fetch(context.Background(), srrID, outDir, workDir, 1)
+	return outDir, workDir, err
+}
+
+func checkFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from the served file (%d bytes, want %d)", filepath.Base(path), len(got), len(want))
+	}
+}
+
+func TestENAFileReport(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		report  string
+		want    int
+		wantErr string
+	}{
+		{name: "paired", files: []string{"SRR1_1.fastq.gz", "SRR1_2.fastq.gz"}, want: 2},
+		{name: "single", files: []string{"SRR1.fastq.gz"}, want: 1},
+		{
+			name:    "no fastq",
+			report:  "run_accession\tfastq_ftp\tfastq_md5\tfastq_bytes\nSRR1\t\t\t\n",
+			wantErr: "no FASTQ files",
+		},
+		{
+			name:    "empty",
+			report:  "run_accession\tfastq_ftp\tfastq_md5\tfastq_bytes\n",
+			wantErr: "is empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newFakeENA(t)
+			e.addRun("SRR1", tt.files...)
+			if tt.report != "" {
+				e.report = tt.report
+			}
+			files, err := e.fetcher().fileReport(context.Background(), "SRR1")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != tt.want {
+				t.Fatalf("got %d files, want %d", len(files), tt.want)
+			}
+			for i, f := range files {
+				if filepath.Base(f.Location) != tt.files[i] {
+					t.Errorf("file %d is %s, want %s", i, f.Location, tt.files[i])
+				}
+				if f.Bytes != int64(len(e.files[tt.files[i]])) || len(f.MD5) != 32 {
+					t.Errorf("file %d has size %d and md5 %q", i, f.Bytes, f.MD5)
+				}
+			}
+		})
+	}
+}
+
+func TestENAFetchPaired(t *testing.T) {
+	e := newFakeENA(t)
+	e.addRun("SRR1", "SRR1_1.fastq.gz", "SRR1_2.fastq.gz")
+	outDir, _, err := fetchRun(t, e.fetcher(), "SRR1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"SRR1_1.fastq.gz", "SRR1_2.fastq.gz"} {
+		checkFile(t, filepath.Join(outDir, name), e.files[name])
+	}
+}
+
+func TestENAFetchSingleEnd(t *testing.T) {
+	e := newFakeENA(t)
+	e.addRun("SRR1", "SRR1.fastq.gz")
+	_, _, err := fetchRun(t, e.fetcher(), "SRR1", nil)
+	if err == nil || !strings.Contains(err.Error(), "paired-end") {
+		t.Fatalf("got error %v, want one about a paired-end run", err)
+	}
+}
+
+func TestENAFetchRejectsCorruptFile(t *testing.T) {
+	e := newFakeENA(t)
+	e.addRun("SRR1", "SRR1_1.fastq.gz", "SRR1_2.fastq.gz")
+	e.corrupt["SRR1_2.fastq.gz"] = true
+	outDir, workDir, err := fetchRun(t, e.fetcher(), "SRR1", nil)
+	if err == nil || !strings.Contains(err.Error(), "md5 mismatch") {
+		t.Fatalf("got error %v, want an md5 mismatch", err)
+	}
+	if fileExists(filepath.Join(outDir, "SRR1_2.fastq.gz")) || fileExists(filepath.Join(workDir, "SRR1_2.fastq.gz.part")) {
+		t.Error("the corrupt file was kept")
+	}
+	// The verified mate waits in the work directory for the next attempt.
+	checkFile(t, filepath.Join(workDir, "SRR1_1.fastq.gz"), e.files["SRR1_1.fastq.gz"])
+}
+
+func TestENAFetchResume(t *testing.T) {
+	const name = "SRR1_1.fastq.gz"
+	tests := []struct {
+		name        string
+		ignoreRange bool
+		// part returns the content of the partial file left by an earlier
+		// attempt.
+		part      func(data []byte) []byte
+		wantRange func(data []byte) string
+		// wantRequests is the number of requests for the file.
+		wantRequests int
+	}{
+		{
+			name:         "partial content",
+			part:         func(data []byte) []byte { return data[:100] },
+			wantRange:    func([]byte) string { return "bytes=100-" },
+			wantRequests: 1,
+		},
+		{
+			name:         "range ignored",
+			ignoreRange:  true,
+			part:         func(data []byte) []byte { return data[:100] },
+			wantRange:    func([]byte) string { return "bytes=100-" },
+			wantRequests: 1,
+		},
+		{
+			name:         "range not satisfiable",
+			part:         func(data []byte) []byte { return append(bytes.Clone(data), "junk"...) },
+			wantRange:    func(data []byte) string { return fmt.Sprintf("bytes=%d-", len(data)+4) },
+			wantRequests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newFakeENA(t)
+			e.addRun("SRR1", "SRR1_1.fastq.gz", "SRR1_2.fastq.gz")
+			e.ignoreRange = tt.ignoreRange
+			data := e.files[name]
+			outDir, _, err := fetchRun(t, e.fetcher(), "SRR1", func(workDir string) {
+				if err := os.WriteFile(filepath.Join(workDir, name+".part"), tt.part(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkFile(t, filepath.Join(outDir, name), data)
+
+			var ranges []string
+			for i, req := range e.requests {
+				if req == name {
+					ranges = append(ranges, e.ranges[i])
+				}
+			}
+			if len(ranges) != tt.wantRequests {
+				t.Fatalf("got %d requests for %s, want %d", len(ranges), name, tt.wantRequests)
+			}
+			if want := tt.wantRange(data); ranges[0] != want {
+				t.Errorf("first request has Range %q, want %q", ranges[0], want)
+			}
+			if last := ranges[len(ranges)-1]; tt.wantRequests > 1 && last != "" {
+				t.Errorf("restart has Range %q, want none", last)
+			}
+		})
+	}
+}
+
+func TestENAFetchRetriesServerErrors(t *testing.T) {
+	e := newFakeENA(t)
+	e.addRun("SRR1", "SRR1_1.fastq.gz", "SRR1_2.fastq.gz")
+	e.failures["SRR1_1.fastq.gz"] = 1
+
+	f := e.fetcher()
+	_, _, err := fetchRun(t, f, "SRR1", nil)
+	if err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("got error %v without retries, want a 503", err)
+	}
+
+	e.failures["SRR1_1.fastq.gz"] = 1
+	f.Retries = 1
+	outDir, _, err := fetchRun(t, f, "SRR1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkFile(t, filepath.Join(outDir, "SRR1_1.fastq.gz"), e.files["SRR1_1.fastq.gz"])
+}
@@ -0,0 +1,243 @@
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"bio-assembler/pkg/seqio"
+)
+
+const (
+	// FilteredContigsFile, RemovedContigsFile and ContigFilterStatsFile are
+	// written by FilterContigsStep.
+	FilteredContigsFile   = "filtered_contigs.fasta"
+	RemovedContigsFile    = "removed_contigs.tsv"
+	ContigFilterStatsFile = "contig_filter.json"
+)
+
+// Reasons for removing a contig, as written to removed_contigs.tsv.
+const (
+	reasonShort       = "short"
+	reasonLowCoverage = "low_coverage"
+)
+
+// spadesHeader matches the contig names of SPAdes:
+// NODE_<n>_length_<length>_cov_<k-mer coverage>.
+var spadesHeader = regexp.MustCompile(`^NODE_\d+_length_\d+_cov_(\d+(?:\.\d+)?)`)
+
+// spadesCoverage returns the k-mer coverage in a SPAdes contig name.
+func spadesCoverage(name string) (float64, bool) {
+	m := spadesHeader.FindStringSubmatch(name)
+	if m == nil {
+		return 0, false
+	}
+	cov, err := strconv.ParseFloat(m[1], 64)
+	return cov, err == nil
+}
+
+// ContigFilterStats is written by FilterContigsStep. Contigs are removed
+// for the first reason that applies, in the order of the Removed* fields.
+type ContigFilterStats struct {
+	MinLength   int            `json:"min_length"`
+	MinCoverage float64        `json:"min_coverage"`
+	Input       ContigsSummary `json:"input"`
+	Kept        ContigsSummary `json:"kept"`
+	// RemovedShort and RemovedLowCoverage count the contigs below the
+	// minimum length and k-mer coverage.
+	RemovedShort       int `json:"removed_short"`
+	RemovedLowCoverage int `json:"removed_low_coverage"`
+	// NoCoverage counts the contigs whose name gives no coverage, such as
+	// those of assemblers other than SPAdes; they are filtered by length
+	// only.
+	NoCoverage int `json:"no_coverage"`
+	// Prefix is the prefix the kept contigs were renamed with, if any.
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// ContigsSummary describes a set of contigs.
+type ContigsSummary struct {
+	Contigs int   `json:"contigs"`
+	Length  int64 `json:"length"`
+}
+
+func (c *ContigsSummary) add(length int) {
+	c.Contigs++
+	c.Length += int64(length)
+}
+
+// ReadContigFilterStats loads the statistics written by FilterContigsStep.
+func ReadContigFilterStats(path string) (*ContigFilterStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &ContigFilterStats{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// FilterContigsStep removes contigs of the draft assembly that are shorter
+// than MinLength or, when the contig names carry the k-mer coverage as
+// SPAdes writes them, covered less than MinCoverage. Such contigs are
+// mostly assembly artefacts and contamination. The removed contigs are
+// listed with the reason in removed_contigs.tsv in Output.
+type FilterContigsStep struct {
+	Input  string
+	Output string
+	// MinLength and MinCoverage of 0 keep every contig.
+	MinLength   int
+	MinCoverage float64
+	// Prefix renames the kept contigs to <Prefix>_1, <Prefix>_2, ... in
+	// their original order; the old name follows the new one in the
+	// header. Empty keeps the assembler's names.
+	Prefix string
+}
+
+func (s *FilterContigsStep) Name() string {
+	return "Contig Filtering"
+}
+
+func (s *FilterContigsStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:    s.Output,
+		Inputs: []string{s.Input},
+		Params: map[string]string{
+			"min_length":   fmt.Sprintf("%d", s.MinLength),
+			"min_coverage": fmt.Sprintf("%g", s.MinCoverage),
+			"prefix":       s.Prefix,
+		},
+		ToolVersion: "builtin",
+		Outputs: []string{
+			filepath.Join(s.Output, FilteredContigsFile),
+			filepath.Join(s.Output, RemovedContigsFile),
+			filepath.Join(s.Output, ContigFilterStatsFile),
+		},
+	}, nil
+}
+
+func (s *FilterContigsStep) Run(ctx context.Context) error {
+	fmt.Printf("Filtering contigs (min length %d, min k-mer coverage %g)...\n", s.MinLength, s.MinCoverage)
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	stats, err := s.filter(stage.path(FilteredContigsFile), stage.path(RemovedContigsFile))
+	if err != nil {
+		return err
+	}
+	if stats.Kept.Contigs == 0 {
+		return fmt.Errorf("no contigs of %s passed the filters", s.Input)
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode contig filtering statistics: %w", err)
+	}
+	if err := os.WriteFile(stage.path(ContigFilterStatsFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write contig filtering statistics: %w", err)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	if stats.NoCoverage > 0 && s.MinCoverage > 0 {
+		fmt.Printf("Warning: %d contigs have no k-mer coverage in their name and were filtered by length only.\n", stats.NoCoverage)
+	}
+	fmt.Printf("Kept %d of %d contigs, %d of %d bp (removed %d short, %d low coverage).\n",
+		stats.Kept.Contigs, stats.Input.Contigs, stats.Kept.Length, stats.Input.Length, stats.RemovedShort, stats.RemovedLowCoverage)
+	return nil
+}
+
+// filter writes the contigs that pass to kept and a line for every other
+// contig to removed.
+func (s *FilterContigsStep) filter(kept, removed string) (*ContigFilterStats, error) {
+	in, err := seqio.OpenFasta(s.Input)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+
+	out, err := os.Create(kept)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", kept, err)
+	}
+	defer out.Close()
+	w := seqio.NewFastaWriter(out)
+
+	tsv, err := os.Create(removed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", removed, err)
+	}
+	defer tsv.Close()
+	t := bufio.NewWriter(tsv)
+	fmt.Fprintln(t, "contig\tlength\tcoverage\treason")
+
+	stats := &ContigFilterStats{MinLength: s.MinLength, MinCoverage: s.MinCoverage, Prefix: s.Prefix}
+	for {
+		rec, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", s.Input, err)
+		}
+		name := string(rec.Name())
+		length := len(rec.Seq)
+		stats.Input.add(length)
+
+		cov, hasCov := spadesCoverage(name)
+		if !hasCov {
+			stats.NoCoverage++
+		}
+		reason := ""
+		switch {
+		case length < s.MinLength:
+			reason = reasonShort
+			stats.RemovedShort++
+		case hasCov && cov < s.MinCoverage:
+			reason = reasonLowCoverage
+			stats.RemovedLowCoverage++
+		}
+		if reason != "" {
+			covText := "NA"
+			if hasCov {
+				covText = strconv.FormatFloat(cov, 'f', -1, 64)
+			}
+			fmt.Fprintf(t, "%s\t%d\t%s\t%s\n", name, length, covText, reason)
+			continue
+		}
+
+		stats.Kept.add(length)
+		if s.Prefix != "" {
+			rec.Header = fmt.Appendf(nil, "%s_%d %s", s.Prefix, stats.Kept.Contigs, rec.Header)
+		}
+		if err := w.Write(rec); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", kept, err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", kept, err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", kept, err)
+	}
+	if err := t.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", removed, err)
+	}
+	if err := tsv.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", removed, err)
+	}
+	return stats, nil
+}
@@ -0,0 +1,76 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// flyeDir is Flye's output directory inside the assembly directory.
+const flyeDir = "flye"
+
+// flyeReadOptions maps each long read type to Flye's input option.
+var flyeReadOptions = map[string]string{
+	"nanopore":    "--nano-raw",
+	"nanopore-hq": "--nano-hq",
+	"pacbio":      "--pacbio-raw",
+	"pacbio-hifi": "--pacbio-hifi",
+}
+
+// FlyeAssembler assembles long reads alone with Flye and moves its
+// assembly.fasta to contigs.fasta. The short reads are only used for
+// polishing afterwards.
+type FlyeAssembler struct {
+	Tools Tools
+	// GenomeSize is the expected genome size (e.g. "5m"), passed as
+	// --genome-size; empty lets Flye estimate it.
+	GenomeSize string
+	// ExtraArgs are passed to flye, for example "--iterations 2".
+	ExtraArgs []string
+}
+
+func (a *FlyeAssembler) Name() string {
+	return "Flye"
+}
+
+func (a *FlyeAssembler) Version(ctx context.Context) string {
+	return toolVersion(ctx, a.Tools.bin("flye"), "--version")
+}
+
+func (a *FlyeAssembler) Args() []string {
+	var args []string
+	if a.GenomeSize != "" {
+		args = append(args, "--genome-size", a.GenomeSize)
+	}
+	return append(args, a.ExtraArgs...)
+}
+
+func (a *FlyeAssembler) LongReads() LongReadUse {
+	return LongReadsOnly
+}
+
+func (a *FlyeAssembler) Assemble(ctx context.Context, job *AssemblyJob) error {
+	readOption, ok := flyeReadOptions[job.LongReadType]
+	if !ok {
+		return fmt.Errorf("flye does not support long read type %q", job.LongReadType)
+	}
+	outDir := filepath.Join(job.Dir, flyeDir)
+	args := append([]string{readOption, job.LongReads}, a.Args()...)
+	args = append(args,
+		"--threads", fmt.Sprintf("%d", job.Threads),
+		"--out-dir", outDir)
+	cmd := newCommand(ctx, a.Tools.bin("flye"), args...)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("flye command failed: %w", err)
+	}
+	contigs := filepath.Join(outDir, "assembly.fasta")
+	if !fileExists(contigs) {
+		return fmt.Errorf("flye failed, expected file not found: %s", contigs)
+	}
+	if err := os.Rename(contigs, job.Contigs); err != nil {
+		return fmt.Errorf("failed to move Flye contigs: %w", err)
+	}
+	return nil
+}
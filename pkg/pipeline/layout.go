@@ -0,0 +1,126 @@
+package pipeline
+
+import "path/filepath"
+
+// Layout holds the directories of one sample under data/<sample>. The
+// numbered prefixes keep the step directories in pipeline order.
+type Layout struct {
+	Dir           string
+	Raw           string
+	LongReads     string
+	Validation    string
+	FastQCRaw     string
+	Trimmed       string
+	Adapters      string
+	LongFiltered  string
+	FastQCTrimmed string
+	Assembly      string
+	ContigFilter  string
+	LongPolish    string
+	Mapping       string
+	Polish        string
+	FinalMapping  string
+	Coverage      string
+	Qualimap      string
+	Report        string
+}
+
+// NewLayout returns the layout of the sample stored in dir.
+func NewLayout(dir string) Layout {
+	return Layout{
+		Dir:           dir,
+		Raw:           filepath.Join(dir, "raw_data"),
+		LongReads:     filepath.Join(dir, "raw_long_reads"),
+		Validation:    filepath.Join(dir, "00_read_validation"),
+		FastQCRaw:     filepath.Join(dir, "01_fastqc_raw"),
+		Trimmed:       filepath.Join(dir, "02_trimmed_reads"),
+		Adapters:      filepath.Join(dir, "02_trimmed_reads", "adapter_detection"),
+		LongFiltered:  filepath.Join(dir, "02_long_read_filtering"),
+		FastQCTrimmed: filepath.Join(dir, "03_fastqc_trimmed"),
+		Assembly:      filepath.Join(dir, "04_spades_assembly"),
+		ContigFilter:  filepath.Join(dir, "04_contig_filtering"),
+		LongPolish:    filepath.Join(dir, "05_long_read_polishing"),
+		Mapping:       filepath.Join(dir, "05_read_mapping"),
+		Polish:        filepath.Join(dir, "05_polishing"),
+		FinalMapping:  filepath.Join(dir, "06_final_mapping"),
+		Coverage:      filepath.Join(dir, "07_coverage_stats"),
+		Qualimap:      filepath.Join(dir, "08_qualimap_report"),
+		Report:        filepath.Join(dir, "09_report"),
+	}
+}
+
+// ReadStats is the read statistics written by read validation.
+func (l Layout) ReadStats() string {
+	return filepath.Join(l.Validation, ReadStatsFile)
+}
+
+// AdapterFasta is the adapter file chosen by adapter detection.
+func (l Layout) AdapterFasta() string {
+	return filepath.Join(l.Adapters, adapterFastaFile)
+}
+
+// AdapterDetection is the decision and evidence of adapter detection.
+func (l Layout) AdapterDetection() string {
+	return filepath.Join(l.Adapters, adapterDetectionFile)
+}
+
+// TrimMetrics is the read survival summary of the trimming step.
+func (l Layout) TrimMetrics() string {
+	return filepath.Join(l.Trimmed, TrimMetricsFile)
+}
+
+// FilteredLongReads is the output of long read filtering.
+func (l Layout) FilteredLongReads() string {
+	return filepath.Join(l.LongFiltered, FilteredLongReadsFile)
+}
+
+// LongReadStats is the long read statistics written by long read filtering.
+func (l Layout) LongReadStats() string {
+	return filepath.Join(l.LongFiltered, LongReadStatsFile)
+}
+
+// Contigs is the assembly produced by the assembler.
+func (l Layout) Contigs() string {
+	return filepath.Join(l.Assembly, ContigsFile)
+}
+
+// FilteredContigs is the draft assembly without the contigs removed by
+// contig filtering.
+func (l Layout) FilteredContigs() string {
+	return filepath.Join(l.ContigFilter, FilteredContigsFile)
+}
+
+// ContigFilterStats is the summary written by contig filtering.
+func (l Layout) ContigFilterStats() string {
+	return filepath.Join(l.ContigFilter, ContigFilterStatsFile)
+}
+
+// LongPolishedContigs is the assembly polished with long reads.
+func (l Layout) LongPolishedContigs() string {
+	return filepath.Join(l.LongPolish, LongPolishedFile)
+}
+
+// PolishedContigs is the final, polished assembly.
+func (l Layout) PolishedContigs() string {
+	return filepath.Join(l.Polish, PolishedFile)
+}
+
+// MappedBam is the alignment of the trimmed reads to the draft assembly.
+func (l Layout) MappedBam() string {
+	return filepath.Join(l.Mapping, MappedBamFile)
+}
+
+// FinalBam is the alignment of all trimmed reads to the polished assembly.
+func (l Layout) FinalBam() string {
+	return filepath.Join(l.FinalMapping, MappedBamFile)
+}
+
+// PolishSummary is the number of corrections of every polishing round.
+func (l Layout) PolishSummary() string {
+	return filepath.Join(l.Polish, PolishSummaryFile)
+}
+
+// CoverageStats is the mapping and coverage summary of the final alignment.
+func (l Layout) CoverageStats() string {
+	return filepath.Join(l.Coverage, CoverageStatsFile)
+}
@@ -0,0 +1,235 @@
+package pipeline
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"bio-assembler/pkg/seqio"
+)
+
+// LocalReadsStep makes local FASTQ files available in the sample's raw data
+// directory under the names the rest of the pipeline expects, so later
+// steps do not care where the reads came from.
+//
+// Each of Reads1 and Reads2 lists one file per sequencing lane; lanes are
+// concatenated in the given order. Files may be gzip-compressed or plain
+// FASTQ. A single gzipped file is linked (or copied when Copy is set);
+// anything else is written out as a new gzip file. Leaving Reads2 empty
+// imports a single-end library.
+type LocalReadsStep struct {
+	Reads1 []string
+	Reads2 []string
+	// Sample names the files in Output: <Sample>_1.fastq.gz and
+	// <Sample>_2.fastq.gz, or <Sample>.fastq.gz for single-end reads.
+	Sample string
+	Output string
+	// Copy copies single gzipped inputs instead of symlinking them.
+	Copy bool
+}
+
+func (s *LocalReadsStep) Name() string {
+	return "Import Local Reads"
+}
+
+// LocalReadsOutputs returns the raw read files LocalReadsStep produces for
+// a sample. fq2 is empty for single-end libraries.
+func LocalReadsOutputs(dir, sample string, singleEnd bool) (fq1, fq2 string) {
+	if singleEnd {
+		return filepath.Join(dir, sample+".fastq.gz"), ""
+	}
+	return filepath.Join(dir, sample+"_1.fastq.gz"), filepath.Join(dir, sample+"_2.fastq.gz")
+}
+
+func (s *LocalReadsStep) singleEnd() bool {
+	return len(s.Reads2) == 0
+}
+
+func (s *LocalReadsStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	out1, out2 := LocalReadsOutputs(s.Output, s.Sample, s.singleEnd())
+	outputs := []string{out1}
+	if out2 != "" {
+		outputs = append(outputs, out2)
+	}
+	inputs := append(append([]string{}, s.Reads1...), s.Reads2...)
+	return &CacheSpec{
+		Dir:    s.Output,
+		Inputs: inputs,
+		Params: map[string]string{
+			"lanes_1": fmt.Sprintf("%d", len(s.Reads1)),
+			"lanes_2": fmt.Sprintf("%d", len(s.Reads2)),
+		},
+		ToolVersion: "builtin",
+		Outputs:     outputs,
+	}, nil
+}
+
+func (s *LocalReadsStep) Run(ctx context.Context) error {
+	if len(s.Reads1) == 0 {
+		return fmt.Errorf("no input FASTQ files given for sample %s", s.Sample)
+	}
+	if !s.singleEnd() && len(s.Reads1) != len(s.Reads2) {
+		return fmt.Errorf("read 1 has %d lane file(s) but read 2 has %d", len(s.Reads1), len(s.Reads2))
+	}
+
+	layout := "paired-end"
+	if s.singleEnd() {
+		layout = "single-end"
+	}
+	fmt.Printf("Importing local %s reads for sample %s...\n", layout, s.Sample)
+
+	for _, in := range append(append([]string{}, s.Reads1...), s.Reads2...) {
+		if err := checkFastqInput(in); err != nil {
+			return err
+		}
+	}
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	out1, out2 := LocalReadsOutputs(s.Output, s.Sample, s.singleEnd())
+	if err := importLanes(ctx, s.Reads1, stage.path(filepath.Base(out1)), s.Copy); err != nil {
+		return err
+	}
+	if out2 != "" {
+		if err := importLanes(ctx, s.Reads2, stage.path(filepath.Base(out2)), s.Copy); err != nil {
+			return err
+		}
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	fmt.Println("Local reads imported.")
+	return nil
+}
+
+// importLanes writes the lanes of one read direction to dst as a single
+// gzipped FASTQ file. A single gzipped lane is symlinked, or copied when
+// copy is set.
+func importLanes(ctx context.Context, lanes []string, dst string, copy bool) error {
+	if len(lanes) == 1 && isGzipFile(lanes[0]) {
+		if copy {
+			return copyFile(lanes[0], dst)
+		}
+		abs, err := filepath.Abs(lanes[0])
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s: %w", lanes[0], err)
+		}
+		if err := os.Symlink(abs, dst); err != nil {
+			return fmt.Errorf("failed to link %s: %w", lanes[0], err)
+		}
+		return nil
+	}
+
+	if len(lanes) > 1 {
+		fmt.Printf("Concatenating %d lanes into %s\n", len(lanes), filepath.Base(dst))
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	// A concatenation of gzip files is itself a valid (multi-member) gzip
+	// file, so compressed lanes are appended as-is and only plain FASTQ
+	// lanes need to be compressed.
+	for _, lane := range lanes {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := appendLane(out, lane); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+func appendLane(out io.Writer, lane string) error {
+	in, err := os.Open(lane)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", lane, err)
+	}
+	defer in.Close()
+
+	if isGzipFile(lane) {
+		if _, err := io.Copy(out, in); err != nil {
+			return fmt.Errorf("failed to append %s: %w", lane, err)
+		}
+		return nil
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, bufio.NewReaderSize(in, 1<<20)); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", lane, err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", lane, err)
+	}
+	return nil
+}
+
+// checkFastqInput makes sure a local reads file exists, is not truncated
+// (for gzip input) and starts with a FASTQ record.
+func checkFastqInput(path string) error {
+	if !fileExists(path) {
+		return fmt.Errorf("input FASTQ file not found: %s", path)
+	}
+	if isGzipFile(path) && !gzipIntegrityOK(path) {
+		return fmt.Errorf("input FASTQ file is not a valid gzip stream (possible truncation): %s", path)
+	}
+
+	r, err := seqio.OpenFastq(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	r.Validate = true
+	if _, err := r.Read(); err == io.EOF {
+		return fmt.Errorf("input %s contains no FASTQ records", path)
+	} else if err != nil {
+		return fmt.Errorf("input %s does not look like FASTQ: %w", path, err)
+	}
+	return nil
+}
+
+// isGzipFile reports whether a file starts with the gzip magic bytes.
+func isGzipFile(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(f, magic); err != nil {
+		return false
+	}
+	return magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", src, err)
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,198 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LongPolishedFile is the assembly polished with long reads.
+const LongPolishedFile = "long_polished.fasta"
+
+// LongPolishers lists the accepted long-read polishers. "auto" picks Medaka
+// for Nanopore reads and Racon for PacBio reads; "none" skips long-read
+// polishing.
+var LongPolishers = []string{"auto", "medaka", "racon", "none"}
+
+// LongPolisherFor resolves "auto" to the polisher suited to a long read type.
+func LongPolisherFor(polisher, readType string) string {
+	if polisher != "auto" {
+		return polisher
+	}
+	if isNanopore(readType) {
+		return "medaka"
+	}
+	return "racon"
+}
+
+// minimap2Presets maps each long read type to minimap2's -x preset.
+var minimap2Presets = map[string]string{
+	"nanopore":    "map-ont",
+	"nanopore-hq": "map-ont",
+	"pacbio":      "map-pb",
+	"pacbio-hifi": "map-hifi",
+}
+
+// LongPolishStep polishes the draft assembly with the long reads, before
+// Pilon corrects the remaining small errors with the short reads. Racon
+// runs Rounds times, each round re-mapping the reads with minimap2 to the
+// previous round's output; Medaka runs once.
+type LongPolishStep struct {
+	ContigsIn string
+	LongReads string
+	// ReadType is one of LongReadTypes.
+	ReadType string
+	Output   string
+	Threads  int
+	Tools    Tools
+	// Polisher is "medaka" or "racon".
+	Polisher string
+	// Rounds is the number of Racon rounds.
+	Rounds int
+	// MedakaModel is passed to medaka_consensus as -m; empty keeps
+	// Medaka's default model.
+	MedakaModel string
+	// ExtraArgs are passed to racon or medaka_consensus.
+	ExtraArgs []string
+}
+
+func (s *LongPolishStep) Name() string {
+	if s.Polisher == "medaka" {
+		return "Medaka Polishing"
+	}
+	return "Racon Polishing"
+}
+
+func (s *LongPolishStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	params := map[string]string{
+		"polisher":   s.Polisher,
+		"read_type":  s.ReadType,
+		"extra_args": strings.Join(s.ExtraArgs, " "),
+	}
+	var version string
+	if s.Polisher == "medaka" {
+		params["model"] = s.MedakaModel
+		version = toolVersion(ctx, s.Tools.bin("medaka"), "--version")
+	} else {
+		params["rounds"] = fmt.Sprintf("%d", s.Rounds)
+		version = strings.Join([]string{
+			toolVersion(ctx, s.Tools.bin("racon"), "--version"),
+			toolVersion(ctx, s.Tools.bin("minimap2"), "--version"),
+		}, "; ")
+	}
+	return &CacheSpec{
+		Dir:         s.Output,
+		Inputs:      []string{s.ContigsIn, s.LongReads},
+		Params:      params,
+		ToolVersion: version,
+		Outputs:     []string{filepath.Join(s.Output, LongPolishedFile)},
+	}, nil
+}
+
+func (s *LongPolishStep) Run(ctx context.Context) error {
+	fmt.Printf("Running %s with %s reads...\n", s.Name(), s.ReadType)
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	polished := stage.path(LongPolishedFile)
+	switch s.Polisher {
+	case "medaka":
+		err = s.medaka(ctx, stage, polished)
+	case "racon":
+		err = s.racon(ctx, stage, polished)
+	default:
+		err = fmt.Errorf("unknown long-read polisher %q", s.Polisher)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !fastaLooksValid(polished) {
+		return fmt.Errorf("%s produced an empty or malformed FASTA: %s", s.Polisher, polished)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	fmt.Printf("%s completed.\n", s.Name())
+	return nil
+}
+
+func (s *LongPolishStep) medaka(ctx context.Context, stage *staging, polished string) error {
+	if !isNanopore(s.ReadType) {
+		return fmt.Errorf("medaka only polishes with Nanopore reads, not %s; use racon instead", s.ReadType)
+	}
+	outDir := stage.path("medaka")
+	args := []string{"-i", s.LongReads, "-d", s.ContigsIn, "-o", outDir, "-t", fmt.Sprintf("%d", s.Threads)}
+	if s.MedakaModel != "" {
+		args = append(args, "-m", s.MedakaModel)
+	}
+	args = append(args, s.ExtraArgs...)
+	cmd := newCommand(ctx, s.Tools.bin("medaka_consensus"), args...)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("medaka_consensus command failed: %w", err)
+	}
+
+	consensus := filepath.Join(outDir, "consensus.fasta")
+	if !fileExists(consensus) {
+		return fmt.Errorf("medaka failed, expected file not found: %s", consensus)
+	}
+	if err := os.Rename(consensus, polished); err != nil {
+		return fmt.Errorf("failed to move Medaka consensus: %w", err)
+	}
+	// The alignments and probabilities Medaka leaves behind are large and
+	// of no further use.
+	return os.RemoveAll(outDir)
+}
+
+func (s *LongPolishStep) racon(ctx context.Context, stage *staging, polished string) error {
+	preset, ok := minimap2Presets[s.ReadType]
+	if !ok {
+		return fmt.Errorf("unknown long read type %q", s.ReadType)
+	}
+	threads := fmt.Sprintf("%d", s.Threads)
+	overlaps := stage.path("overlaps.paf")
+	contigs := s.ContigsIn
+	for round := 1; round <= max(s.Rounds, 1); round++ {
+		fmt.Printf("Racon round %d...\n", round)
+		if err := runToFile(ctx, overlaps, s.Tools.bin("minimap2"), "-t", threads, "-x", preset, contigs, s.LongReads); err != nil {
+			return err
+		}
+		out := stage.path(fmt.Sprintf("racon_r%d.fasta", round))
+		args := append([]string{"-t", threads}, s.ExtraArgs...)
+		args = append(args, s.LongReads, overlaps, contigs)
+		if err := runToFile(ctx, out, s.Tools.bin("racon"), args...); err != nil {
+			return err
+		}
+		if !fastaLooksValid(out) {
+			return fmt.Errorf("racon round %d produced an empty or malformed FASTA: %s", round, out)
+		}
+		contigs = out
+	}
+	if err := os.Remove(overlaps); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", overlaps, err)
+	}
+	return os.Rename(contigs, polished)
+}
+
+// runToFile runs a tool that writes its result to stdout, saving it to path.
+func runToFile(ctx context.Context, path, name string, args ...string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer out.Close()
+
+	cmd := newCommand(ctx, name, args...)
+	cmd.Stdout = out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s command failed: %w", filepath.Base(name), err)
+	}
+	return out.Close()
+}
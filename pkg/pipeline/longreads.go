@@ -0,0 +1,397 @@
+package pipeline
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"bio-assembler/pkg/seqio"
+)
+
+const (
+	// FilteredLongReadsFile and LongReadStatsFile are written by
+	// FilterLongReadsStep.
+	FilteredLongReadsFile = "filtered_long_reads.fastq.gz"
+	LongReadStatsFile     = "long_read_stats.json"
+)
+
+// LongReadTypes lists the accepted long read technologies. The "-hq" and
+// "-hifi" variants are for reads with error rates below a few percent
+// (Nanopore Q20+ chemistry, PacBio CCS).
+var LongReadTypes = []string{"nanopore", "nanopore-hq", "pacbio", "pacbio-hifi"}
+
+// isNanopore reports whether a long read type is one of the Nanopore types.
+func isNanopore(readType string) bool {
+	return strings.HasPrefix(readType, "nanopore")
+}
+
+// ImportLongReadsStep places local long read files in Output as a single
+// <Sample>_long.fastq.gz, concatenating several runs in the given order.
+type ImportLongReadsStep struct {
+	Reads  []string
+	Sample string
+	Output string
+	// Copy copies a single gzipped input instead of symlinking it.
+	Copy bool
+}
+
+func (s *ImportLongReadsStep) Name() string {
+	return "Import Long Reads"
+}
+
+// LongReadsOutput returns the file ImportLongReadsStep produces for a sample.
+func LongReadsOutput(dir, sample string) string {
+	return filepath.Join(dir, sample+"_long.fastq.gz")
+}
+
+func (s *ImportLongReadsStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:         s.Output,
+		Inputs:      s.Reads,
+		Params:      map[string]string{"runs": fmt.Sprintf("%d", len(s.Reads))},
+		ToolVersion: "builtin",
+		Outputs:     []string{LongReadsOutput(s.Output, s.Sample)},
+	}, nil
+}
+
+func (s *ImportLongReadsStep) Run(ctx context.Context) error {
+	if len(s.Reads) == 0 {
+		return fmt.Errorf("no long read files given for sample %s", s.Sample)
+	}
+	fmt.Printf("Importing long reads for sample %s...\n", s.Sample)
+
+	for _, in := range s.Reads {
+		if err := checkFastqInput(in); err != nil {
+			return err
+		}
+	}
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	out := LongReadsOutput(s.Output, s.Sample)
+	if err := importLanes(ctx, s.Reads, stage.path(filepath.Base(out)), s.Copy); err != nil {
+		return err
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	fmt.Println("Long reads imported.")
+	return nil
+}
+
+// LongReadStats is written by FilterLongReadsStep. Reads are removed for
+// the first reason that applies, in the order of the Removed* fields.
+type LongReadStats struct {
+	Type     string           `json:"type"`
+	Input    LongReadsSummary `json:"input"`
+	Filtered LongReadsSummary `json:"filtered"`
+	// RemovedShort and RemovedLowQuality count reads below the minimum
+	// length and mean quality; RemovedOverTarget counts the reads left out
+	// once the target number of bases was reached.
+	RemovedShort      int64 `json:"removed_short"`
+	RemovedLowQuality int64 `json:"removed_low_quality"`
+	RemovedOverTarget int64 `json:"removed_over_target"`
+}
+
+// LongReadsSummary describes a set of long reads.
+type LongReadsSummary struct {
+	Reads      int64   `json:"reads"`
+	Bases      int64   `json:"bases"`
+	MeanLength float64 `json:"mean_length"`
+	N50        int     `json:"n50"`
+	MaxLength  int     `json:"max_length"`
+	// MeanQuality is the Phred score of the mean error probability.
+	MeanQuality float64 `json:"mean_quality"`
+}
+
+// ReadLongReadStats loads the statistics written by FilterLongReadsStep.
+func ReadLongReadStats(path string) (*LongReadStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &LongReadStats{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// longReadsSummaryBuilder accumulates a LongReadsSummary read by read.
+type longReadsSummaryBuilder struct {
+	lengths []int32
+	bases   int64
+	errors  float64
+}
+
+func (b *longReadsSummaryBuilder) add(length int, errors float64) {
+	b.lengths = append(b.lengths, int32(length))
+	b.bases += int64(length)
+	b.errors += errors
+}
+
+func (b *longReadsSummaryBuilder) summary() LongReadsSummary {
+	s := LongReadsSummary{Reads: int64(len(b.lengths)), Bases: b.bases}
+	if s.Reads == 0 {
+		return s
+	}
+	s.MeanLength = float64(b.bases) / float64(s.Reads)
+	s.MeanQuality = phredOf(b.errors / float64(b.bases))
+
+	lengths := slices.Clone(b.lengths)
+	slices.SortFunc(lengths, func(a, b int32) int { return cmp.Compare(b, a) })
+	s.MaxLength = int(lengths[0])
+	var sum int64
+	for _, l := range lengths {
+		sum += int64(l)
+		if 2*sum >= b.bases {
+			s.N50 = int(l)
+			break
+		}
+	}
+	return s
+}
+
+// errorProbs maps a Phred+33 quality character to its error probability.
+var errorProbs = func() [256]float64 {
+	var p [256]float64
+	for c := range p {
+		q := max(c-33, 0)
+		p[c] = math.Pow(10, -float64(q)/10)
+	}
+	return p
+}()
+
+// readErrors is the expected number of errors in a read.
+func readErrors(qual []byte) float64 {
+	var sum float64
+	for _, c := range qual {
+		sum += errorProbs[c]
+	}
+	return sum
+}
+
+func phredOf(errorRate float64) float64 {
+	if errorRate <= 0 {
+		return 0
+	}
+	return -10 * math.Log10(errorRate)
+}
+
+// FilterLongReadsStep removes long reads that are too short or of too low
+// mean quality and, when TargetBases is set, keeps only the best reads up to
+// that many bases, similar to Filtlong. The statistics of the reads before
+// and after filtering are written to long_read_stats.json in Output.
+type FilterLongReadsStep struct {
+	Input  string
+	Output string
+	// Type is the long read technology, recorded in the statistics.
+	Type      string
+	MinLength int
+	// MinMeanQuality is the lowest accepted Phred score of a read's mean
+	// error probability.
+	MinMeanQuality float64
+	// TargetBases keeps the reads of highest mean quality until this many
+	// bases are selected; 0 keeps every read that passes the filters.
+	TargetBases int64
+}
+
+func (s *FilterLongReadsStep) Name() string {
+	return "Long Read Filtering"
+}
+
+func (s *FilterLongReadsStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:    s.Output,
+		Inputs: []string{s.Input},
+		Params: map[string]string{
+			"type":             s.Type,
+			"min_length":       fmt.Sprintf("%d", s.MinLength),
+			"min_mean_quality": fmt.Sprintf("%g", s.MinMeanQuality),
+			"target_bases":     fmt.Sprintf("%d", s.TargetBases),
+		},
+		ToolVersion: "builtin",
+		Outputs: []string{
+			filepath.Join(s.Output, FilteredLongReadsFile),
+			filepath.Join(s.Output, LongReadStatsFile),
+		},
+	}, nil
+}
+
+func (s *FilterLongReadsStep) Run(ctx context.Context) error {
+	fmt.Printf("Filtering long reads (min length %d, min mean quality %g)...\n", s.MinLength, s.MinMeanQuality)
+
+	// Picking the best reads up to a number of bases needs all of them
+	// scored first, so the target costs an extra pass over the input.
+	var selected []bool
+	if s.TargetBases > 0 {
+		var err error
+		if selected, err = s.selectTarget(ctx); err != nil {
+			return err
+		}
+	}
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	stats, err := s.filter(ctx, stage.path(FilteredLongReadsFile), selected)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode long read statistics: %w", err)
+	}
+	if err := os.WriteFile(stage.path(LongReadStatsFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write long read statistics: %w", err)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	in, out := stats.Input, stats.Filtered
+	fmt.Printf("Long reads: %d reads, %d bases, N50 %d, mean quality %.1f\n", in.Reads, in.Bases, in.N50, in.MeanQuality)
+	fmt.Printf("Kept %d reads, %d bases, N50 %d, mean quality %.1f (removed %d short, %d low quality, %d over target)\n",
+		out.Reads, out.Bases, out.N50, out.MeanQuality, stats.RemovedShort, stats.RemovedLowQuality, stats.RemovedOverTarget)
+	return nil
+}
+
+// passes reports whether a read meets the length and quality minimums.
+func (s *FilterLongReadsStep) passes(length int, errors float64) bool {
+	return length >= s.MinLength && length > 0 && phredOf(errors/float64(length)) >= s.MinMeanQuality
+}
+
+// selectTarget marks, by position in the input, the reads of highest mean
+// quality that together reach TargetBases. Reads failing the minimums are
+// never selected.
+func (s *FilterLongReadsStep) selectTarget(ctx context.Context) ([]bool, error) {
+	type candidate struct {
+		index  int
+		length int
+		errors float64
+	}
+	var (
+		candidates []candidate
+		reads      int
+	)
+	err := s.scan(ctx, func(rec *seqio.Record, errors float64) error {
+		if s.passes(len(rec.Seq), errors) {
+			candidates = append(candidates, candidate{reads, len(rec.Seq), errors})
+		}
+		reads++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Lowest error rate first; longer reads win ties.
+	slices.SortFunc(candidates, func(a, b candidate) int {
+		if c := cmp.Compare(a.errors/float64(a.length), b.errors/float64(b.length)); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.length, a.length)
+	})
+	selected := make([]bool, reads)
+	var bases int64
+	for _, c := range candidates {
+		if bases >= s.TargetBases {
+			break
+		}
+		selected[c.index] = true
+		bases += int64(c.length)
+	}
+	return selected, nil
+}
+
+// filter writes the reads that pass the minimums, and are among selected
+// when that is set, to dst.
+func (s *FilterLongReadsStep) filter(ctx context.Context, dst string, selected []bool) (*LongReadStats, error) {
+	out, err := seqio.Create(dst, seqio.Gzip)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+	w := seqio.NewFastqWriter(out)
+
+	stats := &LongReadStats{Type: s.Type}
+	var input, filtered longReadsSummaryBuilder
+	index := 0
+	err = s.scan(ctx, func(rec *seqio.Record, errors float64) error {
+		i := index
+		index++
+		input.add(len(rec.Seq), errors)
+		switch {
+		case len(rec.Seq) < max(s.MinLength, 1):
+			stats.RemovedShort++
+			return nil
+		case !s.passes(len(rec.Seq), errors):
+			stats.RemovedLowQuality++
+			return nil
+		case selected != nil && (i >= len(selected) || !selected[i]):
+			stats.RemovedOverTarget++
+			return nil
+		}
+		filtered.add(len(rec.Seq), errors)
+		return w.Write(rec)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+
+	stats.Input = input.summary()
+	stats.Filtered = filtered.summary()
+	if stats.Input.Reads == 0 {
+		return nil, fmt.Errorf("no reads found in %s", s.Input)
+	}
+	if stats.Filtered.Reads == 0 {
+		return nil, fmt.Errorf("none of the %d long reads passed filtering; lower the minimum length or quality", stats.Input.Reads)
+	}
+	return stats, nil
+}
+
+// scan calls fn with every read of Input and its expected number of errors.
+func (s *FilterLongReadsStep) scan(ctx context.Context, fn func(rec *seqio.Record, errors float64) error) error {
+	r, err := seqio.OpenFastq(s.Input)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	r.Validate = true
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid long reads in %s: %w", s.Input, err)
+		}
+		if err := fn(rec, readErrors(rec.Qual)); err != nil {
+			return err
+		}
+		if r.Records()%10000 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// megahitDir is MEGAHIT's output directory inside the assembly directory.
+// MEGAHIT refuses to write to a directory that already exists, so it gets
+// one of its own.
+const megahitDir = "megahit"
+
+// MegahitAssembler assembles with MEGAHIT and moves its final.contigs.fa to
+// contigs.fasta.
+type MegahitAssembler struct {
+	Tools Tools
+	// Kmers replaces MEGAHIT's default k-mer list (--k-list).
+	Kmers []int
+	// ExtraArgs are passed to megahit, for example "--presets meta-large".
+	ExtraArgs []string
+}
+
+func (a *MegahitAssembler) Name() string {
+	return "MEGAHIT"
+}
+
+func (a *MegahitAssembler) Version(ctx context.Context) string {
+	return toolVersion(ctx, a.Tools.bin("megahit"), "--version")
+}
+
+func (a *MegahitAssembler) Args() []string {
+	var args []string
+	if len(a.Kmers) > 0 {
+		args = append(args, "--k-list", joinInts(a.Kmers))
+	}
+	return append(args, a.ExtraArgs...)
+}
+
+func (a *MegahitAssembler) LongReads() LongReadUse {
+	return LongReadsUnsupported
+}
+
+func (a *MegahitAssembler) Assemble(ctx context.Context, job *AssemblyJob) error {
+	outDir := filepath.Join(job.Dir, megahitDir)
+	args := a.Args()
+	args = append(args,
+		"-t", fmt.Sprintf("%d", job.Threads),
+		// MEGAHIT takes the memory limit in bytes.
+		"-m", fmt.Sprintf("%d", int64(job.Memory)<<30),
+		"-o", outDir)
+	if job.singleEnd() {
+		args = append(args, "-r", job.Input1)
+	} else {
+		args = append(args, "-1", job.Input1, "-2", job.Input2)
+	}
+	cmd := newCommand(ctx, a.Tools.bin("megahit"), args...)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("megahit command failed: %w", err)
+	}
+	contigs := filepath.Join(outDir, "final.contigs.fa")
+	if !fileExists(contigs) {
+		return fmt.Errorf("megahit failed, expected file not found: %s", contigs)
+	}
+	if err := os.Rename(contigs, job.Contigs); err != nil {
+		return fmt.Errorf("failed to move MEGAHIT contigs: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+)
+
+// Minimap2Aligner aligns with minimap2's short-read preset. minimap2
+// indexes the reference on the fly, so it needs no index on disk.
+type Minimap2Aligner struct {
+	Tools Tools
+	// ExtraArgs are passed to minimap2.
+	ExtraArgs []string
+}
+
+func (a *Minimap2Aligner) Name() string {
+	return "minimap2"
+}
+
+func (a *Minimap2Aligner) Version(ctx context.Context) string {
+	return toolVersion(ctx, a.Tools.bin("minimap2"), "--version")
+}
+
+func (a *Minimap2Aligner) Args() []string {
+	return a.ExtraArgs
+}
+
+func (a *Minimap2Aligner) Index(ctx context.Context, reference string, threads int) error {
+	return nil
+}
+
+func (a *Minimap2Aligner) IndexFiles(reference string) []string {
+	return nil
+}
+
+func (a *Minimap2Aligner) Command(ctx context.Context, job *AlignJob) *exec.Cmd {
+	args := append([]string{"-a", "-x", "sr", "-t", fmt.Sprintf("%d", job.Threads)}, a.ExtraArgs...)
+	args = append(args, job.Reference)
+	args = append(args, nonEmpty(job.Reads1, job.Reads2)...)
+	return newCommand(ctx, a.Tools.bin("minimap2"), args...)
+}
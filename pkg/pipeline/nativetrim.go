@@ -0,0 +1,671 @@
+package pipeline
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"bio-assembler/pkg/seqio"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// Adapter clipping parameters, matching ILLUMINACLIP:<file>:2:30:10
+	// with Trimmomatic's default minimum adapter length of 8.
+	clipSeedLength      = 16
+	clipSeedMismatches  = 2
+	clipPalindromeScore = 30
+	clipSimpleScore     = 10
+	clipMinAdapter      = 8
+	// clipMatchScore is what every matching base adds to an alignment
+	// score; mismatches subtract a tenth of the base quality.
+	clipMatchScore = 0.60206 // log10(4)
+	// clipPrefixQuality stands in for the quality of adapter bases, which
+	// have none.
+	clipPrefixQuality = 40
+
+	// nativeBatchSize is the number of reads (pairs) handed to a worker.
+	nativeBatchSize = 4096
+)
+
+// NativeTrimmer is the built-in trimmer, used when Trimmomatic is not
+// available. It implements the Trimmomatic operations of the presets with
+// the same semantics: ILLUMINACLIP (simple and palindrome clipping, with
+// the reverse read dropped after a palindrome hit as Trimmomatic does by
+// default), LEADING, TRAILING, SLIDINGWINDOW and MINLEN. Custom mode takes
+// the same Trimmomatic-style steps, except ILLUMINACLIP, which always uses
+// the adapter file.
+type NativeTrimmer struct{}
+
+func (t *NativeTrimmer) Name() string {
+	return "Native Trimmer"
+}
+
+func (t *NativeTrimmer) Version(ctx context.Context) string {
+	return "builtin"
+}
+
+func (t *NativeTrimmer) DetectsAdapters() bool {
+	return false
+}
+
+func (t *NativeTrimmer) Logs() []string {
+	return nil
+}
+
+func (t *NativeTrimmer) Trim(ctx context.Context, job *TrimJob) (*TrimMetrics, error) {
+	if len(job.ExtraArgs) > 0 {
+		return nil, fmt.Errorf("the native trimmer does not take extra arguments, got %q", strings.Join(job.ExtraArgs, " "))
+	}
+	clipper, err := loadAdapterClipper(job.AdapterFasta)
+	if err != nil {
+		return nil, err
+	}
+	var ops []qualityOp
+	if p := job.Preset; p != nil {
+		ops = presetOps(*p)
+	} else if ops, err = parseQualityOps(job.CustomArgs); err != nil {
+		return nil, err
+	}
+
+	e := &nativeTrim{job: job, clipper: clipper, ops: ops}
+	return e.run(ctx, max(job.Threads, 1))
+}
+
+// cutRead keeps bases start to end of a read.
+func cutRead(r *seqio.Record, start, end int) {
+	r.Seq = r.Seq[start:end]
+	r.Qual = r.Qual[start:end]
+}
+
+// qualityOp trims a read given its qualities (Phred scores) and returns
+// the part to keep.
+type qualityOp func(q []byte) (start, end int)
+
+func presetOps(p trimPreset) []qualityOp {
+	return []qualityOp{leadingOp(p.Leading), trailingOp(p.Trailing), slidingWindowOp(p.Window, p.WindowQuality), minLenOp(p.MinLength)}
+}
+
+// parseQualityOps reads Trimmomatic-style steps such as "LEADING:3
+// SLIDINGWINDOW:4:20".
+func parseQualityOps(steps []string) ([]qualityOp, error) {
+	var ops []qualityOp
+	for _, step := range steps {
+		name, rest, _ := strings.Cut(step, ":")
+		var values []int
+		for _, f := range strings.Split(rest, ":") {
+			v, err := strconv.Atoi(f)
+			if err != nil {
+				values = nil
+				break
+			}
+			values = append(values, v)
+		}
+		switch {
+		case name == "ILLUMINACLIP":
+			// Adapters are clipped with the configured file.
+		case name == "TOPHRED33" && rest == "":
+			// Outputs are always Phred+33.
+		case name == "LEADING" && len(values) == 1:
+			ops = append(ops, leadingOp(values[0]))
+		case name == "TRAILING" && len(values) == 1:
+			ops = append(ops, trailingOp(values[0]))
+		case name == "SLIDINGWINDOW" && len(values) == 2 && values[0] > 0:
+			ops = append(ops, slidingWindowOp(values[0], values[1]))
+		case name == "MINLEN" && len(values) == 1:
+			ops = append(ops, minLenOp(values[0]))
+		default:
+			return nil, fmt.Errorf("the native trimmer does not support the step %q (supported: LEADING, TRAILING, SLIDINGWINDOW, MINLEN)", step)
+		}
+	}
+	return ops, nil
+}
+
+func leadingOp(min int) qualityOp {
+	return func(q []byte) (int, int) {
+		start := 0
+		for start < len(q) && int(q[start]) < min {
+			start++
+		}
+		return start, len(q)
+	}
+}
+
+func trailingOp(min int) qualityOp {
+	return func(q []byte) (int, int) {
+		end := len(q)
+		for end > 0 && int(q[end-1]) < min {
+			end--
+		}
+		return 0, end
+	}
+}
+
+// slidingWindowOp cuts the read at the first window whose mean quality is
+// below min, keeping the leading bases of that window that pass on their
+// own.
+func slidingWindowOp(window, min int) qualityOp {
+	return func(q []byte) (int, int) {
+		if len(q) < window {
+			return 0, len(q)
+		}
+		required := window * min
+		total := 0
+		for i := 0; i < window; i++ {
+			total += int(q[i])
+		}
+		for i := 0; ; i++ {
+			if total < required {
+				keep := i
+				for keep < len(q) && int(q[keep]) >= min {
+					keep++
+				}
+				return 0, keep
+			}
+			if i+window >= len(q) {
+				return 0, len(q)
+			}
+			total += int(q[i+window]) - int(q[i])
+		}
+	}
+}
+
+func minLenOp(min int) qualityOp {
+	return func(q []byte) (int, int) {
+		if len(q) < min {
+			return 0, 0
+		}
+		return 0, len(q)
+	}
+}
+
+// adapterClipper holds the sequences of an adapter FASTA. Records named
+// Prefix.../1 and .../2 are the adapters ligated before the forward and
+// reverse reads and drive palindrome clipping of pairs; other records are
+// searched for in the reads directly, in forward reads only when their
+// name ends in /1 and reverse reads only when it ends in /2.
+type adapterClipper struct {
+	forward, reverse []string
+	prefix1, prefix2 string
+	// rcPrefix2 is the reverse complement of prefix2.
+	rcPrefix2 string
+	// single are the sequences searched for in single-end reads, where
+	// prefixes are treated as ordinary adapters.
+	single []string
+}
+
+func loadAdapterClipper(path string) (*adapterClipper, error) {
+	r, err := seqio.OpenFasta(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read adapter FASTA: %w", err)
+	}
+	defer r.Close()
+
+	c := &adapterClipper{}
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read adapter FASTA %s: %w", path, err)
+		}
+		name, s := string(rec.Name()), strings.ToUpper(string(rec.Seq))
+		if s == "" {
+			continue
+		}
+		c.single = append(c.single, s)
+		switch {
+		case strings.HasPrefix(name, "Prefix") && strings.HasSuffix(name, "/1"):
+			c.prefix1 = s
+		case strings.HasPrefix(name, "Prefix") && strings.HasSuffix(name, "/2"):
+			c.prefix2 = s
+			c.rcPrefix2 = reverseComplement(s)
+		case strings.HasSuffix(name, "/1"):
+			c.forward = append(c.forward, s)
+		case strings.HasSuffix(name, "/2"):
+			c.reverse = append(c.reverse, s)
+		default:
+			c.forward = append(c.forward, s)
+			c.reverse = append(c.reverse, s)
+		}
+	}
+	if len(c.single) == 0 {
+		return nil, fmt.Errorf("adapter FASTA %s has no sequences", path)
+	}
+	return c, nil
+}
+
+// clipSimple returns the position of the earliest adapter found in the
+// read, or the read length.
+func clipSimple(adapters []string, seq, qual []byte) int {
+	clip := len(seq)
+	// A score of clipSimpleScore needs this many matching bases.
+	minOverlap := int(math.Ceil(clipSimpleScore / clipMatchScore))
+	for _, a := range adapters {
+		for p := 0; p+minOverlap <= len(seq) && p < clip; p++ {
+			overlap := min(len(a), len(seq)-p)
+			if !seedMatches(seq[p:p+overlap], a) {
+				continue
+			}
+			score := 0.0
+			for i := 0; i < overlap; i++ {
+				score += baseScore(seq[p+i], a[i], qual[p+i])
+			}
+			if score >= clipSimpleScore {
+				clip = p
+				break
+			}
+		}
+	}
+	return clip
+}
+
+// clipPalindrome looks for the insert length at which the forward read,
+// behind its prefix, lines up with the reverse complement of the reverse
+// read and its prefix. It returns -1 when the reads do not read through
+// into the adapters.
+func (c *adapterClipper) clipPalindrome(r1, r2 *seqio.Record) int {
+	p1, p2 := c.prefix1, c.rcPrefix2
+	// a is the forward read behind its prefix, b the reverse complement of
+	// the reverse read followed by that of its prefix.
+	a := func(i int) (byte, byte) {
+		if i < len(p1) {
+			return p1[i], clipPrefixQuality
+		}
+		return r1.Seq[i-len(p1)], r1.Qual[i-len(p1)]
+	}
+	b := func(j int) (byte, byte) {
+		if j < len(r2.Seq) {
+			k := len(r2.Seq) - 1 - j
+			return complementBase(r2.Seq[k]), r2.Qual[k]
+		}
+		return p2[j-len(r2.Seq)], clipPrefixQuality
+	}
+	lenA, lenB := len(p1)+len(r1.Seq), len(r2.Seq)+len(p2)
+
+	maxInsert := min(len(r1.Seq), len(r2.Seq)) - clipMinAdapter
+	for insert := 0; insert <= maxInsert; insert++ {
+		// b ends where the reverse prefix ends on the forward strand.
+		off := len(p1) + insert - len(r2.Seq)
+		from := max(0, off)
+		to := min(lenA, off+lenB)
+		if to-from < clipSeedLength {
+			continue
+		}
+		mismatches := 0
+		for i := from; i < from+clipSeedLength && mismatches <= clipSeedMismatches; i++ {
+			x, _ := a(i)
+			y, _ := b(i - off)
+			if x != y {
+				mismatches++
+			}
+		}
+		if mismatches > clipSeedMismatches {
+			continue
+		}
+		score := 0.0
+		for i := from; i < to; i++ {
+			x, qx := a(i)
+			y, qy := b(i - off)
+			score += baseScore(x, y, min(qx, qy))
+		}
+		if score >= clipPalindromeScore {
+			return insert
+		}
+	}
+	return -1
+}
+
+// seedMatches checks the first clipSeedLength bases of an alignment for
+// at most clipSeedMismatches mismatches.
+func seedMatches(seq []byte, adapter string) bool {
+	n := min(clipSeedLength, len(seq), len(adapter))
+	mismatches := 0
+	for i := 0; i < n; i++ {
+		if seq[i] != adapter[i] {
+			mismatches++
+			if mismatches > clipSeedMismatches {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func baseScore(read, adapter byte, qual byte) float64 {
+	switch {
+	case read == 'N' || adapter == 'N':
+		return 0
+	case read == adapter:
+		return clipMatchScore
+	}
+	return -float64(qual) / 10
+}
+
+func reverseComplement(s string) string {
+	rc := make([]byte, len(s))
+	for i := 0; i < len(s); i++ {
+		rc[len(s)-1-i] = complementBase(s[i])
+	}
+	return string(rc)
+}
+
+func complementBase(c byte) byte {
+	switch c {
+	case 'A':
+		return 'T'
+	case 'C':
+		return 'G'
+	case 'G':
+		return 'C'
+	case 'T':
+		return 'A'
+	}
+	return c
+}
+
+// nativeTrim is one run of the native trimmer. Reads are read in batches,
+// trimmed by a pool of workers and written in input order; every batch is
+// compressed by its worker into a separate gzip member, so compression
+// runs in parallel too.
+type nativeTrim struct {
+	job     *TrimJob
+	clipper *adapterClipper
+	ops     []qualityOp
+}
+
+type nativeBatch struct {
+	index  int
+	r1, r2 []*seqio.Record
+}
+
+// nativeResult holds the compressed members for the paired outputs and the
+// unpaired outputs of the forward and reverse reads.
+type nativeResult struct {
+	index   int
+	out     [4][]byte
+	metrics TrimMetrics
+}
+
+func (e *nativeTrim) run(ctx context.Context, workers int) (*TrimMetrics, error) {
+	paired := !e.job.singleEnd()
+	outputs := []string{e.job.Output1, e.job.Output2, e.job.Unpaired1, e.job.Unpaired2}
+	if !paired {
+		outputs = outputs[:1]
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	batches := make(chan nativeBatch, workers)
+	results := make(chan nativeResult, workers)
+
+	g.Go(func() error {
+		defer close(batches)
+		return e.readBatches(ctx, batches)
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		g.Go(func() error {
+			defer wg.Done()
+			for b := range batches {
+				res, err := e.trimBatch(b)
+				if err != nil {
+					return err
+				}
+				select {
+				case results <- res:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	total := &TrimMetrics{Paired: paired}
+	g.Go(func() error {
+		files := make([]*os.File, len(outputs))
+		written := make([]bool, len(outputs))
+		for i, path := range outputs {
+			f, err := os.Create(path)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", path, err)
+			}
+			defer f.Close()
+			files[i] = f
+		}
+		// Results arrive in any order; hold them back until their turn.
+		pending := make(map[int]nativeResult)
+		next := 0
+		for res := range results {
+			pending[res.index] = res
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+				for i, f := range files {
+					if len(r.out[i]) == 0 {
+						continue
+					}
+					if _, err := f.Write(r.out[i]); err != nil {
+						return fmt.Errorf("failed to write %s: %w", outputs[i], err)
+					}
+					written[i] = true
+				}
+				total.Input += r.metrics.Input
+				total.Surviving += r.metrics.Surviving
+				total.ForwardOnly += r.metrics.ForwardOnly
+				total.ReverseOnly += r.metrics.ReverseOnly
+				total.Dropped += r.metrics.Dropped
+			}
+		}
+		for i, f := range files {
+			// An output without reads still has to be a valid gzip file.
+			if !written[i] {
+				if err := gzip.NewWriter(f).Close(); err != nil {
+					return fmt.Errorf("failed to write %s: %w", outputs[i], err)
+				}
+			}
+			if err := f.Close(); err != nil {
+				return fmt.Errorf("failed to write %s: %w", outputs[i], err)
+			}
+		}
+		return nil
+	})
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+	return total, nil
+}
+
+// readBatches reads the inputs, both files in step for paired-end
+// libraries, and sends them in batches.
+func (e *nativeTrim) readBatches(ctx context.Context, batches chan<- nativeBatch) error {
+	var read func() (*seqio.Record, *seqio.Record, error)
+	if e.job.singleEnd() {
+		r, err := seqio.OpenFastq(e.job.Input1)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		read = func() (*seqio.Record, *seqio.Record, error) {
+			rec, err := r.Read()
+			if err != nil && err != io.EOF {
+				err = fmt.Errorf("failed to read %s: %w", e.job.Input1, err)
+			}
+			return rec, nil, err
+		}
+	} else {
+		r, err := seqio.OpenPaired(e.job.Input1, e.job.Input2)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		read = func() (*seqio.Record, *seqio.Record, error) {
+			rec1, rec2, err := r.Read()
+			if err != nil && err != io.EOF {
+				err = fmt.Errorf("failed to read %s and %s: %w", e.job.Input1, e.job.Input2, err)
+			}
+			return rec1, rec2, err
+		}
+	}
+
+	for index := 0; ; index++ {
+		b := nativeBatch{index: index}
+		var err error
+		for len(b.r1) < nativeBatchSize {
+			var rec1, rec2 *seqio.Record
+			if rec1, rec2, err = read(); err != nil {
+				break
+			}
+			b.r1 = append(b.r1, rec1)
+			if rec2 != nil {
+				b.r2 = append(b.r2, rec2)
+			}
+		}
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if len(b.r1) > 0 {
+			select {
+			case batches <- b:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (e *nativeTrim) trimBatch(b nativeBatch) (nativeResult, error) {
+	res := nativeResult{index: b.index}
+	var bufs [4]bytes.Buffer
+	var gzips [4]*gzip.Writer
+	var writers [4]*seqio.FastqWriter
+	for i := range writers {
+		gzips[i] = gzip.NewWriter(&bufs[i])
+		writers[i] = seqio.NewFastqWriter(gzips[i])
+	}
+	used := [4]bool{}
+	emit := func(out int, r *seqio.Record) {
+		writers[out].Write(r)
+		used[out] = true
+	}
+
+	for i := range b.r1 {
+		r1 := b.r1[i]
+		res.metrics.Input++
+		if err := toPhred(r1, e.job.Encoding.Offset()); err != nil {
+			return res, err
+		}
+		if b.r2 == nil {
+			keep := e.trimPhred(r1, e.clipper.single)
+			fromPhred(r1)
+			if keep {
+				res.metrics.Surviving++
+				emit(0, r1)
+			} else {
+				res.metrics.Dropped++
+			}
+			continue
+		}
+
+		r2 := b.r2[i]
+		if err := toPhred(r2, e.job.Encoding.Offset()); err != nil {
+			return res, err
+		}
+		keep2 := true
+		if e.clipper.prefix1 != "" && e.clipper.prefix2 != "" {
+			if insert := e.clipper.clipPalindrome(r1, r2); insert >= 0 {
+				cutRead(r1, 0, insert)
+				keep2 = false
+			}
+		}
+		keep1 := e.trimPhred(r1, e.clipper.forward)
+		keep2 = keep2 && e.trimPhred(r2, e.clipper.reverse)
+		fromPhred(r1)
+		fromPhred(r2)
+		switch {
+		case keep1 && keep2:
+			res.metrics.Surviving++
+			emit(0, r1)
+			emit(1, r2)
+		case keep1:
+			res.metrics.ForwardOnly++
+			emit(2, r1)
+		case keep2:
+			res.metrics.ReverseOnly++
+			emit(3, r2)
+		default:
+			res.metrics.Dropped++
+		}
+	}
+
+	for i, w := range writers {
+		if err := w.Flush(); err != nil {
+			return res, err
+		}
+		if err := gzips[i].Close(); err != nil {
+			return res, err
+		}
+		if used[i] {
+			res.out[i] = bufs[i].Bytes()
+		}
+	}
+	return res, nil
+}
+
+// trimPhred clips adapters and applies the quality operations to a read
+// whose qualities are Phred scores. It reports whether the read survives.
+func (e *nativeTrim) trimPhred(r *seqio.Record, adapters []string) bool {
+	cutRead(r, 0, clipSimple(adapters, r.Seq, r.Qual))
+	for _, op := range e.ops {
+		start, end := op(r.Qual)
+		cutRead(r, start, end)
+	}
+	return len(r.Seq) > 0
+}
+
+// toPhred converts quality characters with the given offset to scores in
+// place; fromPhred writes them back as Phred+33. Solexa scores below 0 are
+// taken as 0. The bases are upper-cased as well, for comparison with the
+// adapters.
+func toPhred(r *seqio.Record, offset byte) error {
+	for i, c := range r.Qual {
+		if c < 33 {
+			return fmt.Errorf("invalid quality character %q in read %s", c, r.Name())
+		}
+		r.Qual[i] = max(c, offset) - offset
+	}
+	for i, c := range r.Seq {
+		if 'a' <= c && c <= 'z' {
+			r.Seq[i] = c - 'a' + 'A'
+		}
+	}
+	return nil
+}
+
+func fromPhred(r *seqio.Record) {
+	for i := range r.Qual {
+		r.Qual[i] += 33
+	}
+}
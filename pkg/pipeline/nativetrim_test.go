@@ -0,0 +1,292 @@
+package pipeline
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"bio-assembler/pkg/seqio"
+)
+
+// The TruSeq3 paired-end prefixes and the indexed adapter, as shipped with
+// Trimmomatic.
+const (
+	testPrefix1 = "TACACTCTTTCCCTACACGACGCTCTTCCGATCT"
+	testPrefix2 = "GTGACTGGAGTTCAGACGTGTGCTCTTCCGATCT"
+	testAdapter = "AGATCGGAAGAGCACACGTCTGAACTCCAGTCAC"
+	// testInsert is a fragment with no resemblance to the adapters.
+	testInsert = "GATTACAGGCTTCAACGTAGCCATGTTGACCTAGGAATCCGTTAGCATGCAAGTCGTTAC"
+)
+
+const testAdapterFasta = ">PrefixPE/1\n" + testPrefix1 + "\n>PrefixPE/2\n" + testPrefix2 + "\n>TruSeq3_IndexedAdapter\n" + testAdapter + "\n"
+
+type testRead struct {
+	seq, qual string
+}
+
+// highQuality returns a read with quality 40 throughout.
+func highQuality(seq string) testRead {
+	return testRead{seq, strings.Repeat("I", len(seq))}
+}
+
+func writeTestFastq(t *testing.T, path string, reads []testRead) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	for i, r := range reads {
+		name := "r" + string(rune('a'+i))
+		io.WriteString(zw, "@"+name+"\n"+r.seq+"\n+\n"+r.qual+"\n")
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readTestFastq returns the reads of a gzipped FASTQ file, or nil when
+// the file does not exist.
+func readTestFastq(t *testing.T, path string) []testRead {
+	t.Helper()
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lines []string
+	sc := bufio.NewScanner(zr)
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	var reads []testRead
+	for i := 0; i+3 < len(lines); i += 4 {
+		reads = append(reads, testRead{lines[i+1], lines[i+3]})
+	}
+	return reads
+}
+
+// runNativeTrim trims the given reads, paired when reads2 is not nil, and
+// returns the job with its outputs.
+func runNativeTrim(t *testing.T, preset trimPreset, reads1, reads2 []testRead, customize func(*TrimJob)) (*TrimJob, *TrimMetrics) {
+	t.Helper()
+	dir := t.TempDir()
+	job := &TrimJob{
+		Input1:       filepath.Join(dir, "in_1.fastq.gz"),
+		Output1:      filepath.Join(dir, "out_1.fastq.gz"),
+		Dir:          dir,
+		Threads:      2,
+		AdapterFasta: filepath.Join(dir, "adapters.fa"),
+		Preset:       &preset,
+	}
+	if err := os.WriteFile(job.AdapterFasta, []byte(testAdapterFasta), 0644); err != nil {
+		t.Fatal(err)
+	}
+	writeTestFastq(t, job.Input1, reads1)
+	if reads2 != nil {
+		job.Input2 = filepath.Join(dir, "in_2.fastq.gz")
+		job.Output2 = filepath.Join(dir, "out_2.fastq.gz")
+		job.Unpaired1 = filepath.Join(dir, "unpaired_1.fastq.gz")
+		job.Unpaired2 = filepath.Join(dir, "unpaired_2.fastq.gz")
+		writeTestFastq(t, job.Input2, reads2)
+	}
+	if customize != nil {
+		customize(job)
+	}
+	m, err := (&NativeTrimmer{}).Trim(context.Background(), job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job, m
+}
+
+// noQualityTrim keeps every base of a high-quality read.
+var noQualityTrim = trimPreset{Leading: 3, Trailing: 3, Window: 4, WindowQuality: 15, MinLength: 15}
+
+func TestClipSimple(t *testing.T) {
+	insert := testInsert[:40]
+	tests := []struct {
+		name string
+		seq  string
+		want int
+	}{
+		{name: "no adapter", seq: testInsert, want: len(testInsert)},
+		{name: "whole adapter", seq: insert + testAdapter, want: 40},
+		{name: "adapter at the end", seq: insert + testAdapter[:20], want: 40},
+		{name: "adapter with a mismatch", seq: insert + "T" + testAdapter[1:25], want: 40},
+		// 12 matching bases score below clipSimpleScore.
+		{name: "adapter too short", seq: insert + testAdapter[:12], want: 52},
+		{name: "adapter only", seq: testAdapter, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qual := bytes.Repeat([]byte{40}, len(tt.seq))
+			if got := clipSimple([]string{testAdapter}, []byte(tt.seq), qual); got != tt.want {
+				t.Errorf("clipped at %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQualityOps(t *testing.T) {
+	repeat := func(q byte, n int) []byte { return bytes.Repeat([]byte{q}, n) }
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	tests := []struct {
+		name      string
+		op        qualityOp
+		q         []byte
+		wantStart int
+		wantEnd   int
+	}{
+		{name: "leading", op: leadingOp(3), q: join([]byte{2, 0, 3}, repeat(30, 5)), wantStart: 2, wantEnd: 8},
+		{name: "leading all low", op: leadingOp(3), q: repeat(2, 4), wantStart: 4, wantEnd: 4},
+		{name: "trailing", op: trailingOp(3), q: join(repeat(30, 5), []byte{3, 2, 2}), wantStart: 0, wantEnd: 6},
+		{name: "window passes", op: slidingWindowOp(4, 15), q: repeat(30, 10), wantStart: 0, wantEnd: 10},
+		// Windows from 9 average exactly 15 and pass; the one from 10 fails
+		// and its first base is below 15 too.
+		{name: "window cut", op: slidingWindowOp(4, 15), q: join(repeat(30, 10), repeat(10, 4), repeat(30, 5)), wantStart: 0, wantEnd: 10},
+		// The failing window starts at 6, whose base passes on its own.
+		{name: "window keeps passing bases", op: slidingWindowOp(4, 15), q: join(repeat(30, 6), []byte{20, 5, 5, 5}), wantStart: 0, wantEnd: 7},
+		{name: "window at the start", op: slidingWindowOp(4, 15), q: join(repeat(2, 4), repeat(30, 10)), wantStart: 0, wantEnd: 0},
+		{name: "read shorter than window", op: slidingWindowOp(4, 15), q: repeat(2, 3), wantStart: 0, wantEnd: 3},
+		{name: "min length", op: minLenOp(5), q: repeat(30, 4), wantStart: 0, wantEnd: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := tt.op(tt.q)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("kept %d-%d, want %d-%d", start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestNativeTrimPaired(t *testing.T) {
+	const readLength = 60
+	// readThrough returns the pair sequenced from a fragment shorter than
+	// the reads, which run on into the adapters and the poly-A beyond.
+	readThrough := func(fragment string) (testRead, testRead) {
+		tail := strings.Repeat("A", readLength)
+		r1 := fragment + reverseComplement(testPrefix2) + tail
+		r2 := reverseComplement(fragment) + reverseComplement(testPrefix1) + tail
+		return highQuality(r1[:readLength]), highQuality(r2[:readLength])
+	}
+	tests := []struct {
+		name     string
+		fragment string
+		want     TrimMetrics
+		// wantForward is the forward read when the reverse one is dropped.
+		wantForward string
+	}{
+		{
+			name:     "no read-through",
+			fragment: testInsert,
+			want:     TrimMetrics{Paired: true, Input: 1, Surviving: 1},
+		},
+		{
+			name:        "read-through",
+			fragment:    testInsert[:40],
+			want:        TrimMetrics{Paired: true, Input: 1, ForwardOnly: 1},
+			wantForward: testInsert[:40],
+		},
+		{
+			// Ten adapter bases are too few for simple clipping.
+			name:        "read-through by a few bases",
+			fragment:    testInsert[:50],
+			want:        TrimMetrics{Paired: true, Input: 1, ForwardOnly: 1},
+			wantForward: testInsert[:50],
+		},
+		{
+			name:        "short fragment",
+			fragment:    testInsert[:20],
+			want:        TrimMetrics{Paired: true, Input: 1, ForwardOnly: 1},
+			wantForward: testInsert[:20],
+		},
+		{
+			name:     "fragment below minimum length",
+			fragment: testInsert[:10],
+			want:     TrimMetrics{Paired: true, Input: 1, Dropped: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r1, r2 := readThrough(tt.fragment)
+			job, m := runNativeTrim(t, noQualityTrim, []testRead{r1}, []testRead{r2}, nil)
+			if *m != tt.want {
+				t.Errorf("got metrics %+v, want %+v", *m, tt.want)
+			}
+			if tt.wantForward != "" {
+				got := readTestFastq(t, job.Unpaired1)
+				if len(got) != 1 || got[0] != highQuality(tt.wantForward) {
+					t.Errorf("unpaired forward reads are %q, want %q", got, tt.wantForward)
+				}
+			}
+			if m.Surviving == 1 {
+				got1, got2 := readTestFastq(t, job.Output1), readTestFastq(t, job.Output2)
+				if len(got1) != 1 || got1[0] != r1 || len(got2) != 1 || got2[0] != r2 {
+					t.Errorf("paired outputs are %q and %q, want the reads unchanged", got1, got2)
+				}
+			}
+		})
+	}
+}
+
+func TestNativeTrimSingleEnd(t *testing.T) {
+	insert := testInsert[:40]
+	reads := []testRead{
+		highQuality(insert + testAdapter[:20]),
+		highQuality(insert + testAdapter[:12]),
+		// Low-quality tail after base 30.
+		{insert, strings.Repeat("I", 30) + strings.Repeat("#", 10)},
+		highQuality(insert[:10] + testAdapter),
+	}
+	job, m := runNativeTrim(t, noQualityTrim, reads, nil, nil)
+	if want := (TrimMetrics{Input: 4, Surviving: 3, Dropped: 1}); *m != want {
+		t.Errorf("got metrics %+v, want %+v", *m, want)
+	}
+	want := []testRead{
+		highQuality(insert),
+		highQuality(insert + testAdapter[:12]),
+		highQuality(insert[:30]),
+	}
+	got := readTestFastq(t, job.Output1)
+	if len(got) != len(want) {
+		t.Fatalf("got %d reads, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("read %d is %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNativeTrimPhred64(t *testing.T) {
+	// Quality 40 is 'h' in Phred+64; the last three bases have quality 2.
+	read := testRead{testInsert[:40], strings.Repeat("h", 37) + "BBB"}
+	job, m := runNativeTrim(t, noQualityTrim, []testRead{read}, nil, func(job *TrimJob) {
+		job.Encoding = seqio.Phred64
+	})
+	if m.Surviving != 1 {
+		t.Fatalf("got metrics %+v, want the read to survive", *m)
+	}
+	got := readTestFastq(t, job.Output1)
+	if want := highQuality(testInsert[:37]); len(got) != 1 || got[0] != want {
+		t.Errorf("got %+v, want %+v in Phred+33", got, want)
+	}
+}
@@ -1,77 +1,117 @@
 package pipeline
 
 import (
+	"bufio"
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 )
 
-type PilonStep struct {
-	ContigsIn      string
-	TrimmedPaired1 string
-	TrimmedPaired2 string
-	PilonDir       string
-	Threads        int
-	Memory         int
-	PilonJarPath   string
+// PilonPolisher corrects the assembly with Pilon from a sorted alignment
+// of the reads.
+type PilonPolisher struct {
+	Tools   Tools
+	JarPath string
+	// Fix is the list of corrections passed to --fix. Defaults to "snps,indels".
+	Fix string
+	// ExtraArgs are passed to Pilon in addition to the defaults.
+	ExtraArgs []string
 }
 
-func (s *PilonStep) Name() string {
-	return "Pilon Polishing"
+func (p *PilonPolisher) Name() string {
+	return "Pilon"
 }
 
-func (s *PilonStep) Run() error {
-	pilonContigsFile := filepath.Join(s.PilonDir, "pilon_r1.fasta")
-	if fileExists(pilonContigsFile) {
-		fmt.Println("Pilon corrected contigs already exist, skipping polishing.")
-		return nil
-	}
+func (p *PilonPolisher) Version(ctx context.Context) string {
+	return toolVersion(ctx, p.Tools.bin("java"), "-jar", p.JarPath, "--version")
+}
+
+func (p *PilonPolisher) Args() []string {
+	return append([]string{"--fix", p.fix()}, p.ExtraArgs...)
+}
 
-	fmt.Println("Running Pilon for assembly polishing...")
+// defaultPilonFix is the set of corrections Pilon is asked to make unless
+// configured otherwise.
+const defaultPilonFix = "snps,indels"
 
-	// Ensure pilon output directory exists
-	if err := os.MkdirAll(s.PilonDir, 0755); err != nil {
-		return fmt.Errorf("failed to create Pilon output directory: %w", err)
+func (p *PilonPolisher) fix() string {
+	if p.Fix == "" {
+		return defaultPilonFix
 	}
+	return p.Fix
+}
 
-	bamFile := filepath.Join(s.PilonDir, "mapped_reads.sorted.bam")
-
-	cmdIndex := exec.Command("bwa", "index", s.ContigsIn)
-	cmdIndex.Stdout = os.Stdout
-	cmdIndex.Stderr = os.Stderr
-	if err := cmdIndex.Run(); err != nil {
-		return fmt.Errorf("bwa index failed: %w", err)
+// CountPilonChanges classifies the lines of a Pilon .changes file, which
+// look like "contig:10 contig_pilon:10 A T", with "." for an empty side.
+func CountPilonChanges(path string) (*Corrections, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
 	}
+	defer f.Close()
 
-	bwaCmd := fmt.Sprintf("bwa mem -t %d %s %s %s | samtools sort -@ %d -o %s -", s.Threads, s.ContigsIn, s.TrimmedPaired1, s.TrimmedPaired2, s.Threads, bamFile)
-	cmdMem := exec.Command("bash", "-c", bwaCmd)
-	cmdMem.Stdout = os.Stdout
-	cmdMem.Stderr = os.Stderr
-	if err := cmdMem.Run(); err != nil {
-		return fmt.Errorf("bwa mem and samtools sort failed: %w", err)
+	c := &Corrections{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		from, to := fields[2], fields[3]
+		c.Total++
+		switch {
+		case from == ".":
+			c.Insertions++
+		case to == ".":
+			c.Deletions++
+		case len(from) == 1 && len(to) == 1:
+			c.SNPs++
+		default:
+			c.Other++
+		}
 	}
+	return c, scanner.Err()
+}
 
-	cmdSamIndex := exec.Command("samtools", "index", bamFile)
-	cmdSamIndex.Stdout = os.Stdout
-	cmdSamIndex.Stderr = os.Stderr
-	if err := cmdSamIndex.Run(); err != nil {
-		return fmt.Errorf("samtools index failed: %w", err)
+// Polish lets Pilon correct the job's contigs, mapping the reads to them
+// first unless the job comes with an alignment.
+func (p *PilonPolisher) Polish(ctx context.Context, job *PolishJob) (*PolishResult, error) {
+	bamFile, err := job.alignment(ctx, filepath.Join(job.Dir, MappedBamFile))
+	if err != nil {
+		return nil, err
 	}
 
-	cmdPilon := exec.Command("java", fmt.Sprintf("-Xmx%dG", s.Memory), "-jar", s.PilonJarPath,
-		"--genome", s.ContigsIn, "--frags", bamFile, "--output", "pilon_r1", "--outdir", s.PilonDir,
-		"--changes", "--fix", "snps,indels", "--threads", fmt.Sprintf("%d", s.Threads))
-	cmdPilon.Stdout = os.Stdout
-	cmdPilon.Stderr = os.Stderr
+	// Pilon is told whether the alignments come from paired-end fragments
+	// or unpaired reads.
+	readsOption := "--frags"
+	if job.singleEnd() {
+		readsOption = "--unpaired"
+	}
+	name := strings.TrimSuffix(filepath.Base(job.Output), ".fasta")
+	pilonArgs := []string{fmt.Sprintf("-Xmx%dG", job.Memory), "-jar", p.JarPath,
+		"--genome", job.Contigs, readsOption, bamFile, "--output", name, "--outdir", filepath.Dir(job.Output),
+		"--changes", "--threads", fmt.Sprintf("%d", job.Threads)}
+	pilonArgs = append(pilonArgs, p.Args()...)
+	cmdPilon := newCommand(ctx, p.Tools.bin("java"), pilonArgs...)
 	if err := cmdPilon.Run(); err != nil {
-		return fmt.Errorf("pilon command failed: %w", err)
+		return nil, fmt.Errorf("pilon command failed: %w", err)
 	}
 
-	if !fileExists(pilonContigsFile) {
-		return fmt.Errorf("pilon failed, expected file not found: %s", pilonContigsFile)
+	if !fileExists(job.Output) {
+		return nil, fmt.Errorf("pilon failed, expected file not found: %s", job.Output)
 	}
-
-	fmt.Println("Pilon polishing completed.")
-	return nil
+	changesFile := strings.TrimSuffix(job.Output, ".fasta") + ".changes"
+	changes, err := CountPilonChanges(changesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Pilon changes: %w", err)
+	}
+	if bamFile != job.Bam {
+		// The alignment is as large as the reads and of no further use.
+		if err := removeBam(bamFile); err != nil {
+			return nil, err
+		}
+	}
+	return &PolishResult{Corrections: changes}, nil
 }
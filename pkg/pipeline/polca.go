@@ -0,0 +1,69 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PolcaPolisher corrects the assembly with POLCA from the MaSuRCA package,
+// which maps the reads and calls variants with FreeBayes itself. POLCA
+// writes all of its files to the working directory, named after the
+// assembly.
+type PolcaPolisher struct {
+	Tools Tools
+	// ExtraArgs are passed to polca.sh.
+	ExtraArgs []string
+}
+
+func (p *PolcaPolisher) Name() string {
+	return "POLCA"
+}
+
+func (p *PolcaPolisher) Version(ctx context.Context) string {
+	return toolVersion(ctx, p.Tools.bin("polca.sh"), "--version")
+}
+
+func (p *PolcaPolisher) Args() []string {
+	return p.ExtraArgs
+}
+
+// Polish lets POLCA correct the job's contigs. POLCA's report only gives
+// totals, so its corrections are counted from the sequences instead.
+func (p *PolcaPolisher) Polish(ctx context.Context, job *PolishJob) (*PolishResult, error) {
+	// POLCA runs in job.Dir, so the inputs must not be relative to the
+	// current directory.
+	inputs := make([]string, 0, 3)
+	for _, path := range nonEmpty(job.Contigs, job.Reads1, job.Reads2) {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		inputs = append(inputs, abs)
+	}
+	// -m is the memory for each samtools sort thread.
+	perThread := max(job.Memory/max(job.Threads, 1), 1)
+	args := []string{
+		"-a", inputs[0],
+		"-r", strings.Join(inputs[1:], " "),
+		"-t", fmt.Sprintf("%d", job.Threads),
+		"-m", fmt.Sprintf("%dG", perThread),
+	}
+	args = append(args, p.ExtraArgs...)
+	cmd := newCommand(ctx, p.Tools.bin("polca.sh"), args...)
+	cmd.Dir = job.Dir
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("polca.sh command failed: %w", err)
+	}
+
+	corrected := filepath.Join(job.Dir, filepath.Base(job.Contigs)+".PolcaCorrected.fa")
+	if !fileExists(corrected) {
+		return nil, fmt.Errorf("polca failed, expected file not found: %s", corrected)
+	}
+	if err := os.Rename(corrected, job.Output); err != nil {
+		return nil, fmt.Errorf("failed to move POLCA output: %w", err)
+	}
+	return &PolishResult{}, nil
+}
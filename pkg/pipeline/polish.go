@@ -0,0 +1,486 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"bio-assembler/pkg/seqio"
+)
+
+const (
+	// PolishedFile and PolishSummaryFile are the outputs of PolishStep: the
+	// assembly after the last polisher and the corrections of every round.
+	PolishedFile      = "polished.fasta"
+	PolishSummaryFile = "polishing.json"
+)
+
+// Polishers lists the names accepted by NewPolisher.
+var Polishers = []string{"pilon", "polypolish", "polca"}
+
+// PolishJob is one polishing round.
+type PolishJob struct {
+	// Contigs is the assembly to polish.
+	Contigs string
+	// Reads2 is empty for single-end libraries.
+	Reads1, Reads2 string
+	// Dir is the directory the polisher works in. Output is the file the
+	// polished assembly must be written to.
+	Dir     string
+	Output  string
+	Threads int
+	// Memory is the memory limit in GB.
+	Memory int
+	// Bam is a sorted alignment of the reads to Contigs, empty when none
+	// has been made yet. Polishers that need one and find Bam empty map
+	// the reads with Mapper.
+	Bam    string
+	Mapper *ReadMapper
+}
+
+// alignment returns the job's sorted alignment, mapping the reads to
+// bam first when the job has none.
+func (j *PolishJob) alignment(ctx context.Context, bam string) (string, error) {
+	if j.Bam != "" {
+		return j.Bam, nil
+	}
+	if err := j.Mapper.Map(ctx, j.Contigs, j.Reads1, j.Reads2, nil, bam); err != nil {
+		return "", err
+	}
+	return bam, nil
+}
+
+func (j *PolishJob) singleEnd() bool {
+	return j.Reads2 == ""
+}
+
+// PolishResult is what a polisher reports about a round besides the
+// polished assembly.
+type PolishResult struct {
+	// Corrections is nil when the polisher does not list its changes; they
+	// are then counted by comparing the assembly before and after.
+	Corrections *Corrections
+}
+
+// Polisher corrects small errors in an assembly with the trimmed short
+// reads.
+type Polisher interface {
+	Name() string
+	Version(ctx context.Context) string
+	// Args are the options that shape the polishing, excluding resources
+	// and file paths. They are part of the step's cache fingerprint.
+	Args() []string
+	Polish(ctx context.Context, job *PolishJob) (*PolishResult, error)
+}
+
+// PolisherOptions configures the polishers created by NewPolisher; only
+// the options of the chosen polisher are used.
+type PolisherOptions struct {
+	Tools      Tools
+	Pilon      PilonPolisher
+	Polypolish PolypolishPolisher
+	Polca      PolcaPolisher
+}
+
+// NewPolisher returns the polisher registered under name.
+func NewPolisher(name string, opts PolisherOptions) (Polisher, error) {
+	switch name {
+	case "pilon":
+		p := opts.Pilon
+		p.Tools = opts.Tools
+		return &p, nil
+	case "polypolish":
+		p := opts.Polypolish
+		p.Tools = opts.Tools
+		return &p, nil
+	case "polca":
+		p := opts.Polca
+		p.Tools = opts.Tools
+		return &p, nil
+	}
+	return nil, fmt.Errorf("unknown polisher %q (expected one of %s)", name, strings.Join(Polishers, ", "))
+}
+
+// PolishStage runs one polisher of a PolishStep for up to Rounds rounds.
+// Polishing with it ends early after a round that made at most ConvergeAt
+// corrections.
+type PolishStage struct {
+	Polisher   Polisher
+	Rounds     int
+	ConvergeAt int
+}
+
+func (s PolishStage) rounds() int {
+	return max(s.Rounds, 1)
+}
+
+// Corrections counts the changes a polisher made.
+type Corrections struct {
+	Total      int `json:"total"`
+	SNPs       int `json:"snps"`
+	Insertions int `json:"insertions"`
+	Deletions  int `json:"deletions"`
+	// Other are multi-base substitutions and block replacements.
+	Other int `json:"other"`
+}
+
+func (c *Corrections) add(o Corrections) {
+	c.Total += o.Total
+	c.SNPs += o.SNPs
+	c.Insertions += o.Insertions
+	c.Deletions += o.Deletions
+	c.Other += o.Other
+}
+
+// PolishRound is the outcome of one round of a polisher.
+type PolishRound struct {
+	Round int `json:"round"`
+	Corrections
+}
+
+// PolishStageSummary is the outcome of one polisher of the chain. The
+// embedded Corrections are the sums over its rounds.
+type PolishStageSummary struct {
+	Polisher string `json:"polisher"`
+	Corrections
+	Rounds []PolishRound `json:"rounds"`
+	// Converged is set when the polisher stopped because a round made no
+	// more corrections than allowed, rather than after its last round.
+	Converged bool `json:"converged"`
+}
+
+// PolishSummary is written by PolishStep. The embedded Corrections are the
+// sums over all polishers.
+type PolishSummary struct {
+	Corrections
+	Stages []PolishStageSummary `json:"stages"`
+}
+
+// Polishers returns the names of the polishers that ran, in order.
+func (s *PolishSummary) Polishers() []string {
+	names := make([]string, len(s.Stages))
+	for i, st := range s.Stages {
+		names[i] = st.Polisher
+	}
+	return names
+}
+
+// ReadPolishSummary loads the corrections written by PolishStep.
+func ReadPolishSummary(path string) (*PolishSummary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &PolishSummary{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// PolishStep polishes the draft assembly with the trimmed reads by running
+// its stages in order, each starting from the previous one's result. Every
+// round works in <n>_<polisher>/round<N>/ in Output; its result is
+// rewritten with the draft's contig names, so the final polished.fasta
+// looks the same whichever polishers ran.
+type PolishStep struct {
+	ContigsIn string
+	Reads1    string
+	// Reads2 is empty for single-end libraries.
+	Reads2 string
+	// Bam is a sorted alignment of the reads to ContigsIn made by
+	// MapReadsStep, used by the first round. Later rounds map the reads to
+	// their input with Mapper. The first round polishes a link to
+	// ContigsIn in the staging directory, so indexes are never written
+	// next to ContigsIn itself.
+	Bam     string
+	Mapper  ReadMapper
+	Output  string
+	Threads int
+	Memory  int
+	Tools   Tools
+	Stages  []PolishStage
+}
+
+func (s *PolishStep) Name() string {
+	names := make([]string, len(s.Stages))
+	for i, st := range s.Stages {
+		names[i] = st.Polisher.Name()
+	}
+	return strings.Join(names, " + ") + " Polishing"
+}
+
+func (s *PolishStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	params := s.Mapper.Params()
+	versions := []string{s.Mapper.Version(ctx)}
+	for i, st := range s.Stages {
+		key := fmt.Sprintf("%d_%s", i+1, strings.ToLower(st.Polisher.Name()))
+		params[key] = fmt.Sprintf("rounds=%d converge_at=%d args=%s", st.rounds(), st.ConvergeAt, strings.Join(st.Polisher.Args(), " "))
+		versions = append(versions, st.Polisher.Version(ctx))
+	}
+	return &CacheSpec{
+		Dir:         s.Output,
+		Inputs:      nonEmpty(s.ContigsIn, s.Reads1, s.Reads2, s.Bam),
+		Params:      params,
+		ToolVersion: strings.Join(versions, "; "),
+		Outputs: []string{
+			filepath.Join(s.Output, PolishedFile),
+			filepath.Join(s.Output, PolishSummaryFile),
+		},
+	}, nil
+}
+
+func (s *PolishStep) Run(ctx context.Context) error {
+	if len(s.Stages) == 0 {
+		return fmt.Errorf("no polishers configured")
+	}
+	fmt.Printf("Running %s...\n", s.Name())
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	draft := stage.path("draft.fasta")
+	if err := linkReference(s.ContigsIn, draft); err != nil {
+		return err
+	}
+	summary := &PolishSummary{}
+	contigs := draft
+	for i, st := range s.Stages {
+		name := st.Polisher.Name()
+		stageDir := stage.path(fmt.Sprintf("%d_%s", i+1, strings.ToLower(name)))
+		stats := PolishStageSummary{Polisher: name}
+		for round := 1; round <= st.rounds(); round++ {
+			roundDir := filepath.Join(stageDir, fmt.Sprintf("round%d", round))
+			if err := os.MkdirAll(roundDir, 0755); err != nil {
+				return fmt.Errorf("failed to create %s: %w", roundDir, err)
+			}
+			job := &PolishJob{
+				Contigs: contigs,
+				Reads1:  s.Reads1,
+				Reads2:  s.Reads2,
+				Dir:     roundDir,
+				Output:  filepath.Join(roundDir, fmt.Sprintf("%s_r%d.fasta", strings.ToLower(name), round)),
+				Threads: s.Threads,
+				Memory:  s.Memory,
+				Mapper:  &s.Mapper,
+			}
+			if contigs == draft {
+				job.Bam = s.Bam
+			}
+			res, err := st.Polisher.Polish(ctx, job)
+			if err != nil {
+				return err
+			}
+			if !fastaLooksValid(job.Output) {
+				return fmt.Errorf("%s produced an empty or malformed FASTA: %s", name, job.Output)
+			}
+			polished := filepath.Join(roundDir, PolishedFile)
+			counted, err := normalizePolished(contigs, job.Output, polished, res.Corrections == nil)
+			if err != nil {
+				return fmt.Errorf("%s round %d: %w", name, round, err)
+			}
+			if err := os.Remove(job.Output); err != nil {
+				return fmt.Errorf("failed to remove %s: %w", job.Output, err)
+			}
+			// The indexes of the round's input are of no further use.
+			removeBwaIndex(contigs)
+			s.Mapper.RemoveIndex(contigs)
+			contigs = polished
+
+			changes := res.Corrections
+			if changes == nil {
+				changes = counted
+			}
+			stats.Rounds = append(stats.Rounds, PolishRound{Round: round, Corrections: *changes})
+			stats.add(*changes)
+			fmt.Printf("%s round %d: %d changes (%d SNPs, %d insertions, %d deletions, %d other)\n",
+				name, round, changes.Total, changes.SNPs, changes.Insertions, changes.Deletions, changes.Other)
+			if changes.Total <= st.ConvergeAt {
+				stats.Converged = true
+				break
+			}
+		}
+		if stats.Converged {
+			fmt.Printf("%s converged after %d round(s).\n", name, len(stats.Rounds))
+		} else if st.rounds() > 1 {
+			fmt.Printf("%s did not converge within %d rounds.\n", name, st.rounds())
+		}
+		summary.Stages = append(summary.Stages, stats)
+		summary.add(stats.Corrections)
+	}
+
+	if err := copyFile(contigs, stage.path(PolishedFile)); err != nil {
+		return err
+	}
+	if err := os.Remove(draft); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", draft, err)
+	}
+	data, err := json.MarshalIndent(summary, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode polishing summary: %w", err)
+	}
+	if err := os.WriteFile(stage.path(PolishSummaryFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write polishing summary: %w", err)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	fmt.Printf("Polishing completed: %d changes in total.\n", summary.Total)
+	return nil
+}
+
+// removeBam deletes an alignment together with its index.
+func removeBam(path string) error {
+	for _, p := range []string{path, path + ".bai"} {
+		if err := removeIfExists(p); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", p, err)
+		}
+	}
+	return nil
+}
+
+// removeBwaIndex deletes the files "bwa index" wrote next to a FASTA file.
+func removeBwaIndex(fasta string) {
+	for _, ext := range []string{".amb", ".ann", ".bwt", ".pac", ".sa"} {
+		_ = removeIfExists(fasta + ext)
+	}
+}
+
+// normalizePolished writes the contigs of polished to dst under the headers
+// of the draft they were polished from, undoing the suffixes polishers add
+// to contig names. Polishers keep the contigs in order, so they are paired
+// by position. With count set, the corrections are counted by comparing
+// each contig to its draft.
+func normalizePolished(draft, polished, dst string, count bool) (*Corrections, error) {
+	drafts, err := readFastaRecords(draft)
+	if err != nil {
+		return nil, err
+	}
+	results, err := readFastaRecords(polished)
+	if err != nil {
+		return nil, err
+	}
+	if len(drafts) != len(results) {
+		if count {
+			return nil, fmt.Errorf("polished assembly has %d contigs but the draft has %d; corrections cannot be counted", len(results), len(drafts))
+		}
+		// Contigs were split or dropped (e.g. Pilon's --fix breaks), so
+		// the polisher's own names are kept.
+		return nil, copyFile(polished, dst)
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	defer out.Close()
+	w := seqio.NewFastaWriter(out)
+	c := &Corrections{}
+	for i, rec := range results {
+		if count {
+			c.add(compareSequences(drafts[i].Seq, rec.Seq))
+		}
+		if err := w.Write(&seqio.Record{Header: drafts[i].Header, Seq: rec.Seq}); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", dst, err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", dst, err)
+	}
+	return c, out.Close()
+}
+
+func readFastaRecords(path string) ([]*seqio.Record, error) {
+	r, err := seqio.OpenFasta(path)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	var records []*seqio.Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		records = append(records, rec)
+	}
+}
+
+const (
+	// compareAnchor is the number of identical bases that must follow an
+	// edit for the sequences to be considered back in step.
+	compareAnchor = 12
+	// compareMaxEdit is the longest edit compareSequences looks for.
+	compareMaxEdit = 50
+)
+
+// compareSequences counts the edits that turn a into b, classified like the
+// changes Pilon lists. Polishing makes few, short edits, so after each
+// mismatch the shortest edit after which the sequences agree again for
+// compareAnchor bases is taken. Differences that no short edit explains
+// end the comparison and count as one other change.
+func compareSequences(a, b []byte) Corrections {
+	var c Corrections
+	inStep := func(i, j int) bool {
+		n := min(compareAnchor, len(a)-i, len(b)-j)
+		if n < compareAnchor && (len(a)-i != n || len(b)-j != n) {
+			return false
+		}
+		return bytes.EqualFold(a[i:i+n], b[j:j+n])
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		if a[i]|0x20 == b[j]|0x20 {
+			i++
+			j++
+			continue
+		}
+		di, dj, found := 0, 0, false
+		for d := 1; d <= 2*compareMaxEdit && !found; d++ {
+			for di = max(0, d-compareMaxEdit); di <= min(d, compareMaxEdit); di++ {
+				dj = d - di
+				if i+di <= len(a) && j+dj <= len(b) && inStep(i+di, j+dj) {
+					found = true
+					break
+				}
+			}
+		}
+		c.Total++
+		switch {
+		case !found:
+			c.Other++
+			return c
+		case di == dj && di == 1:
+			c.SNPs++
+		case di == 0:
+			c.Insertions++
+		case dj == 0:
+			c.Deletions++
+		default:
+			c.Other++
+		}
+		i += di
+		j += dj
+	}
+	if i < len(a) || j < len(b) {
+		c.Total++
+		if i < len(a) {
+			c.Deletions++
+		} else {
+			c.Insertions++
+		}
+	}
+	return c
+}
@@ -0,0 +1,91 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PolypolishPolisher corrects the assembly with Polypolish, which needs
+// every alignment of each read rather than only the best one, so each mate
+// file is mapped on its own with "bwa mem -a". Paired alignments are first
+// narrowed down with "polypolish filter" using the insert sizes.
+type PolypolishPolisher struct {
+	Tools Tools
+	// Careful ignores reads that align equally well to several places,
+	// which avoids mistakes in repeats at the cost of fewer corrections.
+	Careful bool
+	// ExtraArgs are passed to "polypolish polish".
+	ExtraArgs []string
+}
+
+func (p *PolypolishPolisher) Name() string {
+	return "Polypolish"
+}
+
+func (p *PolypolishPolisher) Version(ctx context.Context) string {
+	return strings.Join([]string{
+		toolVersion(ctx, p.Tools.bin("polypolish"), "--version"),
+		toolVersion(ctx, p.Tools.bin("bwa")),
+	}, "; ")
+}
+
+func (p *PolypolishPolisher) Args() []string {
+	var args []string
+	if p.Careful {
+		args = append(args, "--careful")
+	}
+	return append(args, p.ExtraArgs...)
+}
+
+// Polish maps the reads to the job's contigs and lets Polypolish correct
+// them. Polypolish does not list its changes. The configured aligner is
+// not used, since Polypolish is made for the all-hit output of bwa.
+func (p *PolypolishPolisher) Polish(ctx context.Context, job *PolishJob) (*PolishResult, error) {
+	cmdIndex := newCommand(ctx, p.Tools.bin("bwa"), "index", job.Contigs)
+	if err := cmdIndex.Run(); err != nil {
+		return nil, fmt.Errorf("bwa index failed: %w", err)
+	}
+
+	var sams []string
+	for i, reads := range nonEmpty(job.Reads1, job.Reads2) {
+		sam := filepath.Join(job.Dir, fmt.Sprintf("alignments_%d.sam", i+1))
+		if err := runToFile(ctx, sam, p.Tools.bin("bwa"), "mem", "-t", fmt.Sprintf("%d", job.Threads), "-a", job.Contigs, reads); err != nil {
+			return nil, err
+		}
+		sams = append(sams, sam)
+	}
+	if !job.singleEnd() {
+		filtered := []string{
+			filepath.Join(job.Dir, "filtered_1.sam"),
+			filepath.Join(job.Dir, "filtered_2.sam"),
+		}
+		cmdFilter := newCommand(ctx, p.Tools.bin("polypolish"), "filter",
+			"--in1", sams[0], "--in2", sams[1], "--out1", filtered[0], "--out2", filtered[1])
+		if err := cmdFilter.Run(); err != nil {
+			return nil, fmt.Errorf("polypolish filter command failed: %w", err)
+		}
+		for _, sam := range sams {
+			if err := os.Remove(sam); err != nil {
+				return nil, fmt.Errorf("failed to remove %s: %w", sam, err)
+			}
+		}
+		sams = filtered
+	}
+
+	args := append([]string{"polish"}, p.Args()...)
+	args = append(args, job.Contigs)
+	args = append(args, sams...)
+	if err := runToFile(ctx, job.Output, p.Tools.bin("polypolish"), args...); err != nil {
+		return nil, err
+	}
+	// The alignments are as large as the reads and of no further use.
+	for _, sam := range sams {
+		if err := os.Remove(sam); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", sam, err)
+		}
+	}
+	return &PolishResult{}, nil
+}
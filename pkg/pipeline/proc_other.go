@@ -0,0 +1,11 @@
+//go:build !unix
+
+package pipeline
+
+import "os/exec"
+
+// setProcessGroup is a no-op on platforms without POSIX process groups;
+// cancellation falls back to killing the direct child only.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.WaitDelay = killGracePeriod
+}
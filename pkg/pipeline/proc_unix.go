@@ -0,0 +1,29 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// setProcessGroup starts the command in its own process group and arranges
+// for the whole group to be terminated when the command's context is
+// cancelled. Tools such as spades.py or "bash -c 'bwa | samtools'" spawn
+// children of their own, which would otherwise survive the parent.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		err := syscall.Kill(pgid, syscall.SIGTERM)
+		// Give the group a grace period to exit cleanly, then kill whatever is
+		// left, including children that outlived the leader. The group ID
+		// cannot be reused while any member is still alive.
+		time.AfterFunc(killGracePeriod, func() {
+			_ = syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		return err
+	}
+	cmd.WaitDelay = killGracePeriod
+}
@@ -0,0 +1,76 @@
+//go:build unix
+
+package pipeline
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// alive reports whether pid still runs. A zombie that nobody reaps counts
+// as dead.
+func alive(pid int) bool {
+	if syscall.Kill(pid, 0) != nil {
+		return false
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return true
+	}
+	// The state follows the command name in parentheses.
+	fields := strings.Fields(string(stat[strings.LastIndexByte(string(stat), ')')+1:]))
+	return len(fields) == 0 || fields[0] != "Z"
+}
+
+func TestCancelKillsGrandchildIgnoringSIGTERM(t *testing.T) {
+	grace := killGracePeriod
+	killGracePeriod = 200 * time.Millisecond
+	t.Cleanup(func() { killGracePeriod = grace })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The shell exits on SIGTERM right away, leaving behind a sleep that
+	// ignores it.
+	cmd := newCommand(ctx, "bash", "-c", `(trap "" TERM; exec sleep 300) & echo $!; wait`)
+	cmd.Stdout = nil
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("bash is not available: %v", err)
+	}
+	line, err := bufio.NewReader(out).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatalf("unexpected output %q", line)
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+
+	// Give the subshell time to ignore SIGTERM before it is sent.
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	if err := cmd.Wait(); err == nil {
+		t.Fatal("cancelled command succeeded")
+	}
+	if !alive(pid) {
+		t.Fatal("sleep did not survive SIGTERM; the test proves nothing")
+	}
+
+	deadline := time.Now().Add(killGracePeriod + 5*time.Second)
+	for alive(pid) {
+		if time.Now().After(deadline) {
+			t.Fatalf("sleep (pid %d) is still running after the grace period", pid)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"bio-assembler/pkg/fastqc"
+)
+
+// qcSummaryFile is the machine-readable summary FastQC steps write next to
+// the reports.
+const qcSummaryFile = "qc_summary.json"
+
+// QCRule is one check of a FastQC gate. It triggers when Module reaches
+// Status (WARN or FAIL) in any of the analysed files. A triggered rule
+// aborts the pipeline when Abort is set and prints a warning otherwise.
+type QCRule struct {
+	Module string
+	Status fastqc.Status
+	Abort  bool
+}
+
+func (r QCRule) String() string {
+	action := "warn"
+	if r.Abort {
+		action = "abort"
+	}
+	return fmt.Sprintf("%s>=%s:%s", r.Module, r.Status, action)
+}
+
+// gateParam renders a gate for the cache parameters, so changing the rules
+// re-evaluates the step.
+func gateParam(rules []QCRule) string {
+	parts := make([]string, len(rules))
+	for i, r := range rules {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ";")
+}
+
+// checkQCGate applies the rules to the FastQC results of a step. Every
+// triggered rule is reported; the returned error lists those that abort.
+func checkQCGate(step string, results []*fastqc.Result, rules []QCRule) error {
+	var aborts []string
+	for _, rule := range rules {
+		for _, res := range results {
+			status := res.Status(rule.Module)
+			if status == "" || status.Rank() < rule.Status.Rank() {
+				continue
+			}
+			msg := fmt.Sprintf("%s: %s is %s", res.Filename, rule.Module, status)
+			if rule.Module == fastqc.AdapterContent && res.AdapterContent != nil {
+				if adapter, pct := res.AdapterContent.Max(); adapter != "" {
+					msg += fmt.Sprintf(" (up to %.1f%% %s)", pct, adapter)
+				}
+			}
+			if rule.Abort {
+				aborts = append(aborts, msg)
+			} else {
+				fmt.Printf("QC WARNING (%s): %s\n", step, msg)
+			}
+		}
+	}
+	if len(aborts) > 0 {
+		return fmt.Errorf("QC gate failed: %s", strings.Join(aborts, "; "))
+	}
+	return nil
+}
+
+// writeQCSummary stores the parsed FastQC results as JSON.
+func writeQCSummary(path string, results []*fastqc.Result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode QC summary: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write QC summary: %w", err)
+	}
+	return nil
+}
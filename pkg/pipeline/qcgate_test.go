@@ -0,0 +1,83 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"bio-assembler/pkg/fastqc"
+)
+
+func TestCheckQCGate(t *testing.T) {
+	results := []*fastqc.Result{
+		{
+			Filename: "SRR1_1.fastq.gz",
+			Modules: []fastqc.Module{
+				{Name: fastqc.PerBaseQuality, Status: fastqc.Pass},
+				{Name: fastqc.AdapterContent, Status: fastqc.Fail},
+			},
+			AdapterContent: &fastqc.AdapterTable{
+				Adapters: []string{"Illumina Universal Adapter", "Nextera Transposase Sequence"},
+				Positions: []fastqc.AdapterPosition{
+					{Position: "1", Percent: []float64{0, 0}},
+					{Position: "150-151", Percent: []float64{12.4, 0.5}},
+				},
+			},
+		},
+		{
+			Filename: "SRR1_2.fastq.gz",
+			Modules: []fastqc.Module{
+				{Name: fastqc.PerBaseQuality, Status: fastqc.Warn},
+				{Name: fastqc.AdapterContent, Status: fastqc.Pass},
+			},
+		},
+	}
+	tests := []struct {
+		name  string
+		rules []QCRule
+		// wantErr lists what the error must mention; nil means no error.
+		wantErr []string
+	}{
+		{name: "no rules"},
+		{
+			name:  "warning only",
+			rules: []QCRule{{Module: fastqc.AdapterContent, Status: fastqc.Fail}},
+		},
+		{
+			name:    "abort on fail",
+			rules:   []QCRule{{Module: fastqc.AdapterContent, Status: fastqc.Fail, Abort: true}},
+			wantErr: []string{"SRR1_1.fastq.gz: Adapter Content is FAIL (up to 12.4% Illumina Universal Adapter)"},
+		},
+		{
+			name:    "warn threshold triggers on warn and fail",
+			rules:   []QCRule{{Module: fastqc.PerBaseQuality, Status: fastqc.Warn, Abort: true}, {Module: fastqc.AdapterContent, Status: fastqc.Warn, Abort: true}},
+			wantErr: []string{"SRR1_2.fastq.gz: Per base sequence quality is WARN", "SRR1_1.fastq.gz: Adapter Content is FAIL"},
+		},
+		{
+			name:  "fail threshold ignores warn",
+			rules: []QCRule{{Module: fastqc.PerBaseQuality, Status: fastqc.Fail, Abort: true}},
+		},
+		{
+			name:  "module not run",
+			rules: []QCRule{{Module: fastqc.KmerContent, Status: fastqc.Warn, Abort: true}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkQCGate("FastQC", results, tt.rules)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("gate passed")
+			}
+			for _, want := range tt.wantErr {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+		})
+	}
+}
@@ -1,37 +1,59 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
+	"path/filepath"
+	"strings"
 )
 
 type QualimapStep struct {
 	BamFile   string
 	OutputDir string
 	Memory    int
+	Tools     Tools
+	// ExtraArgs are passed to "qualimap bamqc" in addition to the defaults.
+	ExtraArgs []string
 }
 
 func (s *QualimapStep) Name() string {
 	return "Qualimap Quality Assessment"
 }
 
-func (s *QualimapStep) Run() error {
+func (s *QualimapStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:         s.OutputDir,
+		Inputs:      []string{s.BamFile},
+		Params:      map[string]string{"extra_args": strings.Join(s.ExtraArgs, " ")},
+		ToolVersion: toolVersion(ctx, s.Tools.bin("qualimap"), "--version"),
+		Outputs:     []string{filepath.Join(s.OutputDir, "genome_results.txt")},
+	}, nil
+}
+
+func (s *QualimapStep) Run(ctx context.Context) error {
 	fmt.Println("Running Qualimap for quality assessment...")
 
-	// Ensure output directory exists
-	if err := os.MkdirAll(s.OutputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create Qualimap output directory: %w", err)
+	stage, err := newStaging(s.OutputDir)
+	if err != nil {
+		return err
 	}
+	defer stage.discard()
 
-	cmd := exec.Command("qualimap", "bamqc", "-bam", s.BamFile, "-outdir", s.OutputDir, fmt.Sprintf("--java-mem-size=%dG", s.Memory))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	args := []string{"bamqc", "-bam", s.BamFile, "-outdir", stage.dir, fmt.Sprintf("--java-mem-size=%dG", s.Memory)}
+	args = append(args, s.ExtraArgs...)
+	cmd := newCommand(ctx, s.Tools.bin("qualimap"), args...)
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("qualimap command failed: %w", err)
 	}
 
+	if results := stage.path("genome_results.txt"); !fileExists(results) {
+		return fmt.Errorf("qualimap failed, expected file not found: %s", results)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
 	fmt.Println("Qualimap quality assessment completed.")
 	return nil
 }
@@ -0,0 +1,50 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+)
+
+// SkesaAssembler assembles with SKESA, which writes the contigs straight to
+// contigs.fasta.
+type SkesaAssembler struct {
+	Tools Tools
+	// ExtraArgs are passed to skesa, for example "--kmer 31".
+	ExtraArgs []string
+}
+
+func (a *SkesaAssembler) Name() string {
+	return "SKESA"
+}
+
+func (a *SkesaAssembler) Version(ctx context.Context) string {
+	return toolVersion(ctx, a.Tools.bin("skesa"), "--version")
+}
+
+func (a *SkesaAssembler) Args() []string {
+	return a.ExtraArgs
+}
+
+func (a *SkesaAssembler) LongReads() LongReadUse {
+	return LongReadsUnsupported
+}
+
+func (a *SkesaAssembler) Assemble(ctx context.Context, job *AssemblyJob) error {
+	args := append([]string{}, a.Args()...)
+	if job.singleEnd() {
+		args = append(args, "--reads", job.Input1)
+	} else {
+		// Mates in two files are given as one comma-separated run.
+		args = append(args, "--reads", job.Input1+","+job.Input2, "--use_paired_ends")
+	}
+	args = append(args,
+		"--cores", fmt.Sprintf("%d", job.Threads),
+		"--memory", fmt.Sprintf("%d", job.Memory),
+		"--contigs_out", job.Contigs)
+	cmd := newCommand(ctx, a.Tools.bin("skesa"), args...)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("skesa command failed: %w", err)
+	}
+	return nil
+}
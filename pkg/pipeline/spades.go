@@ -1,55 +1,83 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
-	"path/filepath"
 )
 
-type SpadesStep struct {
-	InputFq1 string
-	InputFq2 string
-	Output   string
-	Threads  int
-	Memory   int
+// SpadesModes lists the accepted values of SpadesAssembler.Mode.
+var SpadesModes = []string{"standard", "careful", "isolate", "meta", "plasmid"}
+
+// SpadesAssembler assembles with spades.py, which writes contigs.fasta to
+// its output directory itself.
+type SpadesAssembler struct {
+	Tools Tools
+	// Mode is one of SpadesModes; every mode but "standard" is passed as
+	// the spades.py option of the same name (--careful, --isolate, ...).
+	Mode string
+	// OnlyAssembler skips the SPAdes read error correction stage.
+	OnlyAssembler bool
+	// Kmers replaces the k-mer sizes SPAdes picks from the read length.
+	Kmers []int
+	// ExtraArgs are passed to spades.py in addition to the options above.
+	ExtraArgs []string
+}
+
+func (a *SpadesAssembler) Name() string {
+	return "SPAdes"
 }
 
-func (s *SpadesStep) Name() string {
-	return "SPAdes Assembly"
+func (a *SpadesAssembler) Version(ctx context.Context) string {
+	return toolVersion(ctx, a.Tools.bin("spades.py"), "--version")
 }
 
-func (s *SpadesStep) Run() error {
-	contigsFile := filepath.Join(s.Output, "contigs.fasta")
-	if fileExists(contigsFile) {
-		fmt.Println("SPAdes contigs already exist, skipping assembly.")
-		return nil
+func (a *SpadesAssembler) Args() []string {
+	var args []string
+	if a.OnlyAssembler {
+		args = append(args, "--only-assembler")
+	}
+	if a.Mode != "" && a.Mode != "standard" {
+		args = append(args, "--"+a.Mode)
 	}
+	if len(a.Kmers) > 0 {
+		args = append(args, "-k", joinInts(a.Kmers))
+	}
+	return append(args, a.ExtraArgs...)
+}
 
-	fmt.Println("Running SPAdes for de novo assembly...")
+func (a *SpadesAssembler) LongReads() LongReadUse {
+	return LongReadsOptional
+}
 
-	// Ensure output directory exists
-	if err := os.MkdirAll(s.Output, 0755); err != nil {
-		return fmt.Errorf("failed to create SPAdes output directory: %w", err)
+func (a *SpadesAssembler) Assemble(ctx context.Context, job *AssemblyJob) error {
+	if a.Mode == "meta" && job.singleEnd() {
+		return fmt.Errorf("SPAdes meta mode needs paired-end reads")
 	}
-
-	cmd := exec.Command("spades.py", "--only-assembler", "--careful",
-		"-t", fmt.Sprintf("%d", s.Threads),
-		"-m", fmt.Sprintf("%d", s.Memory),
-		"--pe1-1", s.InputFq1,
-		"--pe1-2", s.InputFq2,
-		"-o", s.Output)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	args := a.Args()
+	args = append(args,
+		"-t", fmt.Sprintf("%d", job.Threads),
+		"-m", fmt.Sprintf("%d", job.Memory),
+		"-o", job.Dir)
+	if job.singleEnd() {
+		args = append(args, "-s", job.Input1)
+	} else {
+		args = append(args, "--pe1-1", job.Input1, "--pe1-2", job.Input2)
+	}
+	if job.LongReads != "" {
+		// SPAdes uses long reads for gap closing and repeat resolution only,
+		// so HiFi reads are given like other PacBio reads.
+		if isNanopore(job.LongReadType) {
+			args = append(args, "--nanopore", job.LongReads)
+		} else {
+			args = append(args, "--pacbio", job.LongReads)
+		}
+	}
+	cmd := newCommand(ctx, a.Tools.bin("spades.py"), args...)
 
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("spades command failed: %w", err)
 	}
-
-	if !fileExists(contigsFile) {
-		return fmt.Errorf("spades failed, expected file not found: %s", contigsFile)
-	}
-
-	fmt.Println("SPAdes assembly completed.")
+	// SPAdes names its result contigs.fasta, which is already where the
+	// step expects it.
 	return nil
 }
@@ -0,0 +1,126 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	stagingSuffix = ".staging"
+	retiredSuffix = ".old"
+)
+
+// staging is a scratch directory a step writes its outputs to. The outputs
+// only reach their final location once the step has validated them, so an
+// interrupted or failed run never leaves half-written files where the next
+// run (or the next step) would trust them.
+type staging struct {
+	final string
+	dir   string
+}
+
+// newStaging creates a fresh staging directory for outputs that belong in
+// final. The staging directory is a hidden sibling of final, so promotion is
+// a rename on the same filesystem.
+func newStaging(final string) (*staging, error) {
+	s := &staging{
+		final: final,
+		dir:   hiddenSibling(final, stagingSuffix),
+	}
+	if err := os.RemoveAll(s.dir); err != nil {
+		return nil, fmt.Errorf("failed to remove stale staging directory %s: %w", s.dir, err)
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create staging directory %s: %w", s.dir, err)
+	}
+	return s, nil
+}
+
+// path returns the location of a file inside the staging directory.
+func (s *staging) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+// promote replaces the final directory with the staging directory.
+func (s *staging) promote() error {
+	if err := os.MkdirAll(filepath.Dir(s.final), 0755); err != nil {
+		return fmt.Errorf("failed to create parent of %s: %w", s.final, err)
+	}
+	retired := hiddenSibling(s.final, retiredSuffix)
+	if err := os.RemoveAll(retired); err != nil {
+		return fmt.Errorf("failed to remove %s: %w", retired, err)
+	}
+	if _, err := os.Stat(s.final); err == nil {
+		if err := os.Rename(s.final, retired); err != nil {
+			return fmt.Errorf("failed to move previous outputs aside: %w", err)
+		}
+	}
+	if err := os.Rename(s.dir, s.final); err != nil {
+		return fmt.Errorf("failed to promote %s to %s: %w", s.dir, s.final, err)
+	}
+	if err := os.RemoveAll(retired); err != nil {
+		return fmt.Errorf("failed to remove previous outputs %s: %w", retired, err)
+	}
+	return nil
+}
+
+// promoteFiles moves individual staged files into place, for steps whose
+// outputs share a directory with other files. Each final path is looked up
+// in the staging directory by its base name. The staging directory is
+// removed afterwards.
+func (s *staging) promoteFiles(finals ...string) error {
+	for _, final := range finals {
+		if err := os.MkdirAll(filepath.Dir(final), 0755); err != nil {
+			return fmt.Errorf("failed to create output directory for %s: %w", final, err)
+		}
+		if err := os.Rename(s.path(filepath.Base(final)), final); err != nil {
+			return fmt.Errorf("failed to promote %s: %w", final, err)
+		}
+	}
+	return os.RemoveAll(s.dir)
+}
+
+// discard removes the staging directory and everything in it.
+func (s *staging) discard() {
+	_ = os.RemoveAll(s.dir)
+}
+
+func hiddenSibling(path, suffix string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+suffix)
+}
+
+// CleanStaging removes staging directories left behind under root by runs
+// that were killed before they could promote or discard them, and returns
+// their paths.
+func CleanStaging(root string) ([]string, error) {
+	var leftovers []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == root {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if !d.IsDir() || path == root {
+			return nil
+		}
+		name := d.Name()
+		if strings.HasPrefix(name, ".") && (strings.HasSuffix(name, stagingSuffix) || strings.HasSuffix(name, retiredSuffix)) {
+			leftovers = append(leftovers, path)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s for staging directories: %w", root, err)
+	}
+	for _, dir := range leftovers {
+		if err := os.RemoveAll(dir); err != nil {
+			return leftovers, fmt.Errorf("failed to remove %s: %w", dir, err)
+		}
+	}
+	return leftovers, nil
+}
@@ -1,27 +1,318 @@
 package pipeline
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
 
 type Step interface {
-	Run() error
+	// Run executes the step. Implementations must stop promptly and release
+	// any child processes once ctx is cancelled.
+	Run(ctx context.Context) error
 	Name() string
 }
 
+// StepStatus describes the outcome of a step after a pipeline run.
+type StepStatus string
+
+const (
+	StatusPending     StepStatus = "pending"
+	StatusCompleted   StepStatus = "completed"
+	StatusCached      StepStatus = "cached"
+	StatusFailed      StepStatus = "failed"
+	StatusInterrupted StepStatus = "interrupted"
+	StatusSkipped     StepStatus = "skipped"
+)
+
+// StepResult reports what happened to a single step during Run.
+type StepResult struct {
+	ID     string
+	Name   string
+	Status StepStatus
+	Err    error
+}
+
+// node is a step registered in the pipeline graph together with the IDs
+// of the steps that must complete before it may start.
+type node struct {
+	id   string
+	step Step
+	deps []string
+
+	done   chan struct{}
+	err    error
+	status StepStatus
+}
+
+// Pipeline executes steps as a dependency graph. Steps whose dependencies
+// have completed run concurrently, up to MaxParallel at a time.
 type Pipeline struct {
-	Steps []Step
+	// MaxParallel limits how many steps may run at the same time.
+	// Values below 1 are treated as 1 (fully sequential execution).
+	MaxParallel int
+	// Label, if set, prefixes progress lines so output from several
+	// pipelines running side by side can be told apart.
+	Label string
+
+	nodes []*node
+	byID  map[string]*node
+	// force holds IDs of steps that must re-run even when cached.
+	force map[string]bool
+}
+
+func NewPipeline(maxParallel int) *Pipeline {
+	return &Pipeline{MaxParallel: maxParallel, byID: make(map[string]*node)}
+}
+
+// Add registers a step under the given ID. The step will only start once
+// every step listed in deps has completed successfully.
+func (p *Pipeline) Add(id string, step Step, deps ...string) {
+	if p.byID == nil {
+		p.byID = make(map[string]*node)
+	}
+	n := &node{id: id, step: step, deps: deps}
+	p.nodes = append(p.nodes, n)
+	p.byID[id] = n
 }
 
-func NewPipeline(steps ...Step) *Pipeline {
-	return &Pipeline{Steps: steps}
+// Force makes the given steps re-run even if their cached results are up to date.
+func (p *Pipeline) Force(ids ...string) error {
+	for _, id := range ids {
+		if _, ok := p.byID[id]; !ok {
+			return fmt.Errorf("unknown step %q (known steps: %s)", id, strings.Join(p.IDs(), ", "))
+		}
+		if p.force == nil {
+			p.force = make(map[string]bool)
+		}
+		p.force[id] = true
+	}
+	return nil
 }
 
-func (p *Pipeline) Run() error {
-	for _, step := range p.Steps {
-		fmt.Printf("=== RUNNING STEP: %s ===\n", step.Name())
-		if err := step.Run(); err != nil {
-			return fmt.Errorf("pipeline step %q failed: %w", step.Name(), err)
+// ForceFrom makes the given step and every step that depends on it,
+// directly or indirectly, re-run even if their cached results are up to date.
+func (p *Pipeline) ForceFrom(id string) error {
+	if err := p.Force(id); err != nil {
+		return err
+	}
+	// Steps may be added in any order, so iterate until no new dependents are found.
+	for changed := true; changed; {
+		changed = false
+		for _, n := range p.nodes {
+			if p.force[n.id] {
+				continue
+			}
+			for _, d := range n.deps {
+				if p.force[d] {
+					p.force[n.id] = true
+					changed = true
+					break
+				}
+			}
 		}
-		fmt.Printf("=== COMPLETED STEP: %s ===\n\n", step.Name())
 	}
 	return nil
 }
+
+// IDs returns the IDs of all registered steps in the order they were added.
+func (p *Pipeline) IDs() []string {
+	ids := make([]string, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		ids = append(ids, n.id)
+	}
+	return ids
+}
+
+// validate checks that step IDs are unique, all dependencies exist and the
+// graph contains no cycles.
+func (p *Pipeline) validate() error {
+	seen := make(map[string]bool, len(p.nodes))
+	for _, n := range p.nodes {
+		if seen[n.id] {
+			return fmt.Errorf("duplicate step id %q", n.id)
+		}
+		seen[n.id] = true
+	}
+	for _, n := range p.nodes {
+		for _, d := range n.deps {
+			if !seen[d] {
+				return fmt.Errorf("step %q depends on unknown step %q", n.id, d)
+			}
+		}
+	}
+
+	// Depth-first search for cycles: 1 = visiting, 2 = finished.
+	state := make(map[string]int, len(p.nodes))
+	var visit func(id string, path []string) error
+	visit = func(id string, path []string) error {
+		switch state[id] {
+		case 1:
+			return fmt.Errorf("dependency cycle detected: %s", strings.Join(append(path, id), " -> "))
+		case 2:
+			return nil
+		}
+		state[id] = 1
+		for _, d := range p.byID[id].deps {
+			if err := visit(d, append(path, id)); err != nil {
+				return err
+			}
+		}
+		state[id] = 2
+		return nil
+	}
+	ids := p.IDs()
+	sort.Strings(ids)
+	for _, id := range ids {
+		if err := visit(id, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run executes the graph until every step has completed, a step fails or ctx
+// is cancelled. On failure or cancellation, steps that are still running are
+// cancelled and steps that have not started yet are skipped. Per-step
+// outcomes are available from Results afterwards.
+func (p *Pipeline) Run(ctx context.Context) error {
+	if err := p.validate(); err != nil {
+		return fmt.Errorf("invalid pipeline: %w", err)
+	}
+
+	limit := p.MaxParallel
+	if limit < 1 {
+		limit = 1
+	}
+	slots := make(chan struct{}, limit)
+
+	for _, n := range p.nodes {
+		n.done = make(chan struct{})
+		n.err = nil
+		n.status = StatusPending
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	var mu sync.Mutex // serializes progress output of concurrent steps
+
+	for _, n := range p.nodes {
+		n := n
+		g.Go(func() error {
+			defer close(n.done)
+
+			for _, d := range n.deps {
+				dep := p.byID[d]
+				select {
+				case <-dep.done:
+				case <-gctx.Done():
+					n.status = StatusSkipped
+					return nil
+				}
+				if dep.status != StatusCompleted && dep.status != StatusCached {
+					n.status = StatusSkipped
+					return nil
+				}
+			}
+
+			select {
+			case slots <- struct{}{}:
+			case <-gctx.Done():
+				n.status = StatusSkipped
+				return nil
+			}
+			defer func() { <-slots }()
+
+			// A slot may have been granted in the same instant the pipeline
+			// was stopped; do not start new work in that case.
+			if gctx.Err() != nil {
+				n.status = StatusSkipped
+				return nil
+			}
+
+			var cache *cacheState
+			if c, ok := n.step.(Cacheable); ok {
+				st, upToDate, err := checkCache(gctx, n.id, c)
+				if err != nil {
+					n.err = err
+					n.status = StatusFailed
+					return fmt.Errorf("pipeline step %q failed: %w", n.step.Name(), err)
+				}
+				if upToDate && !p.force[n.id] {
+					n.status = StatusCached
+					mu.Lock()
+					fmt.Printf("=== %sSKIPPING STEP: %s (outputs up to date) ===\n\n", p.prefix(), n.step.Name())
+					mu.Unlock()
+					return nil
+				}
+				if err := st.invalidate(); err != nil {
+					n.err = err
+					n.status = StatusFailed
+					return fmt.Errorf("pipeline step %q failed: %w", n.step.Name(), err)
+				}
+				cache = st
+			}
+
+			mu.Lock()
+			fmt.Printf("=== %sRUNNING STEP: %s ===\n", p.prefix(), n.step.Name())
+			mu.Unlock()
+
+			if err := n.step.Run(gctx); err != nil {
+				n.err = err
+				if gctx.Err() != nil {
+					// The step was torn down because of a signal or a failing
+					// sibling; the root cause is reported elsewhere.
+					n.status = StatusInterrupted
+					return nil
+				}
+				n.status = StatusFailed
+				return fmt.Errorf("pipeline step %q failed: %w", n.step.Name(), err)
+			}
+			if cache != nil {
+				if err := cache.commit(); err != nil {
+					n.err = err
+					n.status = StatusFailed
+					return fmt.Errorf("pipeline step %q failed to record its manifest: %w", n.step.Name(), err)
+				}
+			}
+			n.status = StatusCompleted
+
+			mu.Lock()
+			fmt.Printf("=== %sCOMPLETED STEP: %s ===\n\n", p.prefix(), n.step.Name())
+			mu.Unlock()
+			return nil
+		})
+	}
+
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("pipeline interrupted: %w", err)
+	}
+	return nil
+}
+
+func (p *Pipeline) prefix() string {
+	if p.Label == "" {
+		return ""
+	}
+	return "[" + p.Label + "] "
+}
+
+// Results returns the outcome of every step of the last Run, in the order
+// the steps were added.
+func (p *Pipeline) Results() []StepResult {
+	results := make([]StepResult, 0, len(p.nodes))
+	for _, n := range p.nodes {
+		status := n.status
+		if status == "" {
+			status = StatusPending
+		}
+		results = append(results, StepResult{ID: n.id, Name: n.step.Name(), Status: status, Err: n.err})
+	}
+	return results
+}
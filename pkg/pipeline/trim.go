@@ -0,0 +1,320 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"bio-assembler/pkg/seqio"
+)
+
+// Trimmers lists the names accepted by NewTrimmer.
+var Trimmers = []string{"trimmomatic", "fastp", "native"}
+
+// TrimModes lists the accepted values of TrimStep.Mode.
+var TrimModes = []string{"standard", "strict", "lenient", "custom"}
+
+// trimPreset describes a filtering preset independently of the trimmer.
+type trimPreset struct {
+	// Leading and Trailing are the quality below which bases are cut from
+	// the start and the end of a read.
+	Leading, Trailing int
+	// Window bases are scanned from the 5' end and the read is cut where
+	// their mean quality drops below WindowQuality.
+	Window, WindowQuality int
+	// MinLength is the length below which trimmed reads are dropped.
+	MinLength int
+}
+
+var trimPresets = map[string]trimPreset{
+	// Original defaults
+	"standard": {Leading: 20, Trailing: 20, Window: 4, WindowQuality: 25, MinLength: 30},
+	// Более жёсткая фильтрация: выше порог качества и длины
+	"strict": {Leading: 30, Trailing: 30, Window: 4, WindowQuality: 30, MinLength: 50},
+	// Более мягкая фильтрация, сохраняющая больше ридов
+	"lenient": {Leading: 3, Trailing: 3, Window: 4, WindowQuality: 20, MinLength: 30},
+}
+
+// TrimJob is one trimming run. Outputs are paths in a staging directory;
+// Output2 and the unpaired outputs are empty for single-end libraries.
+type TrimJob struct {
+	Input1, Input2       string
+	Output1, Output2     string
+	Unpaired1, Unpaired2 string
+	// Dir is the staging directory; trimmers write their logs there.
+	Dir     string
+	Threads int
+	// AdapterFasta is empty when the trimmer should detect the adapters.
+	AdapterFasta string
+	// Encoding is the quality encoding of the inputs. Outputs are always
+	// Phred+33.
+	Encoding seqio.Encoding
+	// Preset is nil in custom mode, where CustomArgs are passed instead.
+	Preset     *trimPreset
+	CustomArgs []string
+	ExtraArgs  []string
+}
+
+func (j *TrimJob) singleEnd() bool {
+	return j.Input2 == ""
+}
+
+// Trimmer removes adapters and low-quality bases from reads.
+type Trimmer interface {
+	Name() string
+	Version(ctx context.Context) string
+	// DetectsAdapters reports whether the trimmer finds the adapters
+	// itself when no adapter file is given.
+	DetectsAdapters() bool
+	// Logs names the log and report files Trim leaves in the job's Dir.
+	// They are kept with the trimmed reads.
+	Logs() []string
+	// Trim runs the job and returns the read survival metrics.
+	Trim(ctx context.Context, job *TrimJob) (*TrimMetrics, error)
+}
+
+// NewTrimmer returns the trimmer registered under name.
+func NewTrimmer(name string, tools Tools) (Trimmer, error) {
+	switch name {
+	case "", "trimmomatic":
+		// Trimmomatic is the default, so a machine without it (or without
+		// the Java runtime it needs) falls back to the built-in trimmer.
+		for _, bin := range []string{tools.bin("trimmomatic"), tools.bin("java")} {
+			if _, err := exec.LookPath(bin); err != nil {
+				fmt.Printf("%s not found, using the native trimmer instead of Trimmomatic\n", bin)
+				return &NativeTrimmer{}, nil
+			}
+		}
+		return &TrimmomaticTrimmer{Tools: tools}, nil
+	case "fastp":
+		return &FastpTrimmer{Tools: tools}, nil
+	case "native":
+		return &NativeTrimmer{}, nil
+	}
+	return nil, fmt.Errorf("unknown trimmer %q (expected one of %s)", name, strings.Join(Trimmers, ", "))
+}
+
+// TrimStep trims reads with the configured Trimmer. Paired-end reads
+// produce the four paired/unpaired outputs. For single-end libraries
+// InputFq2 is left empty and the trimmed reads are written to
+// PairedOutput1; the other outputs are not used.
+type TrimStep struct {
+	InputFq1        string
+	InputFq2        string
+	PairedOutput1   string
+	PairedOutput2   string
+	UnpairedOutput1 string
+	UnpairedOutput2 string
+	Threads         int
+	// AdapterFastaPath may be empty for trimmers that detect adapters.
+	AdapterFastaPath string
+	// ReadStatsPath is the read_stats.json of ValidateReadsStep, which
+	// gives the quality encoding of the inputs. When empty the reads are
+	// taken to be Phred+33.
+	ReadStatsPath string
+	// Mode controls which preset of filtering parameters is used:
+	// "standard" (default), "strict", "lenient", or "custom".
+	Mode string
+	// CustomArgs is used only when Mode == "custom" and allows the user
+	// to pass a raw argument string with the trimmer's filtering settings.
+	// Example for Trimmomatic: "LEADING:3 TRAILING:3 SLIDINGWINDOW:4:20 MINLEN:50".
+	CustomArgs string
+	Trimmer    Trimmer
+	// ExtraArgs are trimmer options (such as "-trimlog file") placed
+	// before the input files; they do not change the trimming steps.
+	ExtraArgs []string
+	// MinSurvival is the lowest acceptable percentage of input reads (pairs)
+	// surviving trimming; 0 disables the check. Falling below it prints a
+	// warning, or fails the step when FailOnLowSurvival is set.
+	MinSurvival       float64
+	FailOnLowSurvival bool
+}
+
+func (s *TrimStep) Name() string {
+	return s.Trimmer.Name()
+}
+
+func (s *TrimStep) singleEnd() bool {
+	return s.InputFq2 == ""
+}
+
+// outputs lists the files the step produces for the library layout,
+// including the trimmer's logs and the survival metrics.
+func (s *TrimStep) outputs() []string {
+	dir := filepath.Dir(s.PairedOutput1)
+	outputs := []string{s.PairedOutput1}
+	if !s.singleEnd() {
+		outputs = append(outputs, s.PairedOutput2, s.UnpairedOutput1, s.UnpairedOutput2)
+	}
+	for _, name := range s.Trimmer.Logs() {
+		outputs = append(outputs, filepath.Join(dir, name))
+	}
+	return append(outputs, filepath.Join(dir, TrimMetricsFile))
+}
+
+func (s *TrimStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	mode := s.Mode
+	if mode == "" {
+		mode = "standard"
+	}
+	params := map[string]string{
+		"trimmer":    s.Trimmer.Name(),
+		"mode":       mode,
+		"extra_args": strings.Join(s.ExtraArgs, " "),
+	}
+	if s.Mode == "custom" {
+		params["custom_args"] = strings.Join(splitArgs(s.CustomArgs), " ")
+	}
+	if s.MinSurvival > 0 {
+		params["min_survival"] = fmt.Sprintf("%g", s.MinSurvival)
+		params["fail_on_low_survival"] = fmt.Sprintf("%t", s.FailOnLowSurvival)
+	}
+	return &CacheSpec{
+		Dir:         filepath.Dir(s.PairedOutput1),
+		Inputs:      nonEmpty(s.InputFq1, s.InputFq2, s.AdapterFastaPath, s.ReadStatsPath),
+		Params:      params,
+		ToolVersion: s.Trimmer.Version(ctx),
+		Outputs:     s.outputs(),
+	}, nil
+}
+
+func (s *TrimStep) Run(ctx context.Context) error {
+	for _, in := range nonEmpty(s.InputFq1, s.InputFq2) {
+		if !fileExists(in) {
+			return fmt.Errorf("input FASTQ file not found: %s", in)
+		}
+	}
+	if s.AdapterFastaPath == "" && !s.Trimmer.DetectsAdapters() {
+		return fmt.Errorf("%s needs an adapter FASTA", s.Trimmer.Name())
+	}
+	if s.AdapterFastaPath != "" && !fileExists(s.AdapterFastaPath) {
+		return fmt.Errorf("adapter FASTA not found: %s", s.AdapterFastaPath)
+	}
+
+	encoding := seqio.Phred33
+	if s.ReadStatsPath != "" {
+		stats, err := ReadReadStats(s.ReadStatsPath)
+		if err != nil {
+			return fmt.Errorf("failed to read the read statistics: %w", err)
+		}
+		encoding = stats.Encoding
+	}
+
+	// All outputs are written to a staging directory next to the paired
+	// outputs and moved into place only after they pass validation.
+	stage, err := newStaging(filepath.Dir(s.PairedOutput1))
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+
+	job := &TrimJob{
+		Input1:       s.InputFq1,
+		Input2:       s.InputFq2,
+		Output1:      stage.path(filepath.Base(s.PairedOutput1)),
+		Dir:          stage.dir,
+		Threads:      s.Threads,
+		AdapterFasta: s.AdapterFastaPath,
+		Encoding:     encoding,
+		ExtraArgs:    s.ExtraArgs,
+	}
+	if !s.singleEnd() {
+		job.Output2 = stage.path(filepath.Base(s.PairedOutput2))
+		job.Unpaired1 = stage.path(filepath.Base(s.UnpairedOutput1))
+		job.Unpaired2 = stage.path(filepath.Base(s.UnpairedOutput2))
+	}
+	switch mode := s.Mode; mode {
+	case "":
+		preset := trimPresets["standard"]
+		job.Preset = &preset
+	case "custom":
+		if s.CustomArgs == "" {
+			return fmt.Errorf("filter mode is 'custom' but no custom arguments were provided")
+		}
+		// Пользователь полностью контролирует параметры.
+		job.CustomArgs = splitArgs(s.CustomArgs)
+	default:
+		preset, ok := trimPresets[mode]
+		if !ok {
+			return fmt.Errorf("unknown filter mode: %s (expected: %s)", s.Mode, strings.Join(TrimModes, ", "))
+		}
+		job.Preset = &preset
+	}
+
+	fmt.Printf("Running %s for read trimming (mode=%s, %s qualities)...\n", s.Trimmer.Name(), s.Mode, encoding)
+	metrics, err := s.Trimmer.Trim(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range nonEmpty(job.Output1, job.Output2) {
+		if !fileExists(f) {
+			return fmt.Errorf("%s failed, expected file not found: %s", s.Trimmer.Name(), filepath.Base(f))
+		}
+		// Validate that resulting gz files are not truncated/corrupt
+		if !gzipIntegrityOK(f) {
+			return fmt.Errorf("%s produced invalid gzip outputs (possible truncation)", s.Trimmer.Name())
+		}
+	}
+	if err := writeTrimMetrics(stage.path(TrimMetricsFile), metrics); err != nil {
+		return err
+	}
+
+	if err := stage.promoteFiles(s.outputs()...); err != nil {
+		return err
+	}
+
+	unit := "reads"
+	if metrics.Paired {
+		unit = "read pairs"
+	}
+	fmt.Printf("%s kept %d of %d %s (%.2f%%).\n", s.Trimmer.Name(), metrics.Surviving, metrics.Input, unit, metrics.SurvivalPercent())
+	if s.MinSurvival > 0 && metrics.SurvivalPercent() < s.MinSurvival {
+		msg := fmt.Sprintf("only %.2f%% of %s survived trimming (minimum %g%%)", metrics.SurvivalPercent(), unit, s.MinSurvival)
+		if s.AdapterFastaPath != "" {
+			msg += "; check the adapter file " + s.AdapterFastaPath
+		}
+		if s.FailOnLowSurvival {
+			return fmt.Errorf("%s", msg)
+		}
+		fmt.Printf("WARNING (%s): %s\n", s.Name(), msg)
+	}
+
+	fmt.Printf("%s trimming completed.\n", s.Trimmer.Name())
+	return nil
+}
+
+// runLogged runs a tool with its stdout and stderr captured in logPath. If
+// the tool fails, the last line of the log is added to the error.
+func runLogged(ctx context.Context, logPath, name string, args ...string) error {
+	logFile, err := os.Create(logPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s log: %w", filepath.Base(name), err)
+	}
+	defer logFile.Close()
+
+	cmd := newCommand(ctx, name, args...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	if err := cmd.Run(); err != nil {
+		if line := lastLogLine(logPath); line != "" {
+			return fmt.Errorf("%s command failed: %w (%s)", filepath.Base(name), err, line)
+		}
+		return fmt.Errorf("%s command failed: %w", filepath.Base(name), err)
+	}
+	return logFile.Close()
+}
+
+// lastLogLine returns the last non-empty line of a tool log, which usually
+// carries the reason a tool failed.
+func lastLogLine(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
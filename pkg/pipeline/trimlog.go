@@ -0,0 +1,107 @@
+package pipeline
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// TrimMetricsFile is written next to the trimmed reads.
+	TrimMetricsFile = "trim_metrics.json"
+	// trimLogFile keeps Trimmomatic's console output.
+	trimLogFile = "trimmomatic.log"
+)
+
+// TrimMetrics is the read survival summary of a trimming run, in the terms
+// Trimmomatic prints when it finishes. For paired-end libraries the counts
+// are read pairs; ForwardOnly and ReverseOnly are pairs that lost one mate.
+type TrimMetrics struct {
+	Paired      bool  `json:"paired"`
+	Input       int64 `json:"input"`
+	Surviving   int64 `json:"surviving"`
+	ForwardOnly int64 `json:"forward_only,omitempty"`
+	ReverseOnly int64 `json:"reverse_only,omitempty"`
+	Dropped     int64 `json:"dropped"`
+}
+
+// SurvivalPercent is the share of input reads (pairs) kept intact.
+func (m *TrimMetrics) SurvivalPercent() float64 {
+	if m.Input == 0 {
+		return 0
+	}
+	return 100 * float64(m.Surviving) / float64(m.Input)
+}
+
+// trimCountPattern matches the "Label: count" pairs of the summary line,
+// e.g. "Input Read Pairs: 2000 Both Surviving: 1800 (90.00%) ...".
+var trimCountPattern = regexp.MustCompile(`([A-Za-z][A-Za-z ]*?): (\d+)`)
+
+// ParseTrimmomaticLog extracts the survival summary from Trimmomatic's
+// console output.
+func ParseTrimmomaticLog(r io.Reader) (*TrimMetrics, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "Input Read") {
+			continue
+		}
+		m := &TrimMetrics{}
+		for _, match := range trimCountPattern.FindAllStringSubmatch(line, -1) {
+			n, err := strconv.ParseInt(match[2], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid count in trimmomatic summary %q: %w", line, err)
+			}
+			switch strings.TrimSpace(match[1]) {
+			case "Input Read Pairs":
+				m.Paired = true
+				m.Input = n
+			case "Input Reads":
+				m.Input = n
+			case "Both Surviving", "Surviving":
+				m.Surviving = n
+			case "Forward Only Surviving":
+				m.ForwardOnly = n
+			case "Reverse Only Surviving":
+				m.ReverseOnly = n
+			case "Dropped":
+				m.Dropped = n
+			}
+		}
+		return m, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("trimmomatic output has no read survival summary")
+}
+
+// ReadTrimMetrics loads the metrics written by TrimStep.
+func ReadTrimMetrics(path string) (*TrimMetrics, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	m := &TrimMetrics{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func writeTrimMetrics(path string, m *TrimMetrics) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode trim metrics: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write trim metrics: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package pipeline
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseTrimmomaticLog(t *testing.T) {
+	tests := []struct {
+		file string
+		want TrimMetrics
+		// wantSurvival is the percentage of surviving reads or pairs.
+		wantSurvival float64
+	}{
+		{
+			file:         "trimmomatic_pe.log",
+			want:         TrimMetrics{Paired: true, Input: 250000, Surviving: 221745, ForwardOnly: 24017, ReverseOnly: 1529, Dropped: 2709},
+			wantSurvival: 88.698,
+		},
+		{
+			file:         "trimmomatic_se.log",
+			want:         TrimMetrics{Input: 100000, Surviving: 96012, Dropped: 3988},
+			wantSurvival: 96.012,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			m, err := ParseTrimmomaticLog(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *m != tt.want {
+				t.Errorf("got %+v, want %+v", *m, tt.want)
+			}
+			if got := m.SurvivalPercent(); got < tt.wantSurvival-0.001 || got > tt.wantSurvival+0.001 {
+				t.Errorf("survival is %.3f%%, want %.3f%%", got, tt.wantSurvival)
+			}
+		})
+	}
+}
+
+func TestParseTrimmomaticLogWithoutSummary(t *testing.T) {
+	log := "TrimmomaticPE: Started with arguments:\nException in thread \"main\" java.io.FileNotFoundException: SRR1_1.fastq.gz\n"
+	if _, err := ParseTrimmomaticLog(strings.NewReader(log)); err == nil || !strings.Contains(err.Error(), "no read survival summary") {
+		t.Fatalf("got error %v, want a missing summary", err)
+	}
+	if got := (&TrimMetrics{}).SurvivalPercent(); got != 0 {
+		t.Errorf("survival without input is %v, want 0", got)
+	}
+}
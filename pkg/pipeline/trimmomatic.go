@@ -1,139 +1,87 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 )
 
-type TrimmomaticStep struct {
-	InputFq1         string
-	InputFq2         string
-	PairedOutput1    string
-	PairedOutput2    string
-	UnpairedOutput1  string
-	UnpairedOutput2  string
-	Threads          int
-	AdapterFastaPath string
-	// Mode controls which preset of filtering parameters is used:
-	// "standard" (default), "strict", "lenient", or "custom".
-	Mode string
-	// CustomArgs is used only when Mode == "custom" and allows the user
-	// to pass a raw argument string with Trimmomatic filtering settings.
-	// Example: "LEADING:3 TRAILING:3 SLIDINGWINDOW:4:20 MINLEN:50".
-	CustomArgs string
+// TrimmomaticTrimmer trims with Trimmomatic, in PE mode for paired-end
+// libraries and SE mode otherwise. Trimmomatic needs an adapter file.
+type TrimmomaticTrimmer struct {
+	Tools Tools
 }
 
-func (s *TrimmomaticStep) Name() string {
+func (t *TrimmomaticTrimmer) Name() string {
 	return "Trimmomatic"
 }
 
-func (s *TrimmomaticStep) Run() error {
-	if !fileExists(s.InputFq1) || !fileExists(s.InputFq2) {
-		return fmt.Errorf("input FASTQ files not found: %s, %s", s.InputFq1, s.InputFq2)
-	}
-	if s.AdapterFastaPath == "" || !fileExists(s.AdapterFastaPath) {
-		return fmt.Errorf("adapter FASTA not found: %s", s.AdapterFastaPath)
-	}
-	if fileExists(s.PairedOutput1) && fileExists(s.PairedOutput2) {
-		// Validate gzip integrity to avoid using truncated outputs from a previous failed run
-		if gzipIntegrityOK(s.PairedOutput1) && gzipIntegrityOK(s.PairedOutput2) {
-			fmt.Println("Trimmed files already exist and passed integrity check, skipping Trimmomatic.")
-			return nil
-		}
-		fmt.Println("Existing trimmed files appear corrupted or unfinished; re-generating with Trimmomatic...")
-		// Best effort cleanup of previous outputs
-		_ = removeIfExists(s.PairedOutput1)
-		_ = removeIfExists(s.PairedOutput2)
-		_ = removeIfExists(s.UnpairedOutput1)
-		_ = removeIfExists(s.UnpairedOutput2)
-	}
+func (t *TrimmomaticTrimmer) Version(ctx context.Context) string {
+	return toolVersion(ctx, t.Tools.bin("trimmomatic"), "-version")
+}
 
-	fmt.Printf("Running Trimmomatic for read trimming (mode=%s)...\n", s.Mode)
+func (t *TrimmomaticTrimmer) DetectsAdapters() bool {
+	return false
+}
 
-	// Ensure output directories exist
-	outDirs := map[string]struct{}{
-		filepath.Dir(s.PairedOutput1):   {},
-		filepath.Dir(s.PairedOutput2):   {},
-		filepath.Dir(s.UnpairedOutput1): {},
-		filepath.Dir(s.UnpairedOutput2): {},
-	}
-	for d := range outDirs {
-		if err := os.MkdirAll(d, 0755); err != nil {
-			return fmt.Errorf("failed to create output directory %s: %w", d, err)
-		}
-	}
+func (t *TrimmomaticTrimmer) Logs() []string {
+	return []string{trimLogFile}
+}
 
+func (t *TrimmomaticTrimmer) Trim(ctx context.Context, job *TrimJob) (*TrimMetrics, error) {
 	// Base arguments shared between all modes
+	layout := "PE"
+	if job.singleEnd() {
+		layout = "SE"
+	}
+	phred := "-phred33"
+	if job.Encoding.Offset() == 64 {
+		phred = "-phred64"
+	}
 	args := []string{
-		"PE",
-		"-threads", fmt.Sprintf("%d", s.Threads),
-		"-phred33",
-		s.InputFq1, s.InputFq2,
-		s.PairedOutput1, s.UnpairedOutput1,
-		s.PairedOutput2, s.UnpairedOutput2,
-		fmt.Sprintf("ILLUMINACLIP:%s:2:30:10", s.AdapterFastaPath),
+		layout,
+		"-threads", fmt.Sprintf("%d", job.Threads),
+		phred,
 	}
-
-	// Choose filtering parameters depending on the selected mode.
-	switch s.Mode {
-	case "", "standard":
-		// Original defaults
+	args = append(args, job.ExtraArgs...)
+	if job.singleEnd() {
+		args = append(args, job.Input1, job.Output1)
+	} else {
 		args = append(args,
-			"LEADING:20",
-			"TRAILING:20",
-			"SLIDINGWINDOW:4:25",
-			"MINLEN:30",
+			job.Input1, job.Input2,
+			job.Output1, job.Unpaired1,
+			job.Output2, job.Unpaired2,
 		)
-	case "strict":
-		// Более жёсткая фильтрация: выше порог качества и длины
-		args = append(args,
-			"LEADING:30",
-			"TRAILING:30",
-			"SLIDINGWINDOW:4:30",
-			"MINLEN:50",
-		)
-	case "lenient":
-		// Более мягкая фильтрация, сохраняющая больше ридов
+	}
+	args = append(args, fmt.Sprintf("ILLUMINACLIP:%s:2:30:10", job.AdapterFasta))
+
+	if p := job.Preset; p != nil {
 		args = append(args,
-			"LEADING:3",
-			"TRAILING:3",
-			"SLIDINGWINDOW:4:20",
-			"MINLEN:30",
+			fmt.Sprintf("LEADING:%d", p.Leading),
+			fmt.Sprintf("TRAILING:%d", p.Trailing),
+			fmt.Sprintf("SLIDINGWINDOW:%d:%d", p.Window, p.WindowQuality),
+			fmt.Sprintf("MINLEN:%d", p.MinLength),
 		)
-	case "custom":
-		if s.CustomArgs == "" {
-			return fmt.Errorf("filter mode is 'custom' but no custom arguments were provided")
-		}
-		// Разбиваем строку по пробелам и просто добавляем как есть.
-		// Пользователь полностью контролирует параметры.
-		for _, part := range splitArgs(s.CustomArgs) {
-			if part != "" {
-				args = append(args, part)
-			}
-		}
-	default:
-		return fmt.Errorf("unknown filter mode: %s (expected: standard, strict, lenient, custom)", s.Mode)
+	} else {
+		args = append(args, job.CustomArgs...)
 	}
-
-	cmd := exec.Command("trimmomatic", args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("trimmomatic command failed: %w", err)
+	if job.Encoding.Offset() == 64 {
+		// Trimmomatic keeps the input encoding unless told otherwise.
+		args = append(args, "TOPHRED33")
 	}
 
-	if !fileExists(s.PairedOutput1) || !fileExists(s.PairedOutput2) {
-		return fmt.Errorf("trimmomatic failed, expected files not found: %s, %s", s.PairedOutput1, s.PairedOutput2)
+	// Trimmomatic reports progress and the read survival summary on
+	// stderr; keep it as a log and parse the summary from it.
+	logPath := filepath.Join(job.Dir, trimLogFile)
+	if err := runLogged(ctx, logPath, t.Tools.bin("trimmomatic"), args...); err != nil {
+		return nil, err
 	}
 
-	// Validate that resulting gz files are not truncated/corrupt
-	if !gzipIntegrityOK(s.PairedOutput1) || !gzipIntegrityOK(s.PairedOutput2) {
-		return fmt.Errorf("trimmomatic produced invalid gzip outputs (possible truncation)")
+	log, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trimmomatic log: %w", err)
 	}
-
-	fmt.Println("Trimmomatic trimming completed.")
-	return nil
+	defer log.Close()
+	return ParseTrimmomaticLog(log)
 }
@@ -0,0 +1,74 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// unicyclerDir is Unicycler's output directory inside the assembly
+// directory.
+const unicyclerDir = "unicycler"
+
+// UnicyclerModes lists the accepted values of UnicyclerAssembler.Mode.
+var UnicyclerModes = []string{"conservative", "normal", "bold"}
+
+// UnicyclerAssembler assembles with Unicycler, a hybrid assembler when long
+// reads are given, and moves its assembly.fasta to contigs.fasta.
+type UnicyclerAssembler struct {
+	Tools Tools
+	// Mode is one of UnicyclerModes, passed as --mode.
+	Mode string
+	// ExtraArgs are passed to unicycler, for example "--keep 0".
+	ExtraArgs []string
+}
+
+func (a *UnicyclerAssembler) Name() string {
+	return "Unicycler"
+}
+
+func (a *UnicyclerAssembler) Version(ctx context.Context) string {
+	return toolVersion(ctx, a.Tools.bin("unicycler"), "--version")
+}
+
+func (a *UnicyclerAssembler) Args() []string {
+	var args []string
+	if a.Mode != "" {
+		args = append(args, "--mode", a.Mode)
+	}
+	return append(args, a.ExtraArgs...)
+}
+
+func (a *UnicyclerAssembler) LongReads() LongReadUse {
+	return LongReadsOptional
+}
+
+func (a *UnicyclerAssembler) Assemble(ctx context.Context, job *AssemblyJob) error {
+	outDir := filepath.Join(job.Dir, unicyclerDir)
+	args := a.Args()
+	if job.singleEnd() {
+		args = append(args, "-s", job.Input1)
+	} else {
+		args = append(args, "-1", job.Input1, "-2", job.Input2)
+	}
+	if job.LongReads != "" {
+		args = append(args, "-l", job.LongReads)
+	}
+	args = append(args,
+		"-t", fmt.Sprintf("%d", job.Threads),
+		"-o", outDir)
+	cmd := newCommand(ctx, a.Tools.bin("unicycler"), args...)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("unicycler command failed: %w", err)
+	}
+	contigs := filepath.Join(outDir, "assembly.fasta")
+	if !fileExists(contigs) {
+		return fmt.Errorf("unicycler failed, expected file not found: %s", contigs)
+	}
+	if err := os.Rename(contigs, job.Contigs); err != nil {
+		return fmt.Errorf("failed to move Unicycler contigs: %w", err)
+	}
+	return nil
+}
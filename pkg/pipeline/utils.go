@@ -3,14 +3,45 @@ package pipeline
 import (
 	"bufio"
 	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"os/exec"
 	"strings"
 	"sync"
 	"time"
 )
 
+// killGracePeriod is how long a cancelled tool gets to exit after SIGTERM
+// before it and its children are killed. Tests shorten it.
+var killGracePeriod = 10 * time.Second
+
+// Tools maps tool names (as invoked on the command line, e.g. "spades.py")
+// to the executables that should be run instead. Tools without an entry are
+// resolved through PATH.
+type Tools map[string]string
+
+// bin returns the executable to run for the named tool.
+func (t Tools) bin(name string) string {
+	if path := t[name]; path != "" {
+		return path
+	}
+	return name
+}
+
+// newCommand prepares an external tool invocation bound to ctx. Output is
+// streamed to the terminal and the tool runs in its own process group so
+// that cancelling ctx tears down the whole process tree. Callers that
+// capture the output replace Stdout and Stderr.
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	setProcessGroup(cmd)
+	return cmd
+}
+
 // fileExists checks if a file exists and is not a directory.
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
@@ -51,6 +82,22 @@ func gzipIntegrityOK(path string) bool {
 	return true
 }
 
+// fastaLooksValid performs a cheap sanity check on a FASTA file: it must be
+// non-empty and start with a header line.
+func fastaLooksValid(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(f, first); err != nil {
+		return false
+	}
+	return first[0] == '>'
+}
+
 // removeIfExists deletes the file if it exists (ignores directories).
 func removeIfExists(path string) error {
 	if fileExists(path) {
@@ -92,8 +139,21 @@ func StartSpinner(prefix string) func(final string) {
 	}
 }
 
+// nonEmpty returns the given paths with empty entries removed. Optional
+// inputs, such as the second read file of a single-end library, are left
+// empty by callers.
+func nonEmpty(paths ...string) []string {
+	var out []string
+	for _, p := range paths {
+		if p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
 // splitArgs is a tiny helper that splits a string on whitespace.
-// It is used to expand custom Trimmomatic parameters supplied by the user.
+// It is used to expand custom trimmer parameters supplied by the user.
 func splitArgs(s string) []string {
 	fields := strings.Fields(s)
 	if len(fields) == 0 {
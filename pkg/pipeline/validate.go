@@ -0,0 +1,224 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"bio-assembler/pkg/seqio"
+)
+
+// ReadStatsFile is written by ValidateReadsStep.
+const ReadStatsFile = "read_stats.json"
+
+// ReadStats describes the raw reads of a sample as checked by
+// ValidateReadsStep. For paired-end libraries Reads counts pairs.
+type ReadStats struct {
+	Paired   bool           `json:"paired"`
+	Reads    int64          `json:"reads"`
+	Encoding seqio.Encoding `json:"quality_encoding"`
+	// QualityRange is the lowest and highest quality character seen.
+	QualityRange string          `json:"quality_range"`
+	Files        []FileReadStats `json:"files"`
+}
+
+// FileReadStats are the read counts and lengths of one FASTQ file.
+type FileReadStats struct {
+	File       string  `json:"file"`
+	Reads      int64   `json:"reads"`
+	Bases      int64   `json:"bases"`
+	MinLength  int     `json:"min_length"`
+	MaxLength  int     `json:"max_length"`
+	MeanLength float64 `json:"mean_length"`
+	// Lengths is the read length distribution, by increasing length.
+	Lengths []LengthCount `json:"length_distribution"`
+}
+
+// LengthCount is the number of reads of one length.
+type LengthCount struct {
+	Length int   `json:"length"`
+	Reads  int64 `json:"reads"`
+}
+
+// fileStatsBuilder accumulates FileReadStats record by record.
+type fileStatsBuilder struct {
+	file    string
+	reads   int64
+	bases   int64
+	lengths []int64
+}
+
+func (b *fileStatsBuilder) add(rec *seqio.Record) {
+	n := len(rec.Seq)
+	if n >= len(b.lengths) {
+		b.lengths = append(b.lengths, make([]int64, n+1-len(b.lengths))...)
+	}
+	b.lengths[n]++
+	b.reads++
+	b.bases += int64(n)
+}
+
+func (b *fileStatsBuilder) stats() FileReadStats {
+	s := FileReadStats{File: filepath.Base(b.file), Reads: b.reads, Bases: b.bases}
+	for length, count := range b.lengths {
+		if count == 0 {
+			continue
+		}
+		if len(s.Lengths) == 0 {
+			s.MinLength = length
+		}
+		s.MaxLength = length
+		s.Lengths = append(s.Lengths, LengthCount{Length: length, Reads: count})
+	}
+	if b.reads > 0 {
+		s.MeanLength = float64(b.bases) / float64(b.reads)
+	}
+	return s
+}
+
+// ReadReadStats loads the statistics written by ValidateReadsStep.
+func ReadReadStats(path string) (*ReadStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &ReadStats{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// ValidateReadsStep reads the raw FASTQ files in full before anything else
+// uses them. It fails on malformed or truncated records and, for paired-end
+// libraries, on files whose mates are out of step or that hold different
+// numbers of reads. Read counts, length distributions and the detected
+// quality encoding are written to read_stats.json in Output.
+type ValidateReadsStep struct {
+	InputFq1 string
+	// InputFq2 is empty for single-end libraries.
+	InputFq2 string
+	Output   string
+}
+
+func (s *ValidateReadsStep) Name() string {
+	return "Read Validation"
+}
+
+func (s *ValidateReadsStep) CacheSpec(ctx context.Context) (*CacheSpec, error) {
+	return &CacheSpec{
+		Dir:         s.Output,
+		Inputs:      nonEmpty(s.InputFq1, s.InputFq2),
+		ToolVersion: "builtin",
+		Outputs:     []string{filepath.Join(s.Output, ReadStatsFile)},
+	}, nil
+}
+
+func (s *ValidateReadsStep) Run(ctx context.Context) error {
+	fmt.Println("Validating raw reads...")
+	stats, err := s.validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	stage, err := newStaging(s.Output)
+	if err != nil {
+		return err
+	}
+	defer stage.discard()
+	data, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode read statistics: %w", err)
+	}
+	if err := os.WriteFile(stage.path(ReadStatsFile), append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write read statistics: %w", err)
+	}
+	if err := stage.promote(); err != nil {
+		return err
+	}
+
+	unit := "reads"
+	if stats.Paired {
+		unit = "read pairs"
+	}
+	fmt.Printf("Validated %d %s, quality encoding %s (%s).\n", stats.Reads, unit, stats.Encoding, stats.QualityRange)
+	for _, f := range stats.Files {
+		fmt.Printf("  %s: %d bases, read length %d-%d (mean %.1f)\n", f.File, f.Bases, f.MinLength, f.MaxLength, f.MeanLength)
+	}
+	return nil
+}
+
+func (s *ValidateReadsStep) validate(ctx context.Context) (*ReadStats, error) {
+	var quals seqio.QualityRange
+	files := []*fileStatsBuilder{{file: s.InputFq1}}
+	if s.InputFq2 != "" {
+		files = append(files, &fileStatsBuilder{file: s.InputFq2})
+	}
+	add := func(i int, rec *seqio.Record) {
+		files[i].add(rec)
+		quals.Add(rec.Qual)
+	}
+
+	var reads int64
+	if s.InputFq2 == "" {
+		r, err := seqio.OpenFastq(s.InputFq1)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		r.Validate = true
+		for ; ; reads++ {
+			rec, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid reads in %s: %w", s.InputFq1, err)
+			}
+			add(0, rec)
+			if reads%100000 == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+	} else {
+		r, err := seqio.OpenPaired(s.InputFq1, s.InputFq2)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		r.SetValidate(true)
+		for ; ; reads++ {
+			rec1, rec2, err := r.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid read pairs in %s and %s: %w", s.InputFq1, s.InputFq2, err)
+			}
+			add(0, rec1)
+			add(1, rec2)
+			if reads%100000 == 0 && ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+		}
+	}
+	if reads == 0 {
+		return nil, fmt.Errorf("no reads found in %s", s.InputFq1)
+	}
+
+	stats := &ReadStats{
+		Paired:   s.InputFq2 != "",
+		Reads:    reads,
+		Encoding: quals.Encoding(),
+	}
+	if quals.Max > 0 {
+		stats.QualityRange = fmt.Sprintf("%c-%c", quals.Min, quals.Max)
+	}
+	for _, f := range files {
+		stats.Files = append(stats.Files, f.stats())
+	}
+	return stats, nil
+}
@@ -0,0 +1,206 @@
+// Package report turns the outputs of a finished pipeline run into a
+// self-contained HTML report and a Markdown version of it.
+package report
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"bio-assembler/pkg/assemblystats"
+	"bio-assembler/pkg/bamstats"
+	"bio-assembler/pkg/fastqc"
+	"bio-assembler/pkg/pipeline"
+)
+
+// Data is everything the report shows about one sample. Sections whose
+// step has not produced results are nil and listed in Missing.
+type Data struct {
+	Sample    string
+	Generated time.Time
+	Layout    pipeline.Layout
+
+	RawQC     []*fastqc.Result
+	TrimmedQC []*fastqc.Result
+	Trimming  *Trimming
+	Assembly  *assemblystats.Stats
+	Polished  *assemblystats.Stats
+	Polishing *pipeline.PolishSummary
+	Coverage  *bamstats.Stats
+	Qualimap  *Qualimap
+
+	// ContigFilter is nil for runs from before contig filtering existed
+	// and for runs with both filters turned off; it is optional and not
+	// listed in Missing.
+	ContigFilter *pipeline.ContigFilterStats
+
+	// Missing maps a section key to the location its results were
+	// expected in.
+	Missing map[string]string
+}
+
+// Trimming summarises how many reads survived trimming. Log is set when
+// the numbers come from the trimmer's own metrics rather than FastQC.
+type Trimming struct {
+	Input     int64
+	Surviving int64
+	Log       *pipeline.TrimMetrics
+}
+
+func (t *Trimming) SurvivalPercent() float64 {
+	if t.Input == 0 {
+		return 0
+	}
+	return 100 * float64(t.Surviving) / float64(t.Input)
+}
+
+// Qualimap holds the headline numbers of Qualimap's genome_results.txt.
+type Qualimap struct {
+	Reads         int64
+	MappedReads   int64
+	MappedPercent float64
+	MeanCoverage  float64
+	StdCoverage   float64
+	GCPercent     float64
+}
+
+// Collect gathers the results of every step of the sample in layout.
+// Missing or unreadable results do not fail the report; the affected
+// section is recorded in Data.Missing instead.
+func Collect(sample string, layout pipeline.Layout) *Data {
+	d := &Data{
+		Sample:    sample,
+		Generated: time.Now(),
+		Layout:    layout,
+		Missing:   make(map[string]string),
+	}
+	missing := func(section, path string, err error) {
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			fmt.Printf("Warning: could not read %s: %v\n", path, err)
+		}
+		d.Missing[section] = path
+	}
+
+	var err error
+	if d.RawQC, err = collectFastQC(layout.FastQCRaw); err != nil || len(d.RawQC) == 0 {
+		missing("raw_qc", layout.FastQCRaw, err)
+	}
+	if d.TrimmedQC, err = collectFastQC(layout.FastQCTrimmed); err != nil || len(d.TrimmedQC) == 0 {
+		missing("trimmed_qc", layout.FastQCTrimmed, err)
+	}
+	// Without trimming metrics the survival rate is derived from the read
+	// counts FastQC saw before and after trimming (first mate only).
+	if m, err := pipeline.ReadTrimMetrics(layout.TrimMetrics()); err == nil {
+		d.Trimming = &Trimming{Input: m.Input, Surviving: m.Surviving, Log: m}
+	} else if len(d.RawQC) > 0 && len(d.TrimmedQC) > 0 {
+		d.Trimming = &Trimming{Input: d.RawQC[0].TotalSequences, Surviving: d.TrimmedQC[0].TotalSequences}
+	} else {
+		missing("trimming", layout.TrimMetrics(), err)
+	}
+	if d.Assembly, err = assemblystats.ComputeFile(layout.Contigs(), 0); err != nil {
+		missing("assembly", layout.Contigs(), err)
+	}
+	if d.ContigFilter, err = pipeline.ReadContigFilterStats(layout.ContigFilterStats()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("Warning: could not read %s: %v\n", layout.ContigFilterStats(), err)
+	}
+	if f := d.ContigFilter; f != nil && f.MinLength == 0 && f.MinCoverage == 0 {
+		d.ContigFilter = nil
+	}
+	if d.Polished, err = assemblystats.ComputeFile(layout.PolishedContigs(), 0); err != nil {
+		missing("polishing", layout.PolishedContigs(), err)
+	}
+	if d.Polishing, err = pipeline.ReadPolishSummary(layout.PolishSummary()); err != nil {
+		missing("polishing", layout.PolishSummary(), err)
+	}
+	// The coverage section needs either the built-in statistics or
+	// Qualimap, which may have been skipped.
+	var coverageErr error
+	d.Coverage, coverageErr = pipeline.ReadCoverageStats(layout.CoverageStats())
+	qualimapResults := filepath.Join(layout.Qualimap, "genome_results.txt")
+	d.Qualimap, err = readQualimap(qualimapResults)
+	if d.Coverage == nil && d.Qualimap == nil {
+		missing("coverage", qualimapResults, err)
+		missing("coverage", layout.CoverageStats(), coverageErr)
+	}
+	return d
+}
+
+// collectFastQC parses every FastQC archive in dir, in file name order.
+func collectFastQC(dir string) ([]*fastqc.Result, error) {
+	zips, err := filepath.Glob(filepath.Join(dir, "*_fastqc.zip"))
+	if err != nil {
+		return nil, err
+	}
+	var results []*fastqc.Result
+	for _, z := range zips {
+		res, err := fastqc.ParseZip(z)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// readQualimap extracts the "key = value" lines of genome_results.txt that
+// the report uses.
+func readQualimap(path string) (*Qualimap, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	q := &Qualimap{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), "=")
+		if !ok {
+			continue
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		switch key {
+		case "number of reads":
+			q.Reads = parseCount(value)
+		case "number of mapped reads":
+			q.MappedReads = parseCount(value)
+			if _, pct, ok := strings.Cut(value, "("); ok {
+				q.MappedPercent = parseNumber(pct)
+			}
+		case "mean coverageData":
+			q.MeanCoverage = parseNumber(value)
+		case "std coverageData":
+			q.StdCoverage = parseNumber(value)
+		case "GC percentage":
+			q.GCPercent = parseNumber(value)
+		}
+	}
+	return q, scanner.Err()
+}
+
+// parseCount reads a number written with thousands separators, such as
+// "3,900 (97.5%)".
+func parseCount(s string) int64 {
+	field, _, _ := strings.Cut(s, " ")
+	n, _ := strconv.ParseInt(strings.ReplaceAll(field, ",", ""), 10, 64)
+	return n
+}
+
+// parseNumber reads the leading decimal number of s, ignoring units such
+// as "X" or "%".
+func parseNumber(s string) float64 {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	end := 0
+	for end < len(s) && (s[end] >= '0' && s[end] <= '9' || s[end] == '.' || s[end] == '-') {
+		end++
+	}
+	v, _ := strconv.ParseFloat(s[:end], 64)
+	return v
+}
@@ -0,0 +1,168 @@
+package report
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/template"
+
+	"bio-assembler/pkg/fastqc"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed lang/*.yaml
+var langFS embed.FS
+
+// Language holds the texts of the report in one language. Entries under
+// Text are templates executed with the report Data.
+type Language struct {
+	Name     string            `yaml:"name"`
+	Headings map[string]string `yaml:"headings"`
+	Labels   map[string]string `yaml:"labels"`
+	Plots    map[string]string `yaml:"plots"`
+	Text     map[string]string `yaml:"text"`
+}
+
+// Languages lists the codes of the bundled languages.
+func Languages() []string {
+	entries, _ := langFS.ReadDir("lang")
+	var codes []string
+	for _, e := range entries {
+		codes = append(codes, strings.TrimSuffix(e.Name(), path.Ext(e.Name())))
+	}
+	return codes
+}
+
+// LoadLanguage returns a bundled language by its code (e.g. "en").
+func LoadLanguage(code string) (*Language, error) {
+	data, err := langFS.ReadFile("lang/" + code + ".yaml")
+	if err != nil {
+		return nil, fmt.Errorf("unknown report language %q (available: %s)", code, strings.Join(Languages(), ", "))
+	}
+	return parseLanguage(data)
+}
+
+// LoadLanguageFile reads a custom language file on top of the bundled
+// language base. Entries it leaves out are taken from base, so a file may
+// translate or reword only some texts.
+func LoadLanguageFile(file, base string) (*Language, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read language file: %w", err)
+	}
+	custom, err := parseLanguage(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	lang, err := LoadLanguage(base)
+	if err != nil {
+		return nil, err
+	}
+	if custom.Name != "" {
+		lang.Name = custom.Name
+	}
+	maps.Copy(lang.Headings, custom.Headings)
+	maps.Copy(lang.Labels, custom.Labels)
+	maps.Copy(lang.Plots, custom.Plots)
+	maps.Copy(lang.Text, custom.Text)
+	return lang, nil
+}
+
+func parseLanguage(data []byte) (*Language, error) {
+	lang := &Language{}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(lang); err != nil {
+		return nil, err
+	}
+	for _, m := range []*map[string]string{&lang.Headings, &lang.Labels, &lang.Plots, &lang.Text} {
+		if *m == nil {
+			*m = make(map[string]string)
+		}
+	}
+	return lang, nil
+}
+
+// textFuncs are the helpers available in the narrative templates.
+var textFuncs = template.FuncMap{
+	"mb": func(n int64) string { return fmt.Sprintf("%.2f", float64(n)/1e6) },
+	"pct": func(v float64) string {
+		return fmt.Sprintf("%.1f%%", v)
+	},
+	"num":    formatCount,
+	"join":   func(s []string) string { return strings.Join(s, ", ") },
+	"reads":  totalReads,
+	"failed": func(qc []*fastqc.Result) []string { return modulesWith(qc, fastqc.Fail) },
+	"warned": func(qc []*fastqc.Result) []string { return modulesWith(qc, fastqc.Warn) },
+}
+
+// text executes the narrative template key with data.
+func (l *Language) text(key string, data any) (string, error) {
+	src, ok := l.Text[key]
+	if !ok {
+		return "", fmt.Errorf("report language %s has no text %q", l.Name, key)
+	}
+	tmpl, err := template.New(key).Funcs(textFuncs).Parse(src)
+	if err != nil {
+		return "", fmt.Errorf("invalid report text %q: %w", key, err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to fill in report text %q: %w", key, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// label looks up a table or plot label, falling back to the key so a
+// missing translation is visible but harmless.
+func label(m map[string]string, key string) string {
+	if v, ok := m[key]; ok {
+		return v
+	}
+	return key
+}
+
+// formatCount prints a count with thousands separators.
+func formatCount(n int64) string {
+	s := fmt.Sprint(n)
+	if n < 0 {
+		return s
+	}
+	var b strings.Builder
+	for i, c := range s {
+		if i > 0 && (len(s)-i)%3 == 0 {
+			b.WriteRune(',')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// modulesWith lists, in order of first appearance, the FastQC modules that
+// have the given status in any of the results.
+func modulesWith(qc []*fastqc.Result, status fastqc.Status) []string {
+	var names []string
+	for _, r := range qc {
+		for _, m := range r.WithStatus(status) {
+			if !slices.Contains(names, m) {
+				names = append(names, m)
+			}
+		}
+	}
+	return names
+}
+
+// totalReads sums the reads FastQC saw over all files of one stage.
+func totalReads(qc []*fastqc.Result) int64 {
+	var n int64
+	for _, r := range qc {
+		n += r.TotalSequences
+	}
+	return n
+}
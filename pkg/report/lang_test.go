@@ -0,0 +1,35 @@
+package report
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLanguageFileLayersOnBase(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "texts.yaml")
+	if err := os.WriteFile(file, []byte("text:\n  polishing: Custom polishing text.\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, base := range Languages() {
+		t.Run(base, func(t *testing.T) {
+			want, err := LoadLanguage(base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lang, err := LoadLanguageFile(file, base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := lang.Text["polishing"]; got != "Custom polishing text." {
+				t.Errorf("polishing text is %q, want the custom one", got)
+			}
+			if lang.Name != want.Name || lang.Text["assembly"] != want.Text["assembly"] || lang.Headings["overview"] != want.Headings["overview"] {
+				t.Errorf("texts the file leaves out are not taken from %s", base)
+			}
+		})
+	}
+	if _, err := LoadLanguageFile(file, "xx"); err == nil {
+		t.Error("unknown base language accepted")
+	}
+}
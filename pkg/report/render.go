@@ -0,0 +1,343 @@
+package report
+
+import (
+	"embed"
+	"encoding/base64"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"bio-assembler/pkg/assemblystats"
+	"bio-assembler/pkg/bamstats"
+	"bio-assembler/pkg/fastqc"
+	"bio-assembler/pkg/pipeline"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// document is the language-resolved content of a report, shared by the
+// HTML and Markdown renderers.
+type document struct {
+	Title     string
+	Generated string
+	Sections  []section
+}
+
+type section struct {
+	Heading    string
+	Paragraphs []string
+	Tables     []table
+	Plots      []plot
+}
+
+type table struct {
+	Header []string
+	Rows   [][]string
+}
+
+type plot struct {
+	Title string
+	SVG   string
+}
+
+// WriteHTML renders the report as a single HTML file with inline plots.
+func WriteHTML(w io.Writer, d *Data, lang *Language) error {
+	doc, err := buildDocument(d, lang)
+	if err != nil {
+		return err
+	}
+	tmpl, err := htmltemplate.New("report.html.tmpl").Funcs(htmltemplate.FuncMap{
+		"svg": func(s string) htmltemplate.HTML { return htmltemplate.HTML(s) },
+	}).ParseFS(templateFS, "templates/report.html.tmpl")
+	if err != nil {
+		return fmt.Errorf("failed to parse HTML template: %w", err)
+	}
+	return tmpl.Execute(w, doc)
+}
+
+// WriteMarkdown renders the report as Markdown. Plots are embedded as SVG
+// data URIs so the file does not depend on anything next to it.
+func WriteMarkdown(w io.Writer, d *Data, lang *Language) error {
+	doc, err := buildDocument(d, lang)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New("report.md.tmpl").Funcs(template.FuncMap{
+		"cell": func(s string) string { return strings.ReplaceAll(s, "|", `\|`) },
+		"dataURI": func(s string) string {
+			return "data:image/svg+xml;base64," + base64.StdEncoding.EncodeToString([]byte(s))
+		},
+		"rule": func(n int) string { return strings.Repeat("|---", n) + "|" },
+	}).ParseFS(templateFS, "templates/report.md.tmpl")
+	if err != nil {
+		return fmt.Errorf("failed to parse Markdown template: %w", err)
+	}
+	return tmpl.Execute(w, doc)
+}
+
+// buildDocument lays out the sections of the report in pipeline order.
+func buildDocument(d *Data, lang *Language) (*document, error) {
+	doc := &document{}
+	var err error
+	if doc.Title, err = lang.text("title", d); err != nil {
+		return nil, err
+	}
+	if doc.Generated, err = lang.text("generated", d); err != nil {
+		return nil, err
+	}
+
+	builders := []struct {
+		key   string
+		ready bool
+		build func(*section)
+	}{
+		{"overview", true, func(s *section) {}},
+		{"raw_qc", len(d.RawQC) > 0, func(s *section) {
+			s.Tables = append(s.Tables, qcTable(d.RawQC, lang))
+			s.Plots = append(s.Plots, qualityPlot(lang, d.RawQC, nil))
+		}},
+		{"trimming", d.Trimming != nil, func(s *section) {
+			s.Tables = append(s.Tables, trimmingTable(lang, d.Trimming))
+		}},
+		{"trimmed_qc", len(d.TrimmedQC) > 0, func(s *section) {
+			s.Tables = append(s.Tables, qcTable(d.TrimmedQC, lang))
+			s.Plots = append(s.Plots, qualityPlot(lang, d.RawQC, d.TrimmedQC))
+		}},
+		{"assembly", d.Assembly != nil, func(s *section) {
+			s.Tables = append(s.Tables, assemblyTable(lang, d.Assembly, d.Polished))
+			final := d.Assembly
+			if d.Polished != nil {
+				final = d.Polished
+			}
+			s.Plots = append(s.Plots, histogramPlot(lang, final))
+		}},
+		{"polishing", d.Polishing != nil, func(s *section) {
+			p := d.Polishing
+			row := func(polisher, round string, c pipeline.Corrections) []string {
+				return []string{polisher, round, strconv.Itoa(c.Total), strconv.Itoa(c.SNPs), strconv.Itoa(c.Insertions),
+					strconv.Itoa(c.Deletions), strconv.Itoa(c.Other)}
+			}
+			t := table{
+				Header: []string{label(lang.Labels, "polisher"), label(lang.Labels, "round"), label(lang.Labels, "changes"),
+					label(lang.Labels, "snps"), label(lang.Labels, "insertions"), label(lang.Labels, "deletions"), label(lang.Labels, "other")},
+			}
+			for _, st := range p.Stages {
+				for _, r := range st.Rounds {
+					t.Rows = append(t.Rows, row(st.Polisher, strconv.Itoa(r.Round), r.Corrections))
+				}
+				if len(st.Rounds) > 1 {
+					t.Rows = append(t.Rows, row(st.Polisher, label(lang.Labels, "all_rounds"), st.Corrections))
+				}
+			}
+			if len(p.Stages) > 1 {
+				t.Rows = append(t.Rows, row(label(lang.Labels, "all_polishers"), "", p.Corrections))
+			}
+			s.Tables = append(s.Tables, t)
+		}},
+		{"coverage", d.Coverage != nil || d.Qualimap != nil, func(s *section) {
+			if d.Coverage != nil {
+				s.Tables = append(s.Tables, coverageTables(lang, d.Coverage)...)
+				if d.Coverage.InsertSize != nil {
+					s.Plots = append(s.Plots, insertSizePlot(lang, d.Coverage.InsertSize))
+				}
+				return
+			}
+			q := d.Qualimap
+			s.Tables = append(s.Tables, table{
+				Header: []string{label(lang.Labels, "reads"), label(lang.Labels, "mapped_reads"), label(lang.Labels, "mapped_percent"),
+					label(lang.Labels, "mean_coverage"), label(lang.Labels, "std_coverage")},
+				Rows: [][]string{{formatCount(q.Reads), formatCount(q.MappedReads), fmt.Sprintf("%.2f", q.MappedPercent),
+					fmt.Sprintf("%.1f", q.MeanCoverage), fmt.Sprintf("%.1f", q.StdCoverage)}},
+			})
+		}},
+	}
+
+	for _, b := range builders {
+		s := section{Heading: label(lang.Headings, b.key)}
+		if !b.ready {
+			text, err := lang.text("missing", d.Missing[b.key])
+			if err != nil {
+				return nil, err
+			}
+			s.Paragraphs = append(s.Paragraphs, text)
+			doc.Sections = append(doc.Sections, s)
+			continue
+		}
+		text, err := lang.text(b.key, d)
+		if err != nil {
+			return nil, err
+		}
+		if text != "" {
+			s.Paragraphs = append(s.Paragraphs, text)
+		}
+		b.build(&s)
+		doc.Sections = append(doc.Sections, s)
+	}
+	return doc, nil
+}
+
+func qcTable(qc []*fastqc.Result, lang *Language) table {
+	t := table{Header: []string{
+		label(lang.Labels, "file"), label(lang.Labels, "reads"), label(lang.Labels, "sequence_length"),
+		label(lang.Labels, "gc"), label(lang.Labels, "failed_modules"), label(lang.Labels, "warned_modules"),
+	}}
+	orNone := func(names []string) string {
+		if len(names) == 0 {
+			return label(lang.Labels, "none")
+		}
+		return strings.Join(names, ", ")
+	}
+	for _, r := range qc {
+		t.Rows = append(t.Rows, []string{
+			r.Filename, formatCount(r.TotalSequences), r.SequenceLength, strconv.Itoa(r.GCPercent),
+			orNone(r.WithStatus(fastqc.Fail)), orNone(r.WithStatus(fastqc.Warn)),
+		})
+	}
+	return t
+}
+
+// trimmingTable shows the read survival, with the mate and dropped counts
+// when the trimmer's metrics are available.
+func trimmingTable(lang *Language, t *Trimming) table {
+	tab := table{
+		Header: []string{label(lang.Labels, "input_reads"), label(lang.Labels, "surviving_reads")},
+		Rows:   [][]string{{formatCount(t.Input), formatCount(t.Surviving)}},
+	}
+	if m := t.Log; m != nil {
+		if m.Paired {
+			tab.Header = append(tab.Header, label(lang.Labels, "forward_only"), label(lang.Labels, "reverse_only"))
+			tab.Rows[0] = append(tab.Rows[0], formatCount(m.ForwardOnly), formatCount(m.ReverseOnly))
+		}
+		tab.Header = append(tab.Header, label(lang.Labels, "dropped"))
+		tab.Rows[0] = append(tab.Rows[0], formatCount(m.Dropped))
+	}
+	tab.Header = append(tab.Header, label(lang.Labels, "survival"))
+	tab.Rows[0] = append(tab.Rows[0], fmt.Sprintf("%.1f", t.SurvivalPercent()))
+	return tab
+}
+
+// assemblyTable compares the draft and polished assemblies side by side.
+func assemblyTable(lang *Language, draft, polished *assemblystats.Stats) table {
+	t := table{Header: []string{label(lang.Labels, "metric"), label(lang.Labels, "draft")}}
+	all := []*assemblystats.Stats{draft}
+	if polished != nil {
+		t.Header = append(t.Header, label(lang.Labels, "polished"))
+		all = append(all, polished)
+	}
+	row := func(key string, value func(*assemblystats.Stats) string) {
+		r := []string{label(lang.Labels, key)}
+		for _, s := range all {
+			r = append(r, value(s))
+		}
+		t.Rows = append(t.Rows, r)
+	}
+	row("contigs", func(s *assemblystats.Stats) string { return strconv.Itoa(s.Contigs) })
+	row("total_length", func(s *assemblystats.Stats) string { return formatCount(s.TotalLength) })
+	row("largest", func(s *assemblystats.Stats) string { return formatCount(int64(s.Largest)) })
+	row("n50", func(s *assemblystats.Stats) string { return formatCount(int64(s.N50)) })
+	row("n90", func(s *assemblystats.Stats) string { return formatCount(int64(s.N90)) })
+	row("l50", func(s *assemblystats.Stats) string { return strconv.Itoa(s.L50) })
+	row("l90", func(s *assemblystats.Stats) string { return strconv.Itoa(s.L90) })
+	row("gc", func(s *assemblystats.Stats) string { return fmt.Sprintf("%.2f", s.GCPercent) })
+	row("n_percent", func(s *assemblystats.Stats) string { return fmt.Sprintf("%.3f", s.NPercent) })
+	return t
+}
+
+// qualityPlot draws the mean per-base quality of every reads file, with
+// FastQC's good/reasonable/poor zones in the background.
+// coverageTables shows the mapping statistics, when known, and the depth
+// and breadth of coverage of the whole assembly.
+func coverageTables(lang *Language, c *bamstats.Stats) []table {
+	var tables []table
+	if m := c.Mapping; m != nil {
+		t := table{
+			Header: []string{label(lang.Labels, "reads"), label(lang.Labels, "mapped_reads"), label(lang.Labels, "mapped_percent"),
+				label(lang.Labels, "properly_paired_percent"), label(lang.Labels, "duplicate_percent")},
+			Rows: [][]string{{formatCount(m.Reads), formatCount(m.Mapped), fmt.Sprintf("%.2f", m.MappedPercent),
+				fmt.Sprintf("%.2f", m.ProperlyPairedPercent), fmt.Sprintf("%.2f", m.DuplicatePercent)}},
+		}
+		if is := c.InsertSize; is != nil {
+			t.Header = append(t.Header, label(lang.Labels, "insert_size"))
+			t.Rows[0] = append(t.Rows[0], fmt.Sprintf("%d (%.0f ± %.0f)", is.Median, is.Mean, is.StdDev))
+		}
+		tables = append(tables, t)
+	}
+	t := table{
+		Header: []string{label(lang.Labels, "mean_coverage"), label(lang.Labels, "median_coverage")},
+		Rows:   [][]string{{fmt.Sprintf("%.1f", c.Coverage.Mean), strconv.Itoa(c.Coverage.Median)}},
+	}
+	for _, b := range c.Coverage.Breadth {
+		t.Header = append(t.Header, fmt.Sprintf(label(lang.Labels, "breadth"), b.Depth))
+		t.Rows[0] = append(t.Rows[0], fmt.Sprintf("%.2f", b.Percent))
+	}
+	return append(tables, t)
+}
+
+func insertSizePlot(lang *Language, is *bamstats.InsertSize) plot {
+	s := series{Name: label(lang.Plots, "insert_size_series")}
+	for _, b := range is.Histogram {
+		s.X = append(s.X, float64(b.Min+bamstats.InsertBinWidth/2))
+		s.Y = append(s.Y, float64(b.Pairs))
+	}
+	title := label(lang.Plots, "insert_size_title")
+	return plot{
+		Title: title,
+		SVG:   lineChart(title, label(lang.Plots, "insert_size_x"), label(lang.Plots, "insert_size_y"), 1, nil, []series{s}),
+	}
+}
+
+func qualityPlot(lang *Language, raw, trimmed []*fastqc.Result) plot {
+	var lines []series
+	add := func(qc []*fastqc.Result, tag string) {
+		for _, r := range qc {
+			s := series{Name: fmt.Sprintf("%s (%s)", r.Filename, label(lang.Plots, tag))}
+			for _, q := range r.PerBaseQuality {
+				s.X = append(s.X, basePosition(q.Base))
+				s.Y = append(s.Y, q.Mean)
+			}
+			lines = append(lines, s)
+		}
+	}
+	add(raw, "raw")
+	add(trimmed, "trimmed")
+
+	title := label(lang.Plots, "quality_title")
+	return plot{
+		Title: title,
+		SVG: lineChart(title, label(lang.Plots, "quality_x"), label(lang.Plots, "quality_y"), 40, []band{
+			{From: 0, To: 20, Color: "#f6d3d3"},
+			{From: 20, To: 28, Color: "#f8ecd0"},
+			{From: 28, To: 100, Color: "#d9f0d9"},
+		}, lines),
+	}
+}
+
+// basePosition turns a FastQC base label ("7" or "10-14") into the middle
+// of the range.
+func basePosition(base string) float64 {
+	from, to, isRange := strings.Cut(base, "-")
+	a, _ := strconv.ParseFloat(from, 64)
+	if !isRange {
+		return a
+	}
+	b, _ := strconv.ParseFloat(to, 64)
+	return (a + b) / 2
+}
+
+func histogramPlot(lang *Language, s *assemblystats.Stats) plot {
+	var labels []string
+	var values []float64
+	for _, b := range s.Histogram {
+		labels = append(labels, b.Label())
+		values = append(values, float64(b.Contigs))
+	}
+	title := label(lang.Plots, "histogram_title")
+	return plot{
+		Title: title,
+		SVG:   barChart(title, label(lang.Plots, "histogram_x"), label(lang.Plots, "histogram_y"), labels, values),
+	}
+}
@@ -0,0 +1,152 @@
+package report
+
+import (
+	"fmt"
+	"html"
+	"math"
+	"strings"
+)
+
+// Plot geometry shared by all charts, in SVG user units.
+const (
+	plotWidth   = 640
+	plotHeight  = 320
+	marginLeft  = 56
+	marginRight = 16
+	marginTop   = 32
+	marginBot   = 64
+)
+
+var seriesColors = []string{"#1f77b4", "#d62728", "#2ca02c", "#ff7f0e", "#9467bd", "#8c564b"}
+
+// series is one line of a line chart.
+type series struct {
+	Name string
+	X    []float64
+	Y    []float64
+}
+
+// band shades a horizontal stripe of a chart, such as FastQC's quality
+// zones.
+type band struct {
+	From, To float64
+	Color    string
+}
+
+// svgCanvas maps data coordinates onto the plot area.
+type svgCanvas struct {
+	b                      strings.Builder
+	xMin, xMax, yMin, yMax float64
+}
+
+func newCanvas(title string, xMin, xMax, yMin, yMax float64) *svgCanvas {
+	c := &svgCanvas{xMin: xMin, xMax: xMax, yMin: yMin, yMax: yMax}
+	if c.xMax == c.xMin {
+		c.xMax = c.xMin + 1
+	}
+	if c.yMax == c.yMin {
+		c.yMax = c.yMin + 1
+	}
+	fmt.Fprintf(&c.b, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" width="%d" height="%d" font-family="sans-serif" font-size="11">`,
+		plotWidth, plotHeight, plotWidth, plotHeight)
+	fmt.Fprintf(&c.b, `<rect width="%d" height="%d" fill="#ffffff"/>`, plotWidth, plotHeight)
+	fmt.Fprintf(&c.b, `<text x="%d" y="20" text-anchor="middle" font-size="14" font-weight="bold">%s</text>`, plotWidth/2, html.EscapeString(title))
+	return c
+}
+
+func (c *svgCanvas) px(x float64) float64 {
+	return marginLeft + (x-c.xMin)/(c.xMax-c.xMin)*(plotWidth-marginLeft-marginRight)
+}
+
+func (c *svgCanvas) py(y float64) float64 {
+	return plotHeight - marginBot - (y-c.yMin)/(c.yMax-c.yMin)*(plotHeight-marginTop-marginBot)
+}
+
+// axes draws the frame, y grid lines and axis labels.
+func (c *svgCanvas) axes(xLabel, yLabel string, yTicks int) {
+	for i := 0; i <= yTicks; i++ {
+		v := c.yMin + (c.yMax-c.yMin)*float64(i)/float64(yTicks)
+		y := c.py(v)
+		fmt.Fprintf(&c.b, `<line x1="%d" y1="%.1f" x2="%d" y2="%.1f" stroke="#dddddd"/>`, marginLeft, y, plotWidth-marginRight, y)
+		fmt.Fprintf(&c.b, `<text x="%d" y="%.1f" text-anchor="end" dominant-baseline="middle">%s</text>`, marginLeft-6, y, formatTick(v))
+	}
+	fmt.Fprintf(&c.b, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#333333"/>`,
+		marginLeft, marginTop, plotWidth-marginLeft-marginRight, plotHeight-marginTop-marginBot)
+	fmt.Fprintf(&c.b, `<text x="%d" y="%d" text-anchor="middle">%s</text>`,
+		(plotWidth+marginLeft)/2, plotHeight-8, html.EscapeString(xLabel))
+	fmt.Fprintf(&c.b, `<text x="14" y="%d" text-anchor="middle" transform="rotate(-90 14 %d)">%s</text>`,
+		plotHeight/2, plotHeight/2, html.EscapeString(yLabel))
+}
+
+func (c *svgCanvas) String() string {
+	return c.b.String() + "</svg>"
+}
+
+// lineChart draws one polyline per series over optional background bands.
+func lineChart(title, xLabel, yLabel string, yMax float64, bands []band, lines []series) string {
+	xMax := 1.0
+	for _, s := range lines {
+		for _, x := range s.X {
+			xMax = math.Max(xMax, x)
+		}
+		for _, y := range s.Y {
+			yMax = math.Max(yMax, y)
+		}
+	}
+	c := newCanvas(title, 1, xMax, 0, yMax)
+	for _, b := range bands {
+		top, bottom := c.py(math.Min(b.To, yMax)), c.py(b.From)
+		fmt.Fprintf(&c.b, `<rect x="%d" y="%.1f" width="%d" height="%.1f" fill="%s"/>`,
+			marginLeft, top, plotWidth-marginLeft-marginRight, bottom-top, b.Color)
+	}
+	c.axes(xLabel, yLabel, 5)
+	for i := 0; i <= 4; i++ {
+		x := 1 + (xMax-1)*float64(i)/4
+		fmt.Fprintf(&c.b, `<text x="%.1f" y="%d" text-anchor="middle">%s</text>`, c.px(x), plotHeight-marginBot+16, formatTick(x))
+	}
+	for i, s := range lines {
+		color := seriesColors[i%len(seriesColors)]
+		points := make([]string, len(s.X))
+		for j := range s.X {
+			points[j] = fmt.Sprintf("%.1f,%.1f", c.px(s.X[j]), c.py(s.Y[j]))
+		}
+		fmt.Fprintf(&c.b, `<polyline fill="none" stroke="%s" stroke-width="2" points="%s"/>`, color, strings.Join(points, " "))
+		ly := marginTop + 14 + 16*i
+		fmt.Fprintf(&c.b, `<line x1="%d" y1="%d" x2="%d" y2="%d" stroke="%s" stroke-width="2"/>`,
+			plotWidth-marginRight-170, ly, plotWidth-marginRight-150, ly, color)
+		fmt.Fprintf(&c.b, `<text x="%d" y="%d" dominant-baseline="middle">%s</text>`,
+			plotWidth-marginRight-145, ly, html.EscapeString(s.Name))
+	}
+	return c.String()
+}
+
+// barChart draws one labelled bar per value.
+func barChart(title, xLabel, yLabel string, labels []string, values []float64) string {
+	yMax := 1.0
+	for _, v := range values {
+		yMax = math.Max(yMax, v)
+	}
+	c := newCanvas(title, 0, float64(len(values)), 0, yMax)
+	c.axes(xLabel, yLabel, 4)
+	slot := (c.px(1) - c.px(0))
+	for i, v := range values {
+		x := c.px(float64(i)) + slot*0.1
+		y := c.py(v)
+		fmt.Fprintf(&c.b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`,
+			x, y, slot*0.8, c.py(0)-y, seriesColors[0])
+		if v > 0 {
+			fmt.Fprintf(&c.b, `<text x="%.1f" y="%.1f" text-anchor="middle">%s</text>`, x+slot*0.4, y-4, formatTick(v))
+		}
+		fmt.Fprintf(&c.b, `<text x="%.1f" y="%d" text-anchor="end" font-size="9" transform="rotate(-30 %.1f %d)">%s</text>`,
+			x+slot*0.4, plotHeight-marginBot+12, x+slot*0.4, plotHeight-marginBot+12, html.EscapeString(labels[i]))
+	}
+	return c.String()
+}
+
+// formatTick prints axis values without needless decimals.
+func formatTick(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
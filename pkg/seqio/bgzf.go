@@ -0,0 +1,106 @@
+package seqio
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+)
+
+const (
+	// bgzfBlockData is the most uncompressed data put in one block, as in
+	// htslib; it keeps the compressed block under the 64 KiB limit.
+	bgzfBlockData = 0xff00
+	// bgzfHeaderSize and bgzfFooterSize frame the compressed data.
+	bgzfHeaderSize = 18
+	bgzfFooterSize = 8
+	bgzfMaxBlock   = 1 << 16
+)
+
+// bgzfEOF is the empty block that marks the end of a BGZF file.
+var bgzfEOF = []byte{
+	0x1f, 0x8b, 0x08, 0x04, 0x00, 0x00, 0x00, 0x00, 0x00, 0xff, 0x06, 0x00, 0x42, 0x43,
+	0x02, 0x00, 0x1b, 0x00, 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+}
+
+// BGZFWriter compresses to BGZF: independent gzip members of at most 64
+// KiB that carry their own size, so that indexed tools can seek in the
+// file. Close writes the end-of-file marker block.
+type BGZFWriter struct {
+	w     io.Writer
+	data  []byte
+	block bytes.Buffer
+	fw    *flate.Writer
+	err   error
+}
+
+func NewBGZFWriter(w io.Writer) *BGZFWriter {
+	fw, _ := flate.NewWriter(nil, flate.DefaultCompression)
+	return &BGZFWriter{w: w, data: make([]byte, 0, bgzfBlockData), fw: fw}
+}
+
+func (b *BGZFWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 && b.err == nil {
+		k := min(len(p), bgzfBlockData-len(b.data))
+		b.data = append(b.data, p[:k]...)
+		p, n = p[k:], n+k
+		if len(b.data) == bgzfBlockData {
+			b.flushBlock()
+		}
+	}
+	return n, b.err
+}
+
+// Close writes the last block and the end-of-file marker. It does not
+// close the underlying writer.
+func (b *BGZFWriter) Close() error {
+	if len(b.data) > 0 {
+		b.flushBlock()
+	}
+	if b.err == nil {
+		_, b.err = b.w.Write(bgzfEOF)
+	}
+	return b.err
+}
+
+func (b *BGZFWriter) flushBlock() {
+	if b.err != nil {
+		return
+	}
+	compressed := b.compress(flate.DefaultCompression)
+	if bgzfHeaderSize+len(compressed)+bgzfFooterSize > bgzfMaxBlock {
+		// Incompressible data grows a little; stored blocks always fit.
+		compressed = b.compress(flate.NoCompression)
+	}
+	size := bgzfHeaderSize + len(compressed) + bgzfFooterSize
+
+	var header [bgzfHeaderSize]byte
+	copy(header[:], []byte{0x1f, 0x8b, 0x08, 0x04, 0, 0, 0, 0, 0, 0xff, 0x06, 0x00, 'B', 'C', 0x02, 0x00})
+	binary.LittleEndian.PutUint16(header[16:], uint16(size-1))
+	var footer [bgzfFooterSize]byte
+	binary.LittleEndian.PutUint32(footer[0:], crc32.ChecksumIEEE(b.data))
+	binary.LittleEndian.PutUint32(footer[4:], uint32(len(b.data)))
+
+	for _, part := range [][]byte{header[:], compressed, footer[:]} {
+		if _, b.err = b.w.Write(part); b.err != nil {
+			return
+		}
+	}
+	b.data = b.data[:0]
+}
+
+func (b *BGZFWriter) compress(level int) []byte {
+	b.block.Reset()
+	if level == flate.DefaultCompression {
+		b.fw.Reset(&b.block)
+		b.fw.Write(b.data)
+		b.fw.Close()
+		return b.block.Bytes()
+	}
+	fw, _ := flate.NewWriter(&b.block, level)
+	fw.Write(b.data)
+	fw.Close()
+	return b.block.Bytes()
+}
@@ -0,0 +1,66 @@
+package seqio
+
+// Encoding is the ASCII offset scheme of FASTQ quality scores.
+type Encoding string
+
+const (
+	// Phred33 is the Sanger and Illumina 1.8+ encoding, '!' for Q0.
+	Phred33 Encoding = "phred33"
+	// Phred64 is the Illumina 1.3-1.7 encoding, '@' for Q0.
+	Phred64 Encoding = "phred64"
+	// Solexa64 is the early Solexa encoding, with scores down to -5 (';').
+	// Tools handle it as Phred64, which differs only for low scores.
+	Solexa64 Encoding = "solexa64"
+)
+
+// Offset is the character of quality 0.
+func (e Encoding) Offset() byte {
+	if e == Phred64 || e == Solexa64 {
+		return 64
+	}
+	return 33
+}
+
+// QualityRange tracks the lowest and highest quality characters seen, from
+// which the encoding of a file is inferred.
+type QualityRange struct {
+	Min, Max byte
+}
+
+// Add extends the range with the characters of qual.
+func (q *QualityRange) Add(qual []byte) {
+	for _, c := range qual {
+		if q.Min == 0 || c < q.Min {
+			q.Min = c
+		}
+		if c > q.Max {
+			q.Max = c
+		}
+	}
+}
+
+// Merge extends the range with another one.
+func (q *QualityRange) Merge(o QualityRange) {
+	if o.Min != 0 {
+		q.Add([]byte{o.Min, o.Max})
+	}
+}
+
+// Encoding infers the encoding. Characters below ';' only occur in Phred+33
+// data, and those from ';' to '?' only in Phred+33 or Solexa data. When
+// every character is '@' or above, a high maximum is taken as Phred+64;
+// otherwise the data is Phred+33 reads of uniformly high quality. An empty
+// range is reported as Phred+33.
+func (q QualityRange) Encoding() Encoding {
+	switch {
+	case q.Min == 0 || q.Min < ';':
+		return Phred33
+	case q.Max <= 'K':
+		// Phred+33 tops out at 'J' or 'K' (Q41-42) for Illumina reads;
+		// Phred+64 data would need every base below Q12 to stay this low.
+		return Phred33
+	case q.Min < '@':
+		return Solexa64
+	}
+	return Phred64
+}
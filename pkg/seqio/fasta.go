@@ -0,0 +1,138 @@
+package seqio
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// FastaReader reads FASTA records whose sequences may span any number of
+// lines. Blank lines are skipped.
+type FastaReader struct {
+	lines lineReader
+	// Validate makes Read check every record with Record.Validate.
+	Validate bool
+	closer   io.Closer
+	// header is the header of the next record, read while looking for
+	// the end of the previous one.
+	header     []byte
+	headerLine int
+	records    int64
+}
+
+// NewFastaReader reads FASTA records from r, which must already be
+// decompressed.
+func NewFastaReader(r io.Reader) *FastaReader {
+	return &FastaReader{lines: lineReader{br: bufio.NewReaderSize(r, readBufferSize)}}
+}
+
+// OpenFasta opens a FASTA file, which may be compressed.
+func OpenFasta(path string) (*FastaReader, error) {
+	rc, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewFastaReader(rc)
+	r.closer = rc
+	return r, nil
+}
+
+// Close closes the file opened by OpenFasta.
+func (r *FastaReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Records is the number of records read so far.
+func (r *FastaReader) Records() int64 {
+	return r.records
+}
+
+// Read returns the next record, or io.EOF after the last one.
+func (r *FastaReader) Read() (*Record, error) {
+	if r.header == nil {
+		for {
+			line, err := r.lines.next()
+			if err != nil {
+				return nil, err
+			}
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			if line[0] != '>' {
+				return nil, &ParseError{Line: r.lines.line, Msg: fmt.Sprintf("expected a FASTA header starting with '>', got %q", truncate(line))}
+			}
+			r.header = append([]byte(nil), line[1:]...)
+			r.headerLine = r.lines.line
+			break
+		}
+	}
+
+	rec := &Record{Header: r.header}
+	start := r.headerLine
+	r.header = nil
+	for {
+		line, err := r.lines.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(line) > 0 && line[0] == '>' {
+			r.header = append([]byte(nil), line[1:]...)
+			r.headerLine = r.lines.line
+			break
+		}
+		rec.Seq = append(rec.Seq, bytes.TrimSpace(line)...)
+	}
+	if r.Validate {
+		if err := rec.Validate(); err != nil {
+			return nil, &ParseError{Line: start, Msg: err.Error()}
+		}
+	}
+	r.records++
+	return rec, nil
+}
+
+// DefaultLineWidth is the sequence line length of FastaWriter.
+const DefaultLineWidth = 60
+
+// FastaWriter writes FASTA records, wrapping sequences at LineWidth bases
+// (no wrapping when it is 0).
+type FastaWriter struct {
+	w         *bufio.Writer
+	LineWidth int
+}
+
+func NewFastaWriter(w io.Writer) *FastaWriter {
+	return &FastaWriter{w: bufio.NewWriterSize(w, 64*1024), LineWidth: DefaultLineWidth}
+}
+
+// Write writes a record.
+func (w *FastaWriter) Write(r *Record) error {
+	w.w.WriteByte('>')
+	w.w.Write(r.Header)
+	w.w.WriteByte('\n')
+	seq := r.Seq
+	for len(seq) > 0 {
+		n := len(seq)
+		if w.LineWidth > 0 {
+			n = min(n, w.LineWidth)
+		}
+		w.w.Write(seq[:n])
+		if err := w.w.WriteByte('\n'); err != nil {
+			return err
+		}
+		seq = seq[n:]
+	}
+	return nil
+}
+
+// Flush writes buffered records to the underlying writer.
+func (w *FastaWriter) Flush() error {
+	return w.w.Flush()
+}
@@ -0,0 +1,142 @@
+package seqio
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// FastqReader reads four-line FASTQ records. Every record is checked for
+// the '@' and '+' lines and for matching sequence and quality lengths;
+// Validate checks the contents as well.
+type FastqReader struct {
+	lines lineReader
+	// Validate makes Read check every record with Record.Validate.
+	Validate bool
+	closer   io.Closer
+	records  int64
+}
+
+// NewFastqReader reads FASTQ records from r, which must already be
+// decompressed.
+func NewFastqReader(r io.Reader) *FastqReader {
+	return &FastqReader{lines: lineReader{br: bufio.NewReaderSize(r, readBufferSize)}}
+}
+
+// OpenFastq opens a FASTQ file, which may be compressed.
+func OpenFastq(path string) (*FastqReader, error) {
+	rc, err := Open(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewFastqReader(rc)
+	r.closer = rc
+	return r, nil
+}
+
+// Close closes the file opened by OpenFastq.
+func (r *FastqReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// Records is the number of records read so far.
+func (r *FastqReader) Records() int64 {
+	return r.records
+}
+
+// Read returns the next record, or io.EOF after the last one. A file that
+// ends within a record yields a *ParseError, as does a malformed record.
+func (r *FastqReader) Read() (*Record, error) {
+	header, err := r.lines.next()
+	if err != nil {
+		return nil, err
+	}
+	start := r.lines.line
+	if len(header) == 0 || header[0] != '@' {
+		return nil, &ParseError{Line: start, Msg: fmt.Sprintf("expected a FASTQ header starting with '@', got %q", truncate(header))}
+	}
+	// The lines are only valid until the next one is read, so they are
+	// copied into a single buffer as they arrive.
+	buf := make([]byte, 0, 3*len(header)+64)
+	buf = append(buf, header[1:]...)
+	headerEnd := len(buf)
+
+	seq, err := r.nextLine(start)
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, seq...)
+	seqEnd := len(buf)
+
+	plus, err := r.nextLine(start)
+	if err != nil {
+		return nil, err
+	}
+	if len(plus) == 0 || plus[0] != '+' {
+		return nil, &ParseError{Line: r.lines.line, Msg: fmt.Sprintf("expected a '+' separator line, got %q", truncate(plus))}
+	}
+
+	qual, err := r.nextLine(start)
+	if err != nil {
+		return nil, err
+	}
+	if len(qual) != seqEnd-headerEnd {
+		return nil, &ParseError{Line: r.lines.line, Msg: fmt.Sprintf("read %s has %d bases but %d qualities", buf[:headerEnd], seqEnd-headerEnd, len(qual))}
+	}
+	buf = append(buf, qual...)
+
+	rec := &Record{Header: buf[:headerEnd:headerEnd], Seq: buf[headerEnd:seqEnd:seqEnd], Qual: buf[seqEnd:]}
+	if r.Validate {
+		if err := rec.Validate(); err != nil {
+			return nil, &ParseError{Line: start, Msg: err.Error()}
+		}
+	}
+	r.records++
+	return rec, nil
+}
+
+// nextLine reads a line that has to be there to complete the record
+// starting at line start.
+func (r *FastqReader) nextLine(start int) ([]byte, error) {
+	line, err := r.lines.next()
+	if err == io.EOF {
+		return nil, &ParseError{Line: start, Msg: "truncated FASTQ record at the end of the file"}
+	}
+	return line, err
+}
+
+// FastqWriter writes FASTQ records.
+type FastqWriter struct {
+	w *bufio.Writer
+}
+
+func NewFastqWriter(w io.Writer) *FastqWriter {
+	return &FastqWriter{w: bufio.NewWriterSize(w, 64*1024)}
+}
+
+// Write writes a record; its qualities must be set.
+func (w *FastqWriter) Write(r *Record) error {
+	w.w.WriteByte('@')
+	w.w.Write(r.Header)
+	w.w.WriteByte('\n')
+	w.w.Write(r.Seq)
+	w.w.WriteString("\n+\n")
+	w.w.Write(r.Qual)
+	return w.w.WriteByte('\n')
+}
+
+// Flush writes buffered records to the underlying writer.
+func (w *FastqWriter) Flush() error {
+	return w.w.Flush()
+}
+
+// truncate shortens a line quoted in an error message.
+func truncate(line []byte) []byte {
+	if len(line) > 60 {
+		return line[:60]
+	}
+	return line
+}
@@ -0,0 +1,88 @@
+package seqio
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrPairMismatch is returned when the mates read from the two files
+	// of a pair have different names.
+	ErrPairMismatch = errors.New("paired reads are out of sync")
+	// ErrPairCount is returned when one file of a pair has more reads
+	// than the other.
+	ErrPairCount = errors.New("paired read files have different numbers of reads")
+)
+
+// PairedReader reads the forward and reverse reads of a paired-end library
+// in step, checking that the mates of each pair carry the same name.
+type PairedReader struct {
+	r1, r2 *FastqReader
+	pairs  int64
+}
+
+func NewPairedReader(r1, r2 *FastqReader) *PairedReader {
+	return &PairedReader{r1: r1, r2: r2}
+}
+
+// OpenPaired opens the two files of a paired-end library.
+func OpenPaired(path1, path2 string) (*PairedReader, error) {
+	r1, err := OpenFastq(path1)
+	if err != nil {
+		return nil, err
+	}
+	r2, err := OpenFastq(path2)
+	if err != nil {
+		r1.Close()
+		return nil, err
+	}
+	return NewPairedReader(r1, r2), nil
+}
+
+// Close closes both files.
+func (p *PairedReader) Close() error {
+	err1 := p.r1.Close()
+	if err2 := p.r2.Close(); err1 == nil {
+		err1 = err2
+	}
+	return err1
+}
+
+// Pairs is the number of pairs read so far.
+func (p *PairedReader) Pairs() int64 {
+	return p.pairs
+}
+
+// SetValidate turns record validation on or off for both files.
+func (p *PairedReader) SetValidate(v bool) {
+	p.r1.Validate = v
+	p.r2.Validate = v
+}
+
+// Read returns the next pair, or io.EOF once both files end together.
+// Mates with different names yield an error wrapping ErrPairMismatch, and
+// a file that ends before the other one an error wrapping ErrPairCount.
+func (p *PairedReader) Read() (*Record, *Record, error) {
+	rec1, err1 := p.r1.Read()
+	if err1 != nil && err1 != io.EOF {
+		return nil, nil, fmt.Errorf("forward reads: %w", err1)
+	}
+	rec2, err2 := p.r2.Read()
+	if err2 != nil && err2 != io.EOF {
+		return nil, nil, fmt.Errorf("reverse reads: %w", err2)
+	}
+	switch {
+	case err1 == io.EOF && err2 == io.EOF:
+		return nil, nil, io.EOF
+	case err1 == io.EOF:
+		return nil, nil, fmt.Errorf("%w: the forward reads end after %d reads, the reverse reads do not", ErrPairCount, p.pairs)
+	case err2 == io.EOF:
+		return nil, nil, fmt.Errorf("%w: the reverse reads end after %d reads, the forward reads do not", ErrPairCount, p.pairs)
+	}
+	if n1, n2 := rec1.PairName(), rec2.PairName(); string(n1) != string(n2) {
+		return nil, nil, fmt.Errorf("%w: pair %d has the forward read %s and the reverse read %s", ErrPairMismatch, p.pairs+1, n1, n2)
+	}
+	p.pairs++
+	return rec1, rec2, nil
+}
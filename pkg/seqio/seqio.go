@@ -0,0 +1,253 @@
+// Package seqio reads and writes FASTA and FASTQ files as streams of
+// records. Files may be plain, gzip-compressed (including multi-member
+// gzip, as written by parallel compressors) or BGZF-compressed; the
+// compression is detected from the file contents when reading.
+package seqio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Compression is the compression of a sequence file.
+type Compression int
+
+const (
+	None Compression = iota
+	Gzip
+	// BGZF is the blocked gzip format of bgzip and samtools. It is valid
+	// multi-member gzip, so any gzip reader can read it.
+	BGZF
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case BGZF:
+		return "bgzf"
+	}
+	return "none"
+}
+
+// readBufferSize is the buffer used for reading and writing files.
+const readBufferSize = 1 << 20
+
+// DetectCompression looks at the start of r without consuming it.
+func DetectCompression(r *bufio.Reader) Compression {
+	header, _ := r.Peek(16)
+	if len(header) < 2 || header[0] != 0x1f || header[1] != 0x8b {
+		return None
+	}
+	// A BGZF block is a gzip member with a "BC" extra subfield.
+	const flagExtra = 1 << 2
+	if len(header) == 16 && header[3]&flagExtra != 0 && header[12] == 'B' && header[13] == 'C' {
+		return BGZF
+	}
+	return Gzip
+}
+
+// CompressionFor picks the compression for a file from its name: gzip for
+// ".gz", BGZF for ".bgz" and ".bgzf", none otherwise.
+func CompressionFor(path string) Compression {
+	switch {
+	case strings.HasSuffix(path, ".gz"):
+		return Gzip
+	case strings.HasSuffix(path, ".bgz"), strings.HasSuffix(path, ".bgzf"):
+		return BGZF
+	}
+	return None
+}
+
+// Open opens a file for reading, decompressing it when it is compressed.
+func Open(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	r, err := NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return &readCloser{Reader: r, closers: []io.Closer{r, f}}, nil
+}
+
+// NewReader returns a reader of the decompressed contents of r.
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReaderSize(r, readBufferSize)
+	if DetectCompression(br) == None {
+		return io.NopCloser(br), nil
+	}
+	// gzip.Reader reads all members of a multi-member stream.
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, err
+	}
+	return gz, nil
+}
+
+// Create creates a file for writing with the given compression. Closing
+// the writer flushes the compressor and closes the file.
+func Create(path string, c Compression) (io.WriteCloser, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	bw := bufio.NewWriterSize(f, readBufferSize)
+	var w io.Writer = bw
+	var closers []io.Closer
+	switch c {
+	case Gzip:
+		gz := gzip.NewWriter(bw)
+		w, closers = gz, append(closers, gz)
+	case BGZF:
+		bg := NewBGZFWriter(bw)
+		w, closers = bg, append(closers, bg)
+	}
+	closers = append(closers, flushCloser{bw}, f)
+	return &writeCloser{Writer: w, closers: closers}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (r *readCloser) Close() error {
+	var first error
+	for _, c := range r.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type writeCloser struct {
+	io.Writer
+	closers []io.Closer
+}
+
+func (w *writeCloser) Close() error {
+	var first error
+	for _, c := range w.closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+type flushCloser struct {
+	w *bufio.Writer
+}
+
+func (f flushCloser) Close() error {
+	return f.w.Flush()
+}
+
+// Record is one FASTA or FASTQ record. Header is the header line without
+// its '>' or '@'; Qual is nil for FASTA records.
+type Record struct {
+	Header []byte
+	Seq    []byte
+	Qual   []byte
+}
+
+// Name is the first word of the header, the read or sequence identifier.
+func (r *Record) Name() []byte {
+	if i := bytes.IndexAny(r.Header, " \t"); i >= 0 {
+		return r.Header[:i]
+	}
+	return r.Header
+}
+
+// PairName is Name without the "/1" or "/2" suffix older Illumina
+// pipelines add to the mates of a pair.
+func (r *Record) PairName() []byte {
+	name := r.Name()
+	if n := len(name); n > 2 && name[n-2] == '/' && (name[n-1] == '1' || name[n-1] == '2') {
+		return name[:n-2]
+	}
+	return name
+}
+
+// Validate checks the bases and, for FASTQ records, the qualities: bases
+// must be IUPAC nucleotide codes (or '.', '-' or '*' for gaps and unknown
+// bases) in either case and qualities printable ASCII from '!' to '~'.
+func (r *Record) Validate() error {
+	if len(r.Header) == 0 {
+		return fmt.Errorf("record has an empty header")
+	}
+	for i, c := range r.Seq {
+		if !validBase[c] {
+			return fmt.Errorf("record %s has an invalid base %q at position %d", r.Name(), c, i+1)
+		}
+	}
+	if r.Qual == nil {
+		return nil
+	}
+	if len(r.Qual) != len(r.Seq) {
+		return fmt.Errorf("record %s has %d bases but %d qualities", r.Name(), len(r.Seq), len(r.Qual))
+	}
+	for i, c := range r.Qual {
+		if c < '!' || c > '~' {
+			return fmt.Errorf("record %s has an invalid quality %q at position %d", r.Name(), c, i+1)
+		}
+	}
+	return nil
+}
+
+var validBase = func() (t [256]bool) {
+	for _, c := range "ACGTUNRYSWKMBDHV.-*" {
+		t[c] = true
+		t[c|0x20] = true
+	}
+	return t
+}()
+
+// ParseError reports malformed input with the line it was found on.
+type ParseError struct {
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Msg)
+}
+
+// lineReader reads lines without their line ending, counting them.
+type lineReader struct {
+	br   *bufio.Reader
+	line int
+	buf  []byte
+}
+
+// next returns the next line, which is only valid until the following
+// call, or io.EOF at the end of the input.
+func (l *lineReader) next() ([]byte, error) {
+	line, err := l.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		l.buf = append(l.buf[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = l.br.ReadSlice('\n')
+			l.buf = append(l.buf, line...)
+		}
+		line = l.buf
+	}
+	if err == io.EOF && len(line) > 0 {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.line++
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	return bytes.TrimSuffix(line, []byte{'\r'}), nil
+}
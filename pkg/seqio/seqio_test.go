@@ -0,0 +1,271 @@
+package seqio
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var testReads = []Record{
+	{Header: []byte("read1/1 first"), Seq: []byte("ACGTNacgt"), Qual: []byte("IIIII#!~I")},
+	{Header: []byte("read2/1"), Seq: []byte(""), Qual: []byte("")},
+	{Header: []byte("read3/1"), Seq: []byte(strings.Repeat("GATTACA", 30)), Qual: []byte(strings.Repeat("5", 210))},
+}
+
+func readAllFastq(t *testing.T, r *FastqReader) []Record {
+	t.Helper()
+	var recs []Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			return recs
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, *rec)
+	}
+}
+
+func TestFastqRoundTrip(t *testing.T) {
+	for _, c := range []Compression{None, Gzip, BGZF} {
+		t.Run(c.String(), func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "reads.fastq")
+			wc, err := Create(path, c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := NewFastqWriter(wc)
+			for i := range testReads {
+				if err := w.Write(&testReads[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if err := wc.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			f, err := os.Open(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := DetectCompression(bufio.NewReader(f))
+			f.Close()
+			if got != c {
+				t.Errorf("compression detected as %s", got)
+			}
+
+			r, err := OpenFastq(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			r.Validate = true
+			if recs := readAllFastq(t, r); !reflect.DeepEqual(recs, testReads) {
+				t.Errorf("read back\n%q\nwant\n%q", recs, testReads)
+			}
+			if r.Records() != int64(len(testReads)) {
+				t.Errorf("counted %d records, want %d", r.Records(), len(testReads))
+			}
+		})
+	}
+}
+
+func TestFastqReaderCRLF(t *testing.T) {
+	r := NewFastqReader(strings.NewReader("@r1 x\r\nACGT\r\n+\r\nIIII\r\n@r2\r\nGG\r\n+r2\r\n##"))
+	want := []Record{
+		{Header: []byte("r1 x"), Seq: []byte("ACGT"), Qual: []byte("IIII")},
+		{Header: []byte("r2"), Seq: []byte("GG"), Qual: []byte("##")},
+	}
+	if recs := readAllFastq(t, r); !reflect.DeepEqual(recs, want) {
+		t.Errorf("read\n%q\nwant\n%q", recs, want)
+	}
+}
+
+func TestFastqReaderErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		validate bool
+		wantLine int
+		wantMsg  string
+	}{
+		{name: "truncated record", input: "@r1\nACGT\n+\nIIII\n@r2\nACGT\n", wantLine: 5, wantMsg: "truncated FASTQ record"},
+		{name: "truncated after header", input: "@r1\n", wantLine: 1, wantMsg: "truncated FASTQ record"},
+		{name: "no header", input: ">r1\nACGT\n+\nIIII\n", wantLine: 1, wantMsg: "starting with '@'"},
+		{name: "no separator", input: "@r1\nACGT\nIIII\n@r2\n", wantLine: 3, wantMsg: "'+' separator"},
+		{name: "short qualities", input: "@r1\nACGT\n+\nIII\n", wantLine: 4, wantMsg: "4 bases but 3 qualities"},
+		{name: "invalid base", input: "@r1\nACGJ\n+\nIIII\n", validate: true, wantLine: 1, wantMsg: "invalid base 'J' at position 4"},
+		{name: "invalid quality", input: "@r1\nACGT\n+\nII I\n", validate: true, wantLine: 1, wantMsg: "invalid quality ' ' at position 3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewFastqReader(strings.NewReader(tt.input))
+			r.Validate = tt.validate
+			var err error
+			for err == nil {
+				_, err = r.Read()
+			}
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("got error %v, want a parse error", err)
+			}
+			if perr.Line != tt.wantLine || !strings.Contains(perr.Msg, tt.wantMsg) {
+				t.Errorf("got %q, want line %d and a message containing %q", perr, tt.wantLine, tt.wantMsg)
+			}
+		})
+	}
+}
+
+func TestFastaRoundTrip(t *testing.T) {
+	in := ">c1 first\nACGT\n\nAC\n>c2\n\n>c3\r\nGG\r\n"
+	r := NewFastaReader(strings.NewReader(in))
+	r.Validate = true
+	var recs []*Record
+	for {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	var out bytes.Buffer
+	w := NewFastaWriter(&out)
+	w.LineWidth = 4
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if want := ">c1 first\nACGT\nAC\n>c2\n>c3\nGG\n"; out.String() != want {
+		t.Errorf("wrote %q, want %q", out.String(), want)
+	}
+
+	_, err := NewFastaReader(strings.NewReader("ACGT\n")).Read()
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.Line != 1 {
+		t.Errorf("sequence without header gave %v", err)
+	}
+}
+
+func TestPairedReader(t *testing.T) {
+	fastq := func(names ...string) *FastqReader {
+		var b strings.Builder
+		for _, name := range names {
+			b.WriteString("@" + name + "\nACGT\n+\nIIII\n")
+		}
+		return NewFastqReader(strings.NewReader(b.String()))
+	}
+	tests := []struct {
+		name       string
+		r1, r2     []string
+		wantPairs  int64
+		wantErr    error
+		wantErrMsg string
+	}{
+		{name: "slash suffixes", r1: []string{"a/1", "b/1"}, r2: []string{"a/2", "b/2"}, wantPairs: 2},
+		{name: "same names", r1: []string{"a 1:N:0", "b 1:N:0"}, r2: []string{"a 2:N:0", "b 2:N:0"}, wantPairs: 2},
+		{name: "mismatched names", r1: []string{"a/1", "b/1"}, r2: []string{"a/2", "c/2"}, wantPairs: 1, wantErr: ErrPairMismatch, wantErrMsg: "pair 2 has the forward read b and the reverse read c"},
+		{name: "reverse reads missing", r1: []string{"a/1", "b/1"}, r2: []string{"a/2"}, wantPairs: 1, wantErr: ErrPairCount, wantErrMsg: "the reverse reads end after 1 reads"},
+		{name: "forward reads missing", r1: []string{"a/1"}, r2: []string{"a/2", "b/2"}, wantPairs: 1, wantErr: ErrPairCount, wantErrMsg: "the forward reads end after 1 reads"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPairedReader(fastq(tt.r1...), fastq(tt.r2...))
+			var err error
+			for err == nil {
+				_, _, err = p.Read()
+			}
+			if tt.wantErr == nil && err != io.EOF {
+				t.Fatalf("got error %v", err)
+			}
+			if tt.wantErr != nil && (!errors.Is(err, tt.wantErr) || !strings.Contains(err.Error(), tt.wantErrMsg)) {
+				t.Fatalf("got error %v, want %v containing %q", err, tt.wantErr, tt.wantErrMsg)
+			}
+			if p.Pairs() != tt.wantPairs {
+				t.Errorf("read %d pairs, want %d", p.Pairs(), tt.wantPairs)
+			}
+		})
+	}
+}
+
+func TestBGZFWriter(t *testing.T) {
+	// Text compresses well; random bytes do not and need stored blocks.
+	text := bytes.Repeat([]byte("@read\nACGTACGTTGCA\n+\nIIIIIIIIIIII\n"), 5000)
+	noise := make([]byte, 3*bgzfBlockData)
+	rand.New(rand.NewSource(1)).Read(noise)
+	data := append(text, noise...)
+
+	var out bytes.Buffer
+	w := NewBGZFWriter(&out)
+	// Odd write sizes cross the block boundaries.
+	for rest := data; len(rest) > 0; {
+		n := min(len(rest), 12345)
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatal(err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	file := out.Bytes()
+
+	if !bytes.HasSuffix(file, bgzfEOF) {
+		t.Error("the file does not end with the BGZF end-of-file block")
+	}
+	// Every block carries its own size in the BC subfield.
+	blocks := 0
+	for rest := file; len(rest) > 0; blocks++ {
+		if len(rest) < bgzfHeaderSize || DetectCompression(bufio.NewReader(bytes.NewReader(rest))) != BGZF {
+			t.Fatalf("block %d has no BGZF header", blocks)
+		}
+		size := int(binary.LittleEndian.Uint16(rest[16:])) + 1
+		if size > len(rest) || size > bgzfMaxBlock {
+			t.Fatalf("block %d has size %d with %d bytes left", blocks, size, len(rest))
+		}
+		rest = rest[size:]
+	}
+	if want := (len(data)+bgzfBlockData-1)/bgzfBlockData + 1; blocks != want {
+		t.Errorf("got %d blocks, want %d", blocks, want)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("decompressed %d bytes that differ from the %d written", len(got), len(data))
+	}
+
+	if _, err := exec.LookPath("gzip"); err == nil {
+		cmd := exec.Command("gzip", "-t")
+		cmd.Stdin = bytes.NewReader(file)
+		if msg, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("gzip -t rejects the file: %v %s", err, msg)
+		}
+	}
+}